@@ -15,7 +15,9 @@ import (
 	"k8s.io/client-go/rest"
 
 	"github.com/webhookrelay/webhookrelay-operator/pkg/apis"
+	operatorconfig "github.com/webhookrelay/webhookrelay-operator/pkg/config"
 	"github.com/webhookrelay/webhookrelay-operator/pkg/controller"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/controller/webhookrelayforward"
 	"github.com/webhookrelay/webhookrelay-operator/version"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
@@ -88,6 +90,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	operatorConfig, err := operatorconfig.Load()
+	if err != nil {
+		log.Error(err, "Failed to load operator configuration")
+		os.Exit(1)
+	}
+
 	ctx := context.TODO()
 	// Become the leader before proceeding
 	err = leader.Become(ctx, "webhookrelay-operator-lock")
@@ -101,6 +109,8 @@ func main() {
 		Namespace:              namespace,
 		MetricsBindAddress:     fmt.Sprintf("%s:%d", metricsHost, metricsPort),
 		HealthProbeBindAddress: fmt.Sprintf("%s:%d", metricsHost, operatorHealthPort),
+		Port:                   operatorConfig.Webhooks.Port,
+		CertDir:                operatorConfig.Webhooks.CertDir,
 	}
 
 	// Add support for MultiNamespace set in WATCH_NAMESPACE (e.g ns1,ns2)
@@ -142,6 +152,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup admission webhooks that default and validate CRs before they are stored
+	if operatorConfig.Webhooks.Enabled {
+		if err := webhookrelayforward.AddWebhooks(mgr); err != nil {
+			log.Error(err, "Failed to register webhooks")
+			os.Exit(1)
+		}
+	}
+
 	// Add the Metrics Service
 	addMetrics(ctx, cfg)
 
@@ -0,0 +1,10 @@
+package apis
+
+import (
+	"github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1beta2"
+)
+
+func init() {
+	// Register the types with the Scheme so the components can map objects to GroupVersionKinds and back
+	AddToSchemes = append(AddToSchemes, v1beta2.SchemeBuilder.AddToScheme)
+}
@@ -4,4 +4,9 @@ package v1
 const (
 	AccessTokenKeyName    = "key"
 	AccessTokenSecretName = "secret"
+
+	// Bucket authentication secret keys
+	BucketAuthUsernameName = "username"
+	BucketAuthPasswordName = "password"
+	BucketAuthTokenName    = "token"
 )
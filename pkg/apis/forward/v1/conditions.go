@@ -0,0 +1,107 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is a type of the CR condition
+type ConditionType string
+
+// Available condition types
+const (
+	// ConditionCredentialsValid is true when Webhook Relay API accepts the configured credentials
+	ConditionCredentialsValid ConditionType = "CredentialsValid"
+	// ConditionBucketsOwned is true when all buckets in the spec are managed by this CR
+	ConditionBucketsOwned ConditionType = "BucketsOwned"
+	// ConditionBucketsReady is true when all buckets exist and match the spec
+	ConditionBucketsReady ConditionType = "BucketsReady"
+	// ConditionInputsReady is true when all bucket inputs match the spec
+	ConditionInputsReady ConditionType = "InputsReady"
+	// ConditionOutputsReady is true when all bucket outputs match the spec
+	ConditionOutputsReady ConditionType = "OutputsReady"
+	// ConditionAgentAvailable is true when the webhookrelayd agent deployment is available
+	ConditionAgentAvailable ConditionType = "AgentAvailable"
+	// ConditionReady is true when all other conditions are true
+	ConditionReady ConditionType = "Ready"
+)
+
+// Condition reasons
+const (
+	ReasonOwned           = "Owned"
+	ReasonConflict        = "Conflict"
+	ReasonNotManaged      = "NotManaged"
+	ReasonAdoptionRefused = "AdoptionRefused"
+
+	ReasonCredentialsNotFound = "CredentialsNotFound"
+	ReasonInvalidCredentials  = "InvalidCredentials"
+	ReasonCredentialsAccepted = "CredentialsAccepted"
+	ReasonAPIUnavailable      = "APIUnavailable"
+
+	ReasonConfigured            = "Configured"
+	ReasonConfigFailed          = "ConfigurationFailed"
+	ReasonPlanned               = "ChangesPlanned"
+	ReasonNotChecked            = "NotChecked"
+	ReasonDeploymentReady       = "DeploymentReady"
+	ReasonDeploymentFailed      = "DeploymentFailed"
+	ReasonDeploymentUpdate      = "DeploymentUpdating"
+	ReasonDeploymentProgressing = "DeploymentProgressing"
+	ReasonDeploymentStalled     = "ProgressDeadlineExceeded"
+	ReasonAgentPodsFailing      = "AgentPodsFailing"
+	ReasonTerminating           = "Terminating"
+	ReasonReady                 = "Ready"
+	ReasonNotReady              = "NotReady"
+)
+
+// Condition describes the state of the CR at a certain point
+type Condition struct {
+	// Type of the condition
+	Type ConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the CR generation that the condition was set based upon
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the condition transitioned from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a one-word CamelCase reason for the condition's last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable message indicating details about the transition
+	Message string `json:"message,omitempty"`
+}
+
+// GetCondition returns condition of the provided type
+func (s *WebhookRelayForwardStatus) GetCondition(t ConditionType) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition. LastTransitionTime is only
+// changed when the condition status changes.
+func (s *WebhookRelayForwardStatus) SetCondition(c Condition) {
+	existing := s.GetCondition(c.Type)
+	if existing == nil {
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, c)
+		return
+	}
+
+	if existing.Status != c.Status {
+		existing.Status = c.Status
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.ObservedGeneration = c.ObservedGeneration
+	existing.Reason = c.Reason
+	existing.Message = c.Message
+}
+
+// IsConditionTrue checks whether condition of the provided type is set to True
+func (s *WebhookRelayForwardStatus) IsConditionTrue(t ConditionType) bool {
+	c := s.GetCondition(t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
@@ -0,0 +1,113 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookRelayAccountSpec defines the desired state of WebhookRelayAccount
+type WebhookRelayAccountSpec struct {
+	// SecretRef is the secret that contains generated token from https://my.webhookrelay.com/tokens,
+	// secret should have "key" and "secret" fields
+	SecretRef SecretReference `json:"secretRef"`
+
+	// AllowedNamespaces lists namespaces whose CRs can use this account, "*" allows all
+	// namespaces. If empty, the account can't be used by any CR.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+// SecretReference points to a secret in any namespace
+type SecretReference struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// Namespace of the secret
+	Namespace string `json:"namespace"`
+}
+
+// AccountReference selects a WebhookRelayAccount
+type AccountReference struct {
+	// Name of the WebhookRelayAccount
+	Name string `json:"name"`
+}
+
+// AllAccountNamespaces can be used in AllowedNamespaces to allow all namespaces
+const AllAccountNamespaces = "*"
+
+// AllowsNamespace checks whether CRs from the namespace can use the account,
+// namespaces have to be allowed explicitly
+func (in *WebhookRelayAccount) AllowsNamespace(namespace string) bool {
+	for _, allowed := range in.Spec.AllowedNamespaces {
+		if allowed == namespace || allowed == AllAccountNamespaces {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenStatus is the result of the access token check
+type TokenStatus string
+
+// Available token statuses
+const (
+	// TokenStatusValid - Webhook Relay API accepted the token
+	TokenStatusValid TokenStatus = "Valid"
+	// TokenStatusInvalid - secret is missing or Webhook Relay API rejected the token
+	TokenStatusInvalid TokenStatus = "Invalid"
+	// TokenStatusUnknown - token couldn't be checked, i.e. Webhook Relay API is not reachable
+	TokenStatusUnknown TokenStatus = "Unknown"
+)
+
+// AccountUsage is the number of buckets, inputs and outputs in the account
+type AccountUsage struct {
+	Buckets int `json:"buckets"`
+	Inputs  int `json:"inputs"`
+	Outputs int `json:"outputs"`
+}
+
+// WebhookRelayAccountStatus defines the observed state of WebhookRelayAccount
+type WebhookRelayAccountStatus struct {
+	// ObservedGeneration is the most recent account generation observed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	TokenStatus TokenStatus `json:"tokenStatus,omitempty"`
+	// Message explains the token status, i.e. the last error
+	Message string `json:"message,omitempty"`
+	// LastCheckedTime is when the token was last checked
+	LastCheckedTime *metav1.Time `json:"lastCheckedTime,omitempty"`
+
+	// Usage of the account quota. Plan limits are not exposed by the Webhook Relay API.
+	Usage *AccountUsage `json:"usage,omitempty"`
+	// RateLimitedUntil is set while Webhook Relay API is rejecting requests because the
+	// account exceeded its API request quota
+	RateLimitedUntil *metav1.Time `json:"rateLimitedUntil,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayAccount is a Webhook Relay account that can be shared by CRs in multiple
+// namespaces without giving them access to the credentials, agents of these CRs get
+// scoped tokens
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Token",type="string",JSONPath=".status.tokenStatus"
+// +kubebuilder:printcolumn:name="Buckets",type="integer",JSONPath=".status.usage.buckets"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:path=webhookrelayaccounts,scope=Cluster
+type WebhookRelayAccount struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WebhookRelayAccountSpec   `json:"spec,omitempty"`
+	Status WebhookRelayAccountStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayAccountList contains a list of WebhookRelayAccount
+type WebhookRelayAccountList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WebhookRelayAccount `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WebhookRelayAccount{}, &WebhookRelayAccountList{})
+}
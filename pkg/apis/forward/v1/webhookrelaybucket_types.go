@@ -0,0 +1,103 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookRelayBucketSpec defines the desired state of WebhookRelayBucket
+type WebhookRelayBucketSpec struct {
+	// SecretRefName is the name of the secret in the CR namespace that contains generated
+	// token from https://my.webhookrelay.com/tokens (same format as WebhookRelayForward
+	// secretRefName). Inputs and outputs of the bucket are managed with the same credentials.
+	// Defaults to the credentials configured on the operator.
+	SecretRefName string `json:"secretRefName,omitempty"`
+
+	// Name of the bucket, defaults to the CR name
+	Name string `json:"name,omitempty"`
+
+	// Description can be any string
+	Description string `json:"description,omitempty"`
+
+	// AdoptionPolicy controls what the operator does when a bucket with this name
+	// already exists but wasn't created by the operator. "Adopt" (default) takes over
+	// the bucket but never deletes it, "ManagedOnly" leaves it unmanaged and "Fail"
+	// refuses to use it. Input and output CRs referencing the bucket follow the same
+	// policy for existing inputs and outputs with their names.
+	// +kubebuilder:validation:Enum=Adopt;ManagedOnly;Fail
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// Auth configures authentication for requests that are sent to the bucket inputs.
+	// If not set, operator doesn't change bucket authentication settings.
+	Auth *BucketAuth `json:"auth,omitempty"`
+
+	// DeletionPolicy controls what happens to the bucket when this CR is deleted. "Retain"
+	// (default) leaves it untouched, "Delete" waits for the input and output CRs that
+	// reference it to be deleted and removes it if it was created by the operator and
+	// has no inputs or outputs left.
+	// +kubebuilder:validation:Enum=Retain;Delete
+	DeletionPolicy RoutingObjectDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// RoutingObjectDeletionPolicy specifies whether a bucket, input or output is deleted
+// from Webhook Relay together with its CR
+type RoutingObjectDeletionPolicy string
+
+// Available deletion policies of buckets, inputs and outputs
+const (
+	RoutingObjectDeletionPolicyRetain RoutingObjectDeletionPolicy = "Retain"
+	RoutingObjectDeletionPolicyDelete RoutingObjectDeletionPolicy = "Delete"
+)
+
+// RoutingObjectStatus is the observed state of a bucket, input or output CR
+type RoutingObjectStatus struct {
+	// ObservedGeneration is the most recent CR generation observed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ID on the Webhook Relay side
+	ID    string    `json:"id,omitempty"`
+	State SyncState `json:"state,omitempty"`
+	// Message explains the state, i.e. the last error
+	Message string `json:"message,omitempty"`
+}
+
+// WebhookRelayBucketStatus defines the observed state of WebhookRelayBucket
+type WebhookRelayBucketStatus struct {
+	RoutingObjectStatus `json:",inline"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayBucket is a bucket managed separately from its inputs and outputs, which
+// are defined as WebhookRelayInput and WebhookRelayOutput CRs in the same namespace
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="ID",type="string",JSONPath=".status.id"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:path=webhookrelaybuckets,scope=Namespaced
+type WebhookRelayBucket struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WebhookRelayBucketSpec   `json:"spec,omitempty"`
+	Status WebhookRelayBucketStatus `json:"status,omitempty"`
+}
+
+// BucketName returns the name of the bucket on the Webhook Relay side
+func (in *WebhookRelayBucket) BucketName() string {
+	if in.Spec.Name != "" {
+		return in.Spec.Name
+	}
+	return in.GetName()
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayBucketList contains a list of WebhookRelayBucket
+type WebhookRelayBucketList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WebhookRelayBucket `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WebhookRelayBucket{}, &WebhookRelayBucketList{})
+}
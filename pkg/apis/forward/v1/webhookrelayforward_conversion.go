@@ -0,0 +1,5 @@
+package v1
+
+// Hub marks v1 as the version other WebhookRelayForward versions are converted
+// to and from, it's also the version CRs are stored in
+func (*WebhookRelayForward) Hub() {}
@@ -0,0 +1,50 @@
+package v1
+
+import "fmt"
+
+// DefaultBucketDescription is the description of buckets that don't have one in the spec
+func DefaultBucketDescription(namespace, name string) string {
+	return fmt.Sprintf("Auto-created bucket by the operator for %s/%s", namespace, name)
+}
+
+// OutputInternal returns whether webhooks are sent to an internal destination, outputs
+// are internal by default as they are served by the agents running in the cluster
+func (o *OutputSpec) OutputInternal() bool {
+	if o.Internal == nil {
+		return true
+	}
+	return *o.Internal
+}
+
+// SetDefaults fills in the defaults that the operator would otherwise apply during the
+// reconcile, so the stored CR shows the effective configuration. Image is the agent
+// image configured for the operator.
+func (in *WebhookRelayForward) SetDefaults(namespace, image string) {
+	spec := &in.Spec
+
+	if spec.Image == "" {
+		spec.Image = image
+	}
+	if spec.Mode == "" {
+		spec.Mode = RoutingModeApply
+	}
+	if spec.DeletionPolicy == "" {
+		spec.DeletionPolicy = DeletionPolicyRetain
+	}
+
+	for i := range spec.Buckets {
+		bucket := &spec.Buckets[i]
+		if bucket.Description == "" && in.Name != "" {
+			bucket.Description = DefaultBucketDescription(namespace, in.Name)
+		}
+		if bucket.AdoptionPolicy == "" {
+			bucket.AdoptionPolicy = AdoptionPolicyAdopt
+		}
+		for j := range bucket.Outputs {
+			if bucket.Outputs[j].Internal == nil {
+				internal := true
+				bucket.Outputs[j].Internal = &internal
+			}
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package v1
 
 import (
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // WebhookRelayForwardSpec defines the desired state of WebhookRelayForward
@@ -15,30 +17,235 @@ type WebhookRelayForwardSpec struct {
 	// If secret is lost, just create a new token
 	SecretRefName string `json:"secretRefName,omitempty"`
 
-	// SecretRefNamespace is the namespace of the secret reference.
+	// SecretRefNamespace is the namespace of the secret reference. Defaults to the CR namespace.
+	// Secret from another namespace is copied into the CR namespace as "<CR name>-whr-credentials"
+	// so the agent deployment can use it.
 	SecretRefNamespace string `json:"secretRefNamespace,omitempty"`
 
+	// AccountRef selects a cluster-scoped WebhookRelayAccount to use instead of the secret,
+	// account has to allow the CR namespace. Cannot be set together with secretRefName.
+	// Agent always gets a scoped token, account credentials are not copied into the CR namespace.
+	AccountRef *AccountReference `json:"accountRef,omitempty"`
+
 	// Image is webhookrelayd container, defaults to webhookrelay/webhookrelayd:latest
 	Image string `json:"image,omitempty"`
 
 	// Buckets to manage and subscribe to. Each CR can control one or more buckets. Buckets can be inspected
 	// and manually created via Web UI here https://my.webhookrelay.com/buckets
+	// +kubebuilder:validation:MinItems=1
 	Buckets []BucketSpec `json:"buckets"`
 
 	// Resources is to set the resource requirements of the Webhook Relay agent container`.
+	// Deprecated: use agent.resources, it takes precedence when set.
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Agent customises the webhookrelayd agent deployment pods
+	Agent *AgentSpec `json:"agent,omitempty"`
+
+	// DeletionPolicy controls what happens to the Webhook Relay configuration
+	// when this CR is deleted. "Retain" (default) leaves buckets, inputs and outputs
+	// untouched, "DeleteOutputs" removes outputs defined in the spec and "DeleteAll"
+	// removes both inputs and outputs defined in the spec and deletes buckets once
+	// they are empty.
+	// +kubebuilder:validation:Enum=Retain;DeleteOutputs;DeleteAll
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// AgentToken configures an access token provisioned by the operator for the agent
+	// deployment. When not set, agent uses the same credentials as the operator.
+	AgentToken *AgentTokenSpec `json:"agentToken,omitempty"`
+
+	// Mode controls whether routing changes are applied. "Apply" (default) configures
+	// buckets, inputs and outputs straight away, "Plan" only reports the changes that
+	// would be made in the status and events, agent deployment is not updated either.
+	// +kubebuilder:validation:Enum=Apply;Plan
+	Mode RoutingMode `json:"mode,omitempty"`
+}
+
+// AgentSpec customises the agent deployment. Changes made to these fields on the
+// deployment directly are reverted by the operator.
+type AgentSpec struct {
+	// Replicas is the number of agent pods, defaults to 1. Ignored when
+	// autoscaling is enabled.
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaling creates a HorizontalPodAutoscaler for the agent deployment
+	Autoscaling *AgentAutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// PodDisruptionBudget of the agent pods. By default, a budget with maxUnavailable 1
+	// is created when the agent runs more than one replica.
+	PodDisruptionBudget *AgentPodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// TopologySpreadConstraints of the agent pods. Defaults to spreading pods
+	// across nodes and zones when possible.
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// Resources are the resource requirements of the agent container
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// ImagePullPolicy of the agent container, defaults to Always
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// ImagePullSecrets are used to pull the agent image from private registries
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// ServiceAccountName is the service account the agent pods run as
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// NodeSelector constrains agent pods to nodes with matching labels
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the agent pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity scheduling rules of the agent pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// PriorityClassName of the agent pods
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// PodSecurityContext is the security context of the agent pods
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// SecurityContext is the security context of the agent container
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// Env are additional environment variables of the agent container. Variables
+	// set by the operator (buckets and credentials) can't be overridden.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Volumes are additional volumes of the agent pods
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// VolumeMounts are additional volume mounts of the agent container
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// PodLabels are additional labels of the agent pods
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
+	// PodAnnotations are additional annotations of the agent pods
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
+	// Health configures the agent health endpoint used for liveness and readiness
+	// probes. Probes are disabled by default.
+	Health *AgentHealthSpec `json:"health,omitempty"`
 }
 
+// AgentAutoscalingSpec configures horizontal pod autoscaler of the agent deployment
+type AgentAutoscalingSpec struct {
+	// MinReplicas is the lower limit of agent replicas, defaults to 1
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper limit of agent replicas
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the target average CPU utilization of the agent
+	// pods, defaults to 80 when no metrics are set. Requires agent CPU requests.
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// Metrics are custom metrics used for scaling in addition to the CPU utilization
+	Metrics []autoscalingv2beta2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// AgentPodDisruptionBudgetSpec configures agent pod disruption budget, only one
+// of the fields can be set
+type AgentPodDisruptionBudgetSpec struct {
+	// Disabled turns off the pod disruption budget
+	Disabled bool `json:"disabled,omitempty"`
+
+	// MinAvailable agent pods during voluntary disruptions
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable agent pods during voluntary disruptions, defaults to 1
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// AgentHealthSpec configures the agent health and metrics endpoint. The port is
+// exposed through "<CR name>-whr-agent" service.
+type AgentHealthSpec struct {
+	// Enabled turns on probes and the service. The agent image has to serve
+	// the health endpoint on the port.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Port of the agent health and metrics endpoint, defaults to 8080
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// LivenessPath is checked by the liveness probe, defaults to /health. Agent is
+	// restarted if it stays disconnected from Webhook Relay.
+	LivenessPath string `json:"livenessPath,omitempty"`
+
+	// ReadinessPath is checked by the readiness probe, defaults to /health
+	ReadinessPath string `json:"readinessPath,omitempty"`
+
+	// InitialDelaySeconds before the probes are started, defaults to 5
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds - how often the probes are performed, defaults to 10
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// FailureThreshold - number of failed probes after which the agent is
+	// restarted or marked as not ready, defaults to 3
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// AgentTokenSpec configures access token that the operator creates for the agent. Token
+// can only subscribe to the buckets from the spec and doesn't have API access.
+type AgentTokenSpec struct {
+	// Provision enables token provisioning. Token is stored in "<CR name>-whr-agent-token"
+	// secret and revoked when the CR is deleted. Always enabled for CRs that use accountRef.
+	Provision bool `json:"provision,omitempty"`
+
+	// RotationPeriod - how often the token is replaced with a new one, defaults to 720h (30 days)
+	RotationPeriod *metav1.Duration `json:"rotationPeriod,omitempty"`
+}
+
+// DeletionPolicy specifies what the operator should clean up on the Webhook Relay
+// side when the CR is deleted
+type DeletionPolicy string
+
+// Available deletion policies
+const (
+	DeletionPolicyRetain        DeletionPolicy = "Retain"
+	DeletionPolicyDeleteOutputs DeletionPolicy = "DeleteOutputs"
+	DeletionPolicyDeleteAll     DeletionPolicy = "DeleteAll"
+)
+
+// RoutingMode specifies whether the operator applies routing changes or only plans them
+type RoutingMode string
+
+// Available routing modes
+const (
+	RoutingModeApply RoutingMode = "Apply"
+	RoutingModePlan  RoutingMode = "Plan"
+)
+
 // BucketSpec defines a bucket that groups one or more inputs (public endpoints) and
 // one ore more outputs (where the webhooks should be routed)
 type BucketSpec struct {
 	// Name is the name of a bucket that can be reused
 	// (if it already exists) or that will be created by the operator. Buckets
 	// act as a grouping mechanism for Inputs and Outputs
+	// +kubebuilder:validation:MinLength=1
 	Name string `json:"name,omitempty"`
 
 	Description string `json:"description,omitempty"`
 
+	// AdoptionPolicy controls what the operator does when a bucket with this name
+	// already exists but wasn't created by the operator. "Adopt" (default) takes over
+	// the bucket but never deletes it, "ManagedOnly" uses it for forwarding but never modifies it and "Fail"
+	// refuses to use it.
+	// +kubebuilder:validation:Enum=Adopt;ManagedOnly;Fail
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// Auth configures authentication for requests that are sent to the bucket inputs.
+	// If not set, operator doesn't change bucket authentication settings.
+	Auth *BucketAuth `json:"auth,omitempty"`
+
 	// Inputs are your public endpoints. Inputs can either be https://my.webhookrelay.com/v1/webhooks/[unique ID]
 	// format or custom subdomains under https://[subdomain].hooks.webhookrelay.com or
 	// completely custom domains such as https://hooks.example.com.
@@ -50,8 +257,42 @@ type BucketSpec struct {
 	Outputs []OutputSpec `json:"outputs,omitempty"`
 }
 
+// AdoptionPolicy specifies how existing buckets that were not created by the operator
+// are treated
+type AdoptionPolicy string
+
+// Available adoption policies
+const (
+	AdoptionPolicyAdopt       AdoptionPolicy = "Adopt"
+	AdoptionPolicyManagedOnly AdoptionPolicy = "ManagedOnly"
+	AdoptionPolicyFail        AdoptionPolicy = "Fail"
+)
+
+// BucketAuthType is the authentication type for the bucket inputs
+type BucketAuthType string
+
+// Available bucket authentication types
+const (
+	BucketAuthTypeNone  BucketAuthType = "none"
+	BucketAuthTypeBasic BucketAuthType = "basic"
+	BucketAuthTypeToken BucketAuthType = "token"
+)
+
+// BucketAuth defines how requests to the bucket inputs are authenticated
+type BucketAuth struct {
+	// Type is the authentication type, one of "none", "basic" or "token"
+	// +kubebuilder:validation:Enum=none;basic;token
+	Type BucketAuthType `json:"type"`
+
+	// SecretRefName is the name of the secret in the CR namespace that contains credentials.
+	// For "basic" authentication secret should have "username" and "password" fields and for
+	// "token" authentication - "token" field.
+	SecretRefName string `json:"secretRefName,omitempty"`
+}
+
 // InputSpec defines an input that belong to a bucket
 type InputSpec struct {
+	// +kubebuilder:validation:MinLength=1
 	Name string `json:"name,omitempty"`
 
 	// FunctionID attaches function to this input. Functions on inputs can modify
@@ -60,9 +301,11 @@ type InputSpec struct {
 	FunctionID string `json:"functionId,omitempty"`
 
 	// Static response configuration
-	ResponseHeaders    map[string][]string `json:"responseHeaders,omitempty"`
-	ResponseStatusCode int                 `json:"responseStatusCode,omitempty"`
-	ResponseBody       string              `json:"responseBody,omitempty"`
+	ResponseHeaders map[string][]string `json:"responseHeaders,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=599
+	ResponseStatusCode int    `json:"responseStatusCode,omitempty"`
+	ResponseBody       string `json:"responseBody,omitempty"`
 
 	// Dynamic response configuration
 	// either output name, ID or "anyOutput" to indicate that the first response
@@ -76,6 +319,7 @@ type InputSpec struct {
 	// functionality where calls from:
 	// petshop.com/dogs -> are forwarded to [dogs store]
 	// petshop.com/cats -> are forwarded to [cats store]
+	// +kubebuilder:validation:Pattern=`^/`
 	PathPrefix string `json:"pathPrefix,omitempty"`
 
 	// Description can be any string
@@ -85,6 +329,7 @@ type InputSpec struct {
 // OutputSpec defines and output that belong to a bucket. Outputs are destinations
 // where webhooks/API requests are forwarded.
 type OutputSpec struct {
+	// +kubebuilder:validation:MinLength=1
 	Name string `json:"name,omitempty"`
 
 	// FunctionID attaches function to this output. Functions on output can modify
@@ -96,6 +341,7 @@ type OutputSpec struct {
 
 	// Destination is a URL that specifies where to send the webhooks. For example it can be
 	// http://local-jenkins/ghpr for Jenkins webhooks or any other URL.
+	// +kubebuilder:validation:MinLength=1
 	Destination string `json:"destination"`
 
 	// Internal specifies whether webhook should be sent to an internal destination. Since
@@ -103,6 +349,7 @@ type OutputSpec struct {
 	Internal *bool `json:"internal,omitempty"`
 
 	// Timeout specifies how long agent should wait for the response
+	// +kubebuilder:validation:Minimum=0
 	Timeout int `json:"timeout,omitempty"`
 
 	// Description can be any string
@@ -117,7 +364,12 @@ const (
 	AgentStatusInitial     AgentStatus = ""
 	AgentStatusRunning     AgentStatus = "Running"
 	AgentStatusCreating    AgentStatus = "Creating"
-	AgentStatusTerminating AgentStatus = "Terminating" // TODO: needs finalizer
+	AgentStatusTerminating AgentStatus = "Terminating"
+	// AgentStatusProgressing - deployment is rolling out, some of the
+	// agents might not be updated or available yet
+	AgentStatusProgressing AgentStatus = "Progressing"
+	// AgentStatusDegraded - rollout has stalled or agent pods are failing
+	AgentStatusDegraded AgentStatus = "Degraded"
 )
 
 // RoutingStatus is configuration status
@@ -127,6 +379,8 @@ type RoutingStatus string
 const (
 	RoutingStatusConfigured RoutingStatus = "Configured"
 	RoutingStatusFailed     RoutingStatus = "Failed"
+	// RoutingStatusPlanned - CR is in Plan mode, planned changes are in the status
+	RoutingStatusPlanned RoutingStatus = "Planned"
 )
 
 // WebhookRelayForwardStatus defines the observed state of WebhookRelayForward
@@ -138,7 +392,7 @@ type WebhookRelayForwardStatus struct {
 
 	// AgentStatus indicates agent deployment status
 	AgentStatus AgentStatus `json:"agentStatus,omitempty"`
-	// Ready indicates whether agent is deployed
+	// Ready indicates whether at least one agent pod is available
 	Ready bool `json:"ready,omitempty"`
 
 	RoutingStatus RoutingStatus `json:"routingStatus,omitempty"`
@@ -146,13 +400,134 @@ type WebhookRelayForwardStatus struct {
 	// PublicEndpoints are all input public endpoints from the buckets
 	// defined in the spec
 	PublicEndpoints []string `json:"publicEndpoints,omitempty"`
+
+	// Buckets shows synchronization state of every bucket defined in the spec
+	// together with its inputs and outputs
+	Buckets []BucketStatus `json:"buckets,omitempty"`
+
+	// ObservedGeneration is the most recent CR generation observed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the CR state
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// Drift reports buckets, inputs and outputs that were changed outside of the
+	// operator (i.e. in the web UI) and changed back to match the spec
+	Drift *DriftStatus `json:"drift,omitempty"`
+
+	// Plan lists routing changes that will be made once the mode is switched
+	// to Apply, only set in Plan mode
+	Plan *RoutingPlan `json:"plan,omitempty"`
+}
+
+// RoutingPlan is the list of changes planned for the current spec
+type RoutingPlan struct {
+	// ObservedGeneration is the CR generation the plan was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Summary of the planned changes, i.e. "2 to create, 1 to update, 0 to delete"
+	Summary string `json:"summary,omitempty"`
+	// Actions that will be performed
+	Actions []PlannedAction `json:"actions,omitempty"`
+}
+
+// PlannedAction is a single change to a bucket, input or output
+type PlannedAction struct {
+	// Action is one of: Create, Update, Delete
+	Action string `json:"action"`
+	// Kind of the object: Bucket, Input or Output
+	Kind string `json:"kind"`
+	// Bucket name
+	Bucket string `json:"bucket"`
+	// Name of the input or output, empty for buckets
+	Name string `json:"name,omitempty"`
+	// Fields that will be updated
+	Fields []string `json:"fields,omitempty"`
+}
+
+// DriftStatus summarises the last detected out-of-band changes
+type DriftStatus struct {
+	// LastDetectedTime is when changes made outside of the operator were last detected
+	LastDetectedTime *metav1.Time `json:"lastDetectedTime,omitempty"`
+	// Corrections is the total number of changes that were changed back
+	Corrections int64 `json:"corrections,omitempty"`
+	// Changes detected during the last time
+	Changes []DriftChange `json:"changes,omitempty"`
+}
+
+// DriftChange describes a bucket, input or output that didn't match the spec
+type DriftChange struct {
+	// Kind of the object: Bucket, Input or Output
+	Kind string `json:"kind"`
+	// Bucket name
+	Bucket string `json:"bucket"`
+	// Name of the input or output, empty for buckets
+	Name string `json:"name,omitempty"`
+	// Fields of the spec that didn't match
+	Fields []string `json:"fields"`
+}
+
+// SyncState is the synchronization state of a bucket, input or output
+type SyncState string
+
+// Available synchronization states
+const (
+	// SyncStateSynced - object matches the spec
+	SyncStateSynced SyncState = "Synced"
+	// SyncStateFailed - operator failed to create or update the object, check the last error
+	SyncStateFailed SyncState = "Failed"
+	// SyncStatePending - object will be configured during one of the next reconciles
+	SyncStatePending SyncState = "Pending"
+	// SyncStateUnmanaged - object is not managed by this CR
+	SyncStateUnmanaged SyncState = "Unmanaged"
+)
+
+// BucketStatus is the observed state of a bucket defined in the spec
+type BucketStatus struct {
+	// Name of the bucket
+	Name string `json:"name"`
+	// ID is the bucket ID on the Webhook Relay side
+	ID        string    `json:"id,omitempty"`
+	State     SyncState `json:"state,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+
+	Inputs  []InputStatus  `json:"inputs,omitempty"`
+	Outputs []OutputStatus `json:"outputs,omitempty"`
+}
+
+// InputStatus is the observed state of an input defined in the spec
+type InputStatus struct {
+	// Name of the input
+	Name string `json:"name"`
+	// ID is the input ID on the Webhook Relay side
+	ID string `json:"id,omitempty"`
+	// EndpointURL is the public endpoint of the input
+	EndpointURL string    `json:"endpointURL,omitempty"`
+	State       SyncState `json:"state,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// OutputStatus is the observed state of an output defined in the spec
+type OutputStatus struct {
+	// Name of the output
+	Name string `json:"name"`
+	// ID is the output ID on the Webhook Relay side
+	ID string `json:"id,omitempty"`
+	// Destination where the webhooks are forwarded
+	Destination string    `json:"destination,omitempty"`
+	State       SyncState `json:"state,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // WebhookRelayForward is the Schema for the webhookrelayforwards API
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Agent",type="string",JSONPath=".status.agentStatus"
+// +kubebuilder:printcolumn:name="Routing",type="string",JSONPath=".status.routingStatus"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:resource:path=webhookrelayforwards,scope=Namespaced
+// +kubebuilder:storageversion
 type WebhookRelayForward struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
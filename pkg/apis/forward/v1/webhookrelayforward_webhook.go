@@ -0,0 +1,181 @@
+package v1
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// ResponseFromAnyOutput can be used as InputSpec.ResponseFromOutput to return
+// the first response from any of the bucket outputs
+const ResponseFromAnyOutput = "anyOutput"
+
+// outputIDRegexp matches Webhook Relay output IDs, outputs can be referenced by
+// ID from the inputs even if they are not defined in the CR
+var outputIDRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// SetupWebhookWithManager registers WebhookRelayForward admission webhooks with the manager,
+// conversion webhook is registered too as other API versions are converted to and from v1
+func (in *WebhookRelayForward) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-forward-webhookrelay-com-v1-webhookrelayforward,mutating=false,failurePolicy=fail,groups=forward.webhookrelay.com,resources=webhookrelayforwards,verbs=create;update,versions=v1,name=vwebhookrelayforward.forward.webhookrelay.com
+
+var _ webhook.Validator = &WebhookRelayForward{}
+
+// ValidateCreate rejects CRs with an invalid spec
+func (in *WebhookRelayForward) ValidateCreate() error {
+	return in.validate()
+}
+
+// ValidateUpdate rejects spec updates that are invalid. CRs that are being deleted
+// and updates that don't change the spec (status, finalizers, labels) are always
+// allowed, so CRs created before a validation rule was added can still be removed.
+func (in *WebhookRelayForward) ValidateUpdate(old runtime.Object) error {
+	if in.DeletionTimestamp != nil {
+		return nil
+	}
+	if oldCR, ok := old.(*WebhookRelayForward); ok && apiequality.Semantic.DeepEqual(oldCR.Spec, in.Spec) {
+		return nil
+	}
+	return in.validate()
+}
+
+// ValidateDelete allows deleting any CR
+func (in *WebhookRelayForward) ValidateDelete() error {
+	return nil
+}
+
+func (in *WebhookRelayForward) validate() error {
+	errs := in.Spec.Validate(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(SchemeGroupVersion.WithKind("WebhookRelayForward").GroupKind(), in.Name, errs)
+}
+
+// Validate checks the spec for errors that can be found without calling the
+// Webhook Relay API
+func (spec *WebhookRelayForwardSpec) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if spec.SecretRefNamespace != "" && spec.SecretRefName == "" {
+		errs = append(errs, field.Required(path.Child("secretRefName"), "must be set when secretRefNamespace is set"))
+	}
+	if spec.AccountRef != nil {
+		if spec.AccountRef.Name == "" {
+			errs = append(errs, field.Required(path.Child("accountRef", "name"), ""))
+		}
+		if spec.SecretRefName != "" {
+			errs = append(errs, field.Forbidden(path.Child("accountRef"), "cannot be set together with secretRefName"))
+		}
+	}
+
+	if len(spec.Buckets) == 0 {
+		errs = append(errs, field.Required(path.Child("buckets"), "at least one bucket is required"))
+	}
+	buckets := make(map[string]bool)
+	for i := range spec.Buckets {
+		bucketPath := path.Child("buckets").Index(i)
+		name := spec.Buckets[i].Name
+		if name != "" && buckets[name] {
+			errs = append(errs, field.Duplicate(bucketPath.Child("name"), name))
+		}
+		buckets[name] = true
+		errs = append(errs, spec.Buckets[i].Validate(bucketPath)...)
+	}
+
+	return errs
+}
+
+// Validate checks the bucket together with its inputs and outputs
+func (b *BucketSpec) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if b.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+
+	if b.Auth != nil && (b.Auth.Type == BucketAuthTypeBasic || b.Auth.Type == BucketAuthTypeToken) && b.Auth.SecretRefName == "" {
+		errs = append(errs, field.Required(path.Child("auth", "secretRefName"),
+			fmt.Sprintf("secret with credentials is required for '%s' authentication", b.Auth.Type)))
+	}
+
+	outputs := make(map[string]bool)
+	for i := range b.Outputs {
+		outputPath := path.Child("outputs").Index(i)
+		output := &b.Outputs[i]
+		switch {
+		case output.Name == "":
+			errs = append(errs, field.Required(outputPath.Child("name"), ""))
+		case outputs[output.Name]:
+			errs = append(errs, field.Duplicate(outputPath.Child("name"), output.Name))
+		}
+		outputs[output.Name] = true
+
+		if output.Destination == "" {
+			errs = append(errs, field.Required(outputPath.Child("destination"), ""))
+		} else if err := validateDestination(output.Destination); err != "" {
+			errs = append(errs, field.Invalid(outputPath.Child("destination"), output.Destination, err))
+		}
+		if output.Timeout < 0 {
+			errs = append(errs, field.Invalid(outputPath.Child("timeout"), output.Timeout, "must not be negative"))
+		}
+	}
+
+	inputs := make(map[string]bool)
+	for i := range b.Inputs {
+		inputPath := path.Child("inputs").Index(i)
+		input := &b.Inputs[i]
+		switch {
+		case input.Name == "":
+			errs = append(errs, field.Required(inputPath.Child("name"), ""))
+		case inputs[input.Name]:
+			errs = append(errs, field.Duplicate(inputPath.Child("name"), input.Name))
+		}
+		inputs[input.Name] = true
+
+		if ref := input.ResponseFromOutput; ref != "" && ref != ResponseFromAnyOutput && !outputs[ref] && !outputIDRegexp.MatchString(ref) {
+			errs = append(errs, field.NotFound(inputPath.Child("responseFromOutput"), ref))
+		}
+		if input.ResponseStatusCode != 0 && (input.ResponseStatusCode < 100 || input.ResponseStatusCode > 599) {
+			errs = append(errs, field.Invalid(inputPath.Child("responseStatusCode"), input.ResponseStatusCode, "must be a valid HTTP status code"))
+		}
+		if input.CustomDomain != nil && *input.CustomDomain != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(*input.CustomDomain) {
+				errs = append(errs, field.Invalid(inputPath.Child("customDomain"), *input.CustomDomain, msg))
+			}
+		}
+		if input.PathPrefix != "" && input.PathPrefix[0] != '/' {
+			errs = append(errs, field.Invalid(inputPath.Child("pathPrefix"), input.PathPrefix, "must start with '/'"))
+		}
+	}
+
+	return errs
+}
+
+// validateDestination returns an error message if destination is not an http(s) URL
+func validateDestination(destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return err.Error()
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "must be an http or https URL"
+	}
+	if u.Host == "" {
+		return "must have a host"
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestWebhookRelayForwardSpec_Validate(t *testing.T) {
+	spec := &WebhookRelayForwardSpec{
+		Buckets: []BucketSpec{
+			{
+				Name: "b-1",
+				Inputs: []InputSpec{
+					{Name: "in", ResponseFromOutput: "out"},
+					{Name: "in", ResponseFromOutput: "missing"},
+					{Name: "by-id", ResponseFromOutput: "0d4c5b6e-7a2f-4a8b-9c3d-1e2f3a4b5c6d", PathPrefix: "dogs"},
+				},
+				Outputs: []OutputSpec{
+					{Name: "out", Destination: "http://svc:8080/webhooks"},
+					{Name: "no-destination"},
+					{Name: "bad-url", Destination: "svc:8080"},
+				},
+			},
+			{Name: "b-1", Auth: &BucketAuth{Type: BucketAuthTypeBasic}},
+		},
+	}
+
+	var got []string
+	for _, err := range spec.Validate(field.NewPath("spec")) {
+		got = append(got, err.Field+": "+string(err.Type))
+	}
+
+	assert.DeepEqual(t, []string{
+		"spec.buckets[0].outputs[1].destination: FieldValueRequired",
+		"spec.buckets[0].outputs[2].destination: FieldValueInvalid",
+		"spec.buckets[0].inputs[1].name: FieldValueDuplicate",
+		"spec.buckets[0].inputs[1].responseFromOutput: FieldValueNotFound",
+		"spec.buckets[0].inputs[2].pathPrefix: FieldValueInvalid",
+		"spec.buckets[1].name: FieldValueDuplicate",
+		"spec.buckets[1].auth.secretRefName: FieldValueRequired",
+	}, got)
+}
+
+func TestWebhookRelayForward_ValidateCreate(t *testing.T) {
+	cr := &WebhookRelayForward{
+		Spec: WebhookRelayForwardSpec{
+			Buckets: []BucketSpec{{
+				Name:    "b-1",
+				Outputs: []OutputSpec{{Name: "out", Destination: "https://example.com"}},
+				Inputs:  []InputSpec{{Name: "in", ResponseFromOutput: ResponseFromAnyOutput}},
+			}},
+		},
+	}
+	assert.NilError(t, cr.ValidateCreate())
+
+	cr.Spec.Buckets = nil
+	assert.ErrorContains(t, cr.ValidateCreate(), "spec.buckets: Required value")
+
+	cr.Spec.SecretRefName = "whr-credentials"
+	cr.Spec.AccountRef = &AccountReference{Name: "shared"}
+	assert.ErrorContains(t, cr.ValidateCreate(), "spec.accountRef: Forbidden: cannot be set together with secretRefName")
+}
+
+func TestWebhookRelayForward_ValidateUpdate(t *testing.T) {
+	// CR created before validation was enabled
+	old := &WebhookRelayForward{
+		Spec: WebhookRelayForwardSpec{
+			Buckets: []BucketSpec{{
+				Name:    "b-1",
+				Outputs: []OutputSpec{{Name: "out", Destination: "svc:8080"}},
+			}},
+		},
+	}
+
+	// metadata and status updates are allowed
+	cr := old.DeepCopy()
+	cr.Finalizers = []string{"finalizer.webhookrelayforward.forward.webhookrelay.com"}
+	cr.Status.RoutingStatus = RoutingStatusFailed
+	assert.NilError(t, cr.ValidateUpdate(old))
+
+	// spec changes are validated
+	cr.Spec.Buckets[0].Outputs = append(cr.Spec.Buckets[0].Outputs, OutputSpec{Name: "out-2", Destination: "https://example.com"})
+	assert.ErrorContains(t, cr.ValidateUpdate(old), "spec.buckets[0].outputs[0].destination")
+
+	// CRs that are being deleted are not validated
+	now := metav1.Now()
+	cr.DeletionTimestamp = &now
+	assert.NilError(t, cr.ValidateUpdate(old))
+}
@@ -0,0 +1,66 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookRelayInputSpec defines the desired state of WebhookRelayInput. Input name
+// defaults to the CR name.
+type WebhookRelayInputSpec struct {
+	// BucketRef is the WebhookRelayBucket in the same namespace that the input belongs to
+	BucketRef corev1.LocalObjectReference `json:"bucketRef"`
+
+	InputSpec `json:",inline"`
+
+	// DeletionPolicy controls what happens to the input when this CR is deleted. "Retain"
+	// (default) leaves it untouched so the public endpoint keeps its ID, "Delete" removes it.
+	// +kubebuilder:validation:Enum=Retain;Delete
+	DeletionPolicy RoutingObjectDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// WebhookRelayInputStatus defines the observed state of WebhookRelayInput
+type WebhookRelayInputStatus struct {
+	RoutingObjectStatus `json:",inline"`
+
+	// EndpointURL is the public endpoint of the input
+	EndpointURL string `json:"endpointURL,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayInput is a public endpoint of a WebhookRelayBucket
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Bucket",type="string",JSONPath=".spec.bucketRef.name"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.endpointURL"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:path=webhookrelayinputs,scope=Namespaced
+type WebhookRelayInput struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WebhookRelayInputSpec   `json:"spec,omitempty"`
+	Status WebhookRelayInputStatus `json:"status,omitempty"`
+}
+
+// InputName returns the name of the input on the Webhook Relay side
+func (in *WebhookRelayInput) InputName() string {
+	if in.Spec.Name != "" {
+		return in.Spec.Name
+	}
+	return in.GetName()
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayInputList contains a list of WebhookRelayInput
+type WebhookRelayInputList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WebhookRelayInput `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WebhookRelayInput{}, &WebhookRelayInputList{})
+}
@@ -0,0 +1,63 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookRelayOutputSpec defines the desired state of WebhookRelayOutput. Output name
+// defaults to the CR name.
+type WebhookRelayOutputSpec struct {
+	// BucketRef is the WebhookRelayBucket in the same namespace that the output belongs to
+	BucketRef corev1.LocalObjectReference `json:"bucketRef"`
+
+	OutputSpec `json:",inline"`
+
+	// DeletionPolicy controls what happens to the output when this CR is deleted. "Retain"
+	// leaves it untouched, "Delete" (default) removes it so webhooks are no longer forwarded.
+	// +kubebuilder:validation:Enum=Retain;Delete
+	DeletionPolicy RoutingObjectDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// WebhookRelayOutputStatus defines the observed state of WebhookRelayOutput
+type WebhookRelayOutputStatus struct {
+	RoutingObjectStatus `json:",inline"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayOutput is a forwarding destination of a WebhookRelayBucket
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Bucket",type="string",JSONPath=".spec.bucketRef.name"
+// +kubebuilder:printcolumn:name="Destination",type="string",JSONPath=".spec.destination"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:path=webhookrelayoutputs,scope=Namespaced
+type WebhookRelayOutput struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WebhookRelayOutputSpec   `json:"spec,omitempty"`
+	Status WebhookRelayOutputStatus `json:"status,omitempty"`
+}
+
+// OutputName returns the name of the output on the Webhook Relay side
+func (in *WebhookRelayOutput) OutputName() string {
+	if in.Spec.Name != "" {
+		return in.Spec.Name
+	}
+	return in.GetName()
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookRelayOutputList contains a list of WebhookRelayOutput
+type WebhookRelayOutputList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WebhookRelayOutput `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WebhookRelayOutput{}, &WebhookRelayOutputList{})
+}
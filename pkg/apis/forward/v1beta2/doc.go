@@ -0,0 +1,4 @@
+// Package v1beta2 contains API Schema definitions for the forward v1beta2 API group
+// +k8s:deepcopy-gen=package,register
+// +groupName=forward.webhookrelay.com
+package v1beta2
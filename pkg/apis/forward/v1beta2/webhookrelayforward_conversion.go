@@ -0,0 +1,522 @@
+package v1beta2
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// ResourcesAnnotation keeps v1 spec.resources when the CR is converted to v1beta2. The
+// deprecated field is folded into agent.resources and would otherwise be lost when the
+// CR is converted back.
+const ResourcesAnnotation = "forward.webhookrelay.com/v1-resources"
+
+var _ conversion.Convertible = &WebhookRelayForward{}
+
+// ConvertTo converts this WebhookRelayForward to the hub version (v1)
+func (in *WebhookRelayForward) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*forwardv1.WebhookRelayForward)
+	src := in.DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	resources, err := popResourcesAnnotation(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
+	spec := &src.Spec
+	dst.Spec = forwardv1.WebhookRelayForwardSpec{
+		Buckets:        convertBucketsTo(spec.Buckets),
+		DeletionPolicy: forwardv1.DeletionPolicy(spec.DeletionPolicy),
+		Mode:           forwardv1.RoutingMode(spec.Mode),
+	}
+	if c := spec.Credentials; c != nil {
+		if c.SecretRef != nil {
+			dst.Spec.SecretRefName = c.SecretRef.Name
+			dst.Spec.SecretRefNamespace = c.SecretRef.Namespace
+		}
+		if c.AccountRef != nil {
+			dst.Spec.AccountRef = &forwardv1.AccountReference{Name: c.AccountRef.Name}
+		}
+		if c.AgentToken != nil {
+			dst.Spec.AgentToken = &forwardv1.AgentTokenSpec{
+				Provision:      c.AgentToken.Provision,
+				RotationPeriod: c.AgentToken.RotationPeriod,
+			}
+		}
+	}
+	if spec.Agent != nil {
+		dst.Spec.Image = spec.Agent.Image
+		dst.Spec.Agent = convertAgentTo(spec.Agent)
+	}
+
+	// agent.resources that still match the deprecated field were copied from it,
+	// if agent.resources were removed the deprecated field is dropped too
+	if resources != nil && dst.Spec.Agent != nil && dst.Spec.Agent.Resources != nil {
+		dst.Spec.Resources = *resources
+		if apiequality.Semantic.DeepEqual(dst.Spec.Agent.Resources, resources) {
+			dst.Spec.Agent.Resources = nil
+		}
+	}
+	if dst.Spec.Agent != nil && apiequality.Semantic.DeepEqual(dst.Spec.Agent, &forwardv1.AgentSpec{}) {
+		dst.Spec.Agent = nil
+	}
+
+	dst.Status = convertStatusTo(&src.Status)
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1) to this version
+func (in *WebhookRelayForward) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*forwardv1.WebhookRelayForward).DeepCopy()
+
+	in.ObjectMeta = src.ObjectMeta
+	delete(in.Annotations, ResourcesAnnotation)
+
+	spec := &src.Spec
+	in.Spec = WebhookRelayForwardSpec{
+		Buckets:        convertBucketsFrom(spec.Buckets),
+		DeletionPolicy: DeletionPolicy(spec.DeletionPolicy),
+		Mode:           RoutingMode(spec.Mode),
+	}
+	if spec.SecretRefName != "" || spec.SecretRefNamespace != "" || spec.AccountRef != nil || spec.AgentToken != nil {
+		in.Spec.Credentials = &CredentialsSpec{}
+		if spec.SecretRefName != "" || spec.SecretRefNamespace != "" {
+			in.Spec.Credentials.SecretRef = &SecretReference{
+				Name:      spec.SecretRefName,
+				Namespace: spec.SecretRefNamespace,
+			}
+		}
+		if spec.AccountRef != nil {
+			in.Spec.Credentials.AccountRef = &AccountReference{Name: spec.AccountRef.Name}
+		}
+		if spec.AgentToken != nil {
+			in.Spec.Credentials.AgentToken = &AgentTokenSpec{
+				Provision:      spec.AgentToken.Provision,
+				RotationPeriod: spec.AgentToken.RotationPeriod,
+			}
+		}
+	}
+
+	agent := convertAgentFrom(spec.Agent)
+	if spec.Image != "" {
+		if agent == nil {
+			agent = &AgentSpec{}
+		}
+		agent.Image = spec.Image
+	}
+	if len(spec.Resources.Limits) > 0 || len(spec.Resources.Requests) > 0 {
+		data, err := json.Marshal(spec.Resources)
+		if err != nil {
+			return fmt.Errorf("failed to encode resources: %w", err)
+		}
+		if in.Annotations == nil {
+			in.Annotations = make(map[string]string)
+		}
+		in.Annotations[ResourcesAnnotation] = string(data)
+
+		if agent == nil {
+			agent = &AgentSpec{}
+		}
+		// agent.resources take precedence over the deprecated field
+		if agent.Resources == nil {
+			agent.Resources = &spec.Resources
+		}
+	}
+	in.Spec.Agent = agent
+
+	in.Status = convertStatusFrom(&src.Status)
+	return nil
+}
+
+// popResourcesAnnotation removes ResourcesAnnotation and returns the resources it holds
+func popResourcesAnnotation(meta *metav1.ObjectMeta) (*corev1.ResourceRequirements, error) {
+	data, ok := meta.Annotations[ResourcesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	delete(meta.Annotations, ResourcesAnnotation)
+
+	var resources corev1.ResourceRequirements
+	if err := json.Unmarshal([]byte(data), &resources); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ResourcesAnnotation, err)
+	}
+	return &resources, nil
+}
+
+func convertAgentTo(src *AgentSpec) *forwardv1.AgentSpec {
+	dst := &forwardv1.AgentSpec{
+		Replicas:                  src.Replicas,
+		TopologySpreadConstraints: src.TopologySpreadConstraints,
+		Resources:                 src.Resources,
+		ImagePullPolicy:           src.ImagePullPolicy,
+		ImagePullSecrets:          src.ImagePullSecrets,
+		ServiceAccountName:        src.ServiceAccountName,
+		NodeSelector:              src.NodeSelector,
+		Tolerations:               src.Tolerations,
+		Affinity:                  src.Affinity,
+		PriorityClassName:         src.PriorityClassName,
+		PodSecurityContext:        src.PodSecurityContext,
+		SecurityContext:           src.SecurityContext,
+		Env:                       src.Env,
+		Volumes:                   src.Volumes,
+		VolumeMounts:              src.VolumeMounts,
+		PodLabels:                 src.PodLabels,
+		PodAnnotations:            src.PodAnnotations,
+	}
+	if a := src.Autoscaling; a != nil {
+		dst.Autoscaling = &forwardv1.AgentAutoscalingSpec{
+			MinReplicas:                    a.MinReplicas,
+			MaxReplicas:                    a.MaxReplicas,
+			TargetCPUUtilizationPercentage: a.TargetCPUUtilizationPercentage,
+			Metrics:                        a.Metrics,
+		}
+	}
+	if pdb := src.PodDisruptionBudget; pdb != nil {
+		dst.PodDisruptionBudget = &forwardv1.AgentPodDisruptionBudgetSpec{
+			Disabled:       pdb.Disabled,
+			MinAvailable:   pdb.MinAvailable,
+			MaxUnavailable: pdb.MaxUnavailable,
+		}
+	}
+	if h := src.Health; h != nil {
+		dst.Health = &forwardv1.AgentHealthSpec{
+			Enabled:             h.Enabled,
+			Port:                h.Port,
+			LivenessPath:        h.LivenessPath,
+			ReadinessPath:       h.ReadinessPath,
+			InitialDelaySeconds: h.InitialDelaySeconds,
+			PeriodSeconds:       h.PeriodSeconds,
+			FailureThreshold:    h.FailureThreshold,
+		}
+	}
+	return dst
+}
+
+func convertAgentFrom(src *forwardv1.AgentSpec) *AgentSpec {
+	if src == nil {
+		return nil
+	}
+	dst := &AgentSpec{
+		Replicas:                  src.Replicas,
+		TopologySpreadConstraints: src.TopologySpreadConstraints,
+		Resources:                 src.Resources,
+		ImagePullPolicy:           src.ImagePullPolicy,
+		ImagePullSecrets:          src.ImagePullSecrets,
+		ServiceAccountName:        src.ServiceAccountName,
+		NodeSelector:              src.NodeSelector,
+		Tolerations:               src.Tolerations,
+		Affinity:                  src.Affinity,
+		PriorityClassName:         src.PriorityClassName,
+		PodSecurityContext:        src.PodSecurityContext,
+		SecurityContext:           src.SecurityContext,
+		Env:                       src.Env,
+		Volumes:                   src.Volumes,
+		VolumeMounts:              src.VolumeMounts,
+		PodLabels:                 src.PodLabels,
+		PodAnnotations:            src.PodAnnotations,
+	}
+	if a := src.Autoscaling; a != nil {
+		dst.Autoscaling = &AgentAutoscalingSpec{
+			MinReplicas:                    a.MinReplicas,
+			MaxReplicas:                    a.MaxReplicas,
+			TargetCPUUtilizationPercentage: a.TargetCPUUtilizationPercentage,
+			Metrics:                        a.Metrics,
+		}
+	}
+	if pdb := src.PodDisruptionBudget; pdb != nil {
+		dst.PodDisruptionBudget = &AgentPodDisruptionBudgetSpec{
+			Disabled:       pdb.Disabled,
+			MinAvailable:   pdb.MinAvailable,
+			MaxUnavailable: pdb.MaxUnavailable,
+		}
+	}
+	if h := src.Health; h != nil {
+		dst.Health = &AgentHealthSpec{
+			Enabled:             h.Enabled,
+			Port:                h.Port,
+			LivenessPath:        h.LivenessPath,
+			ReadinessPath:       h.ReadinessPath,
+			InitialDelaySeconds: h.InitialDelaySeconds,
+			PeriodSeconds:       h.PeriodSeconds,
+			FailureThreshold:    h.FailureThreshold,
+		}
+	}
+	return dst
+}
+
+func convertBucketsTo(src []BucketSpec) []forwardv1.BucketSpec {
+	if src == nil {
+		return nil
+	}
+	dst := make([]forwardv1.BucketSpec, len(src))
+	for i, b := range src {
+		dst[i] = forwardv1.BucketSpec{
+			Name:           b.Name,
+			Description:    b.Description,
+			AdoptionPolicy: forwardv1.AdoptionPolicy(b.AdoptionPolicy),
+		}
+		if b.Auth != nil {
+			dst[i].Auth = &forwardv1.BucketAuth{
+				Type:          forwardv1.BucketAuthType(b.Auth.Type),
+				SecretRefName: b.Auth.SecretRefName,
+			}
+		}
+		if b.Inputs != nil {
+			dst[i].Inputs = make([]forwardv1.InputSpec, len(b.Inputs))
+			for j, input := range b.Inputs {
+				dst[i].Inputs[j] = forwardv1.InputSpec{
+					Name:               input.Name,
+					FunctionID:         input.FunctionID,
+					ResponseHeaders:    input.ResponseHeaders,
+					ResponseStatusCode: input.ResponseStatusCode,
+					ResponseBody:       input.ResponseBody,
+					ResponseFromOutput: input.ResponseFromOutput,
+					CustomDomain:       input.CustomDomain,
+					PathPrefix:         input.PathPrefix,
+					Description:        input.Description,
+				}
+			}
+		}
+		if b.Outputs != nil {
+			dst[i].Outputs = make([]forwardv1.OutputSpec, len(b.Outputs))
+			for j, output := range b.Outputs {
+				dst[i].Outputs[j] = forwardv1.OutputSpec{
+					Name:            output.Name,
+					FunctionID:      output.FunctionID,
+					OverrideHeaders: output.OverrideHeaders,
+					Destination:     output.Destination,
+					Internal:        output.Internal,
+					Timeout:         output.Timeout,
+					Description:     output.Description,
+				}
+			}
+		}
+	}
+	return dst
+}
+
+func convertBucketsFrom(src []forwardv1.BucketSpec) []BucketSpec {
+	if src == nil {
+		return nil
+	}
+	dst := make([]BucketSpec, len(src))
+	for i, b := range src {
+		dst[i] = BucketSpec{
+			Name:           b.Name,
+			Description:    b.Description,
+			AdoptionPolicy: AdoptionPolicy(b.AdoptionPolicy),
+		}
+		if b.Auth != nil {
+			dst[i].Auth = &BucketAuth{
+				Type:          BucketAuthType(b.Auth.Type),
+				SecretRefName: b.Auth.SecretRefName,
+			}
+		}
+		if b.Inputs != nil {
+			dst[i].Inputs = make([]InputSpec, len(b.Inputs))
+			for j, input := range b.Inputs {
+				dst[i].Inputs[j] = InputSpec{
+					Name:               input.Name,
+					FunctionID:         input.FunctionID,
+					ResponseHeaders:    input.ResponseHeaders,
+					ResponseStatusCode: input.ResponseStatusCode,
+					ResponseBody:       input.ResponseBody,
+					ResponseFromOutput: input.ResponseFromOutput,
+					CustomDomain:       input.CustomDomain,
+					PathPrefix:         input.PathPrefix,
+					Description:        input.Description,
+				}
+			}
+		}
+		if b.Outputs != nil {
+			dst[i].Outputs = make([]OutputSpec, len(b.Outputs))
+			for j, output := range b.Outputs {
+				dst[i].Outputs[j] = OutputSpec{
+					Name:            output.Name,
+					FunctionID:      output.FunctionID,
+					OverrideHeaders: output.OverrideHeaders,
+					Destination:     output.Destination,
+					Internal:        output.Internal,
+					Timeout:         output.Timeout,
+					Description:     output.Description,
+				}
+			}
+		}
+	}
+	return dst
+}
+
+func convertStatusTo(src *WebhookRelayForwardStatus) forwardv1.WebhookRelayForwardStatus {
+	dst := forwardv1.WebhookRelayForwardStatus{
+		AgentStatus:        forwardv1.AgentStatus(src.AgentStatus),
+		Ready:              src.Ready,
+		RoutingStatus:      forwardv1.RoutingStatus(src.RoutingStatus),
+		Message:            src.Message,
+		PublicEndpoints:    src.PublicEndpoints,
+		ObservedGeneration: src.ObservedGeneration,
+	}
+	if src.Buckets != nil {
+		dst.Buckets = make([]forwardv1.BucketStatus, len(src.Buckets))
+		for i, b := range src.Buckets {
+			dst.Buckets[i] = forwardv1.BucketStatus{
+				Name:      b.Name,
+				ID:        b.ID,
+				State:     forwardv1.SyncState(b.State),
+				LastError: b.LastError,
+			}
+			if b.Inputs != nil {
+				dst.Buckets[i].Inputs = make([]forwardv1.InputStatus, len(b.Inputs))
+				for j, input := range b.Inputs {
+					dst.Buckets[i].Inputs[j] = forwardv1.InputStatus{
+						Name:        input.Name,
+						ID:          input.ID,
+						EndpointURL: input.EndpointURL,
+						State:       forwardv1.SyncState(input.State),
+						LastError:   input.LastError,
+					}
+				}
+			}
+			if b.Outputs != nil {
+				dst.Buckets[i].Outputs = make([]forwardv1.OutputStatus, len(b.Outputs))
+				for j, output := range b.Outputs {
+					dst.Buckets[i].Outputs[j] = forwardv1.OutputStatus{
+						Name:        output.Name,
+						ID:          output.ID,
+						Destination: output.Destination,
+						State:       forwardv1.SyncState(output.State),
+						LastError:   output.LastError,
+					}
+				}
+			}
+		}
+	}
+	if src.Conditions != nil {
+		dst.Conditions = make([]forwardv1.Condition, len(src.Conditions))
+		for i, c := range src.Conditions {
+			dst.Conditions[i] = forwardv1.Condition{
+				Type:               forwardv1.ConditionType(c.Type),
+				Status:             c.Status,
+				ObservedGeneration: c.ObservedGeneration,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	if d := src.Drift; d != nil {
+		dst.Drift = &forwardv1.DriftStatus{
+			LastDetectedTime: d.LastDetectedTime,
+			Corrections:      d.Corrections,
+		}
+		if d.Changes != nil {
+			dst.Drift.Changes = make([]forwardv1.DriftChange, len(d.Changes))
+			for i, c := range d.Changes {
+				dst.Drift.Changes[i] = forwardv1.DriftChange{Kind: c.Kind, Bucket: c.Bucket, Name: c.Name, Fields: c.Fields}
+			}
+		}
+	}
+	if p := src.Plan; p != nil {
+		dst.Plan = &forwardv1.RoutingPlan{
+			ObservedGeneration: p.ObservedGeneration,
+			Summary:            p.Summary,
+		}
+		if p.Actions != nil {
+			dst.Plan.Actions = make([]forwardv1.PlannedAction, len(p.Actions))
+			for i, a := range p.Actions {
+				dst.Plan.Actions[i] = forwardv1.PlannedAction{Action: a.Action, Kind: a.Kind, Bucket: a.Bucket, Name: a.Name, Fields: a.Fields}
+			}
+		}
+	}
+	return dst
+}
+
+func convertStatusFrom(src *forwardv1.WebhookRelayForwardStatus) WebhookRelayForwardStatus {
+	dst := WebhookRelayForwardStatus{
+		AgentStatus:        AgentStatus(src.AgentStatus),
+		Ready:              src.Ready,
+		RoutingStatus:      RoutingStatus(src.RoutingStatus),
+		Message:            src.Message,
+		PublicEndpoints:    src.PublicEndpoints,
+		ObservedGeneration: src.ObservedGeneration,
+	}
+	if src.Buckets != nil {
+		dst.Buckets = make([]BucketStatus, len(src.Buckets))
+		for i, b := range src.Buckets {
+			dst.Buckets[i] = BucketStatus{
+				Name:      b.Name,
+				ID:        b.ID,
+				State:     SyncState(b.State),
+				LastError: b.LastError,
+			}
+			if b.Inputs != nil {
+				dst.Buckets[i].Inputs = make([]InputStatus, len(b.Inputs))
+				for j, input := range b.Inputs {
+					dst.Buckets[i].Inputs[j] = InputStatus{
+						Name:        input.Name,
+						ID:          input.ID,
+						EndpointURL: input.EndpointURL,
+						State:       SyncState(input.State),
+						LastError:   input.LastError,
+					}
+				}
+			}
+			if b.Outputs != nil {
+				dst.Buckets[i].Outputs = make([]OutputStatus, len(b.Outputs))
+				for j, output := range b.Outputs {
+					dst.Buckets[i].Outputs[j] = OutputStatus{
+						Name:        output.Name,
+						ID:          output.ID,
+						Destination: output.Destination,
+						State:       SyncState(output.State),
+						LastError:   output.LastError,
+					}
+				}
+			}
+		}
+	}
+	if src.Conditions != nil {
+		dst.Conditions = make([]Condition, len(src.Conditions))
+		for i, c := range src.Conditions {
+			dst.Conditions[i] = Condition{
+				Type:               ConditionType(c.Type),
+				Status:             c.Status,
+				ObservedGeneration: c.ObservedGeneration,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	if d := src.Drift; d != nil {
+		dst.Drift = &DriftStatus{
+			LastDetectedTime: d.LastDetectedTime,
+			Corrections:      d.Corrections,
+		}
+		if d.Changes != nil {
+			dst.Drift.Changes = make([]DriftChange, len(d.Changes))
+			for i, c := range d.Changes {
+				dst.Drift.Changes[i] = DriftChange{Kind: c.Kind, Bucket: c.Bucket, Name: c.Name, Fields: c.Fields}
+			}
+		}
+	}
+	if p := src.Plan; p != nil {
+		dst.Plan = &RoutingPlan{
+			ObservedGeneration: p.ObservedGeneration,
+			Summary:            p.Summary,
+		}
+		if p.Actions != nil {
+			dst.Plan.Actions = make([]PlannedAction, len(p.Actions))
+			for i, a := range p.Actions {
+				dst.Plan.Actions[i] = PlannedAction{Action: a.Action, Kind: a.Kind, Bucket: a.Bucket, Name: a.Name, Fields: a.Fields}
+			}
+		}
+	}
+	return dst
+}
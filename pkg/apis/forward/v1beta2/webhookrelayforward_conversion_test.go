@@ -0,0 +1,153 @@
+package v1beta2
+
+import (
+	"math/rand"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+const fuzzIterations = 500
+
+// newFuzzer returns a fuzzer that doesn't generate empty structs in place of nil
+// pointers where both mean the same thing and can't survive the conversion
+func newFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).NumElements(0, 2).RandSource(rand.NewSource(seed)).Funcs(
+		func(s *forwardv1.WebhookRelayForwardSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			if s.Agent != nil && apiequality.Semantic.DeepEqual(s.Agent, &forwardv1.AgentSpec{}) {
+				s.Agent = nil
+			}
+		},
+		func(s *WebhookRelayForwardSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			if s.Credentials != nil && s.Credentials.SecretRef != nil && *s.Credentials.SecretRef == (SecretReference{}) {
+				s.Credentials.SecretRef = nil
+			}
+			if s.Credentials != nil && *s.Credentials == (CredentialsSpec{}) {
+				s.Credentials = nil
+			}
+			if s.Agent != nil && apiequality.Semantic.DeepEqual(s.Agent, &AgentSpec{}) {
+				s.Agent = nil
+			}
+		},
+		// unexported fields of quantities and times are not fuzzed
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1000), resource.DecimalSI)
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+	)
+}
+
+func TestFuzzyConversionFromHub(t *testing.T) {
+	f := newFuzzer(1)
+	for i := 0; i < fuzzIterations; i++ {
+		hub := &forwardv1.WebhookRelayForward{}
+		f.Fuzz(hub)
+
+		spoke := &WebhookRelayForward{}
+		assert.NilError(t, spoke.ConvertFrom(hub))
+		restored := &forwardv1.WebhookRelayForward{}
+		assert.NilError(t, spoke.ConvertTo(restored))
+
+		if !apiequality.Semantic.DeepEqual(hub.ObjectMeta, restored.ObjectMeta) || !apiequality.Semantic.DeepEqual(hub.Spec, restored.Spec) ||
+			!apiequality.Semantic.DeepEqual(hub.Status, restored.Status) {
+			t.Fatalf("v1 -> v1beta2 -> v1 changed the object: %s", diff.ObjectReflectDiff(hub, restored))
+		}
+	}
+}
+
+func TestFuzzyConversionToHub(t *testing.T) {
+	f := newFuzzer(2)
+	for i := 0; i < fuzzIterations; i++ {
+		spoke := &WebhookRelayForward{}
+		f.Fuzz(spoke)
+		delete(spoke.Annotations, ResourcesAnnotation)
+
+		hub := &forwardv1.WebhookRelayForward{}
+		assert.NilError(t, spoke.ConvertTo(hub))
+		restored := &WebhookRelayForward{}
+		assert.NilError(t, restored.ConvertFrom(hub))
+
+		if !apiequality.Semantic.DeepEqual(spoke.ObjectMeta, restored.ObjectMeta) || !apiequality.Semantic.DeepEqual(spoke.Spec, restored.Spec) ||
+			!apiequality.Semantic.DeepEqual(spoke.Status, restored.Status) {
+			t.Fatalf("v1beta2 -> v1 -> v1beta2 changed the object: %s", diff.ObjectReflectDiff(spoke, restored))
+		}
+	}
+}
+
+func TestConvertFromHub(t *testing.T) {
+	hub := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "cr", Namespace: "default"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			SecretRefName:      "whr-credentials",
+			SecretRefNamespace: "secrets",
+			Image:              "webhookrelay/webhookrelayd:1.0.0",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			},
+			Buckets: []forwardv1.BucketSpec{{
+				Name:    "bucket",
+				Outputs: []forwardv1.OutputSpec{{Name: "out", FunctionID: "fn", Destination: "http://svc"}},
+			}},
+		},
+	}
+
+	spoke := &WebhookRelayForward{}
+	assert.NilError(t, spoke.ConvertFrom(hub))
+
+	assert.DeepEqual(t, spoke.Spec.Credentials, &CredentialsSpec{
+		SecretRef: &SecretReference{Name: "whr-credentials", Namespace: "secrets"},
+	})
+	assert.Equal(t, spoke.Spec.Agent.Image, "webhookrelay/webhookrelayd:1.0.0")
+	assert.Equal(t, spoke.Spec.Agent.Resources.Limits.Cpu().String(), "100m")
+	assert.Equal(t, spoke.Spec.Buckets[0].Outputs[0].FunctionID, "fn")
+	assert.Assert(t, spoke.Annotations[ResourcesAnnotation] != "")
+	// hub object is not modified
+	assert.Equal(t, len(hub.Annotations), 0)
+}
+
+func TestConvertToHubRemovedAgentResources(t *testing.T) {
+	hub := &forwardv1.WebhookRelayForward{
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			},
+		},
+	}
+	spoke := &WebhookRelayForward{}
+	assert.NilError(t, spoke.ConvertFrom(hub))
+
+	// resources removed from the v1beta2 CR stay removed
+	spoke.Spec.Agent.Resources = nil
+
+	restored := &forwardv1.WebhookRelayForward{}
+	assert.NilError(t, spoke.ConvertTo(restored))
+	assert.Equal(t, len(restored.Spec.Resources.Limits), 0)
+	assert.Assert(t, restored.Spec.Agent == nil)
+	assert.Equal(t, len(restored.Annotations), 0)
+}
+
+func TestConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(scheme))
+	assert.NilError(t, SchemeBuilder.AddToScheme(scheme))
+
+	// conversion webhook is only registered when all versions can be converted
+	ok, err := conversion.IsConvertible(scheme, &forwardv1.WebhookRelayForward{})
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+}
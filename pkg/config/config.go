@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type (
 	// Config stores the configuration settings.
 	Config struct {
@@ -11,5 +13,27 @@ type (
 			Key    string `envconfig:"RELAY_KEY"`
 			Secret string `envconfig:"RELAY_SECRET"`
 		}
+
+		// ResyncPeriod - how often CRs are reconciled when nothing has changed, this
+		// picks up changes made to the buckets outside of the operator
+		ResyncPeriod time.Duration `envconfig:"RESYNC_PERIOD" default:"5m"`
+		// BackoffBase and BackoffMax configure per CR exponential backoff
+		// after failed reconciles
+		BackoffBase time.Duration `envconfig:"BACKOFF_BASE" default:"1s"`
+		BackoffMax  time.Duration `envconfig:"BACKOFF_MAX" default:"5m"`
+
+		// BucketsRefreshInterval - how long listed buckets are cached, CRs that use
+		// the same account share the cache
+		BucketsRefreshInterval time.Duration `envconfig:"BUCKETS_REFRESH_INTERVAL" default:"1m"`
+		// MaxConcurrentReconciles - how many CRs can be reconciled in parallel
+		MaxConcurrentReconciles int `envconfig:"MAX_CONCURRENT_RECONCILES" default:"1"`
+
+		// Webhooks configures the admission webhook server, webhooks are served only when
+		// enabled as the server needs a TLS certificate
+		Webhooks struct {
+			Enabled bool   `envconfig:"WEBHOOKS_ENABLED" default:"false"`
+			Port    int    `envconfig:"WEBHOOK_PORT" default:"9443"`
+			CertDir string `envconfig:"WEBHOOK_CERT_DIR" default:"/tmp/k8s-webhook-server/serving-certs"`
+		}
 	}
 )
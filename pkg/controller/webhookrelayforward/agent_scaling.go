@@ -0,0 +1,264 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// defaultTargetCPUUtilization is used by the autoscaler when no metrics are set
+const defaultTargetCPUUtilization = 80
+
+// agentAutoscaling returns autoscaling configuration, nil if it's disabled
+func agentAutoscaling(cr *forwardv1.WebhookRelayForward) *forwardv1.AgentAutoscalingSpec {
+	if cr.Spec.Agent == nil || cr.Spec.Agent.Autoscaling == nil || cr.Spec.Agent.Autoscaling.MaxReplicas == 0 {
+		return nil
+	}
+	return cr.Spec.Agent.Autoscaling
+}
+
+// agentReplicas returns the desired number of agent replicas. When autoscaling is
+// enabled, it's only used when the deployment is created.
+func agentReplicas(cr *forwardv1.WebhookRelayForward) int32 {
+	if autoscaling := agentAutoscaling(cr); autoscaling != nil {
+		if autoscaling.MinReplicas != nil {
+			return *autoscaling.MinReplicas
+		}
+		return 1
+	}
+	if cr.Spec.Agent != nil && cr.Spec.Agent.Replicas != nil {
+		return *cr.Spec.Agent.Replicas
+	}
+	return 1
+}
+
+// agentMaxReplicas returns the highest number of agent replicas that can be running
+func agentMaxReplicas(cr *forwardv1.WebhookRelayForward) int32 {
+	if autoscaling := agentAutoscaling(cr); autoscaling != nil {
+		return autoscaling.MaxReplicas
+	}
+	return agentReplicas(cr)
+}
+
+// agentTopologySpreadConstraints returns constraints from the spec or, once the agent can
+// run more than one replica, spreads pods across nodes and zones if scheduler can do that
+func (r *ReconcileWebhookRelayForward) agentTopologySpreadConstraints(cr *forwardv1.WebhookRelayForward) []corev1.TopologySpreadConstraint {
+	if atomic.LoadInt32(&r.topologySpreadUnsupported) == 1 {
+		// API server would drop them anyway
+		return nil
+	}
+	if cr.Spec.Agent != nil && len(cr.Spec.Agent.TopologySpreadConstraints) > 0 {
+		return cr.Spec.Agent.TopologySpreadConstraints
+	}
+	if agentMaxReplicas(cr) < 2 {
+		return nil
+	}
+
+	var constraints []corev1.TopologySpreadConstraint
+	for _, key := range []string{"kubernetes.io/hostname", "topology.kubernetes.io/zone"} {
+		constraints = append(constraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           1,
+			TopologyKey:       key,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: selectorLabelsForCR(cr),
+			},
+		})
+	}
+	return constraints
+}
+
+// applyDeployment applies the agent deployment and checks whether the API server kept the
+// topology spread constraints, they are dropped on clusters without the EvenPodsSpread
+// feature and the deployment would never match the spec
+func (r *ReconcileWebhookRelayForward) applyDeployment(logger logr.Logger, instance *forwardv1.WebhookRelayForward, deployment *appsv1.Deployment) error {
+	constraints := len(deployment.Spec.Template.Spec.TopologySpreadConstraints)
+	if err := r.apply(instance, deployment); err != nil {
+		return err
+	}
+	// deployment now holds the object returned by the API server
+	if constraints > 0 && len(deployment.Spec.Template.Spec.TopologySpreadConstraints) == 0 {
+		logger.Info("Topology spread constraints are not supported by the cluster, not setting them")
+		atomic.StoreInt32(&r.topologySpreadUnsupported, 1)
+	}
+	return nil
+}
+
+// newAutoscalerForCR returns the agent deployment autoscaler, nil if autoscaling is disabled
+func newAutoscalerForCR(cr *forwardv1.WebhookRelayForward) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	autoscaling := agentAutoscaling(cr)
+	if autoscaling == nil {
+		return nil
+	}
+
+	metrics := append([]autoscalingv2beta2.MetricSpec{}, autoscaling.Metrics...)
+	if autoscaling.TargetCPUUtilizationPercentage != nil || len(metrics) == 0 {
+		target := int32(defaultTargetCPUUtilization)
+		if autoscaling.TargetCPUUtilizationPercentage != nil {
+			target = *autoscaling.TargetCPUUtilizationPercentage
+		}
+		metrics = append(metrics, autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:               autoscalingv2beta2.UtilizationMetricType,
+					AverageUtilization: &target,
+				},
+			},
+		})
+	}
+
+	return &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agentResourceName(cr),
+			Namespace: cr.Namespace,
+			Labels:    labelsForCR(cr),
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deploymentName(cr),
+			},
+			MinReplicas: toInt32(agentReplicas(cr)),
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+}
+
+// newPodDisruptionBudgetForCR returns the agent pod disruption budget, nil if it's disabled
+// or the agent can't run more than one replica
+func newPodDisruptionBudgetForCR(cr *forwardv1.WebhookRelayForward) *policyv1beta1.PodDisruptionBudget {
+	var spec forwardv1.AgentPodDisruptionBudgetSpec
+	if cr.Spec.Agent != nil && cr.Spec.Agent.PodDisruptionBudget != nil {
+		spec = *cr.Spec.Agent.PodDisruptionBudget
+	}
+	if spec.Disabled {
+		return nil
+	}
+
+	// budget for a single replica would block node drains
+	if agentMaxReplicas(cr) < 2 && spec.MinAvailable == nil && spec.MaxUnavailable == nil {
+		return nil
+	}
+
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agentResourceName(cr),
+			Namespace: cr.Namespace,
+			Labels:    labelsForCR(cr),
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selectorLabelsForCR(cr),
+			},
+		},
+	}
+
+	switch {
+	case spec.MinAvailable != nil:
+		pdb.Spec.MinAvailable = spec.MinAvailable
+	case spec.MaxUnavailable != nil:
+		pdb.Spec.MaxUnavailable = spec.MaxUnavailable
+	default:
+		maxUnavailable := intstr.FromInt(1)
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+	return pdb
+}
+
+// ensureAgentAutoscaler creates, updates or removes the agent autoscaler
+func (r *ReconcileWebhookRelayForward) ensureAgentAutoscaler(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+	existing := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	desired := newAutoscalerForCR(instance)
+	if desired == nil {
+		return r.deleteOwnedObject(logger, instance, existing)
+	}
+
+	return r.ensureOwnedObject(logger, instance, existing, desired, func() bool {
+		// metrics removed from the spec wouldn't be detected otherwise
+		return specEqual(desired.Spec, existing.Spec) && len(existing.Spec.Metrics) == len(desired.Spec.Metrics)
+	})
+}
+
+// ensureAgentPodDisruptionBudget creates, updates or removes the agent pod disruption budget
+func (r *ReconcileWebhookRelayForward) ensureAgentPodDisruptionBudget(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+	existing := &policyv1beta1.PodDisruptionBudget{}
+	desired := newPodDisruptionBudgetForCR(instance)
+	if desired == nil {
+		return r.deleteOwnedObject(logger, instance, existing)
+	}
+
+	return r.ensureOwnedObject(logger, instance, existing, desired, func() bool {
+		return specEqual(desired.Spec.Selector, existing.Spec.Selector) &&
+			apiequality.Semantic.DeepEqual(desired.Spec.MinAvailable, existing.Spec.MinAvailable) &&
+			apiequality.Semantic.DeepEqual(desired.Spec.MaxUnavailable, existing.Spec.MaxUnavailable)
+	})
+}
+
+// ownedObject is an object that is created by the operator for the CR
+type ownedObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// ensureOwnedObject applies the desired object if it doesn't exist yet or the existing one
+// doesn't match it, equal function compares the existing object with the desired one
+func (r *ReconcileWebhookRelayForward) ensureOwnedObject(logger logr.Logger, instance *forwardv1.WebhookRelayForward, existing, desired ownedObject, equal func() bool) error {
+	kind := reflect.TypeOf(existing).Elem().Name()
+
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: desired.GetNamespace(), Name: desired.GetName()}, existing)
+	switch {
+	case errors.IsNotFound(err):
+		logger.Info("Creating object", "kind", kind, "name", desired.GetName())
+	case err != nil:
+		return err
+	case !metav1.IsControlledBy(existing, instance):
+		return fmt.Errorf("%s '%s' already exists and is not managed by this CR", kind, desired.GetName())
+	case equal():
+		return nil
+	default:
+		logger.Info("Updating object", "kind", kind, "name", desired.GetName())
+	}
+
+	return r.apply(instance, desired)
+}
+
+// deleteOwnedObject removes an agent object that is no longer needed
+func (r *ReconcileWebhookRelayForward) deleteOwnedObject(logger logr.Logger, instance *forwardv1.WebhookRelayForward, existing ownedObject) error {
+	name := agentResourceName(instance)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: instance.GetNamespace(), Name: name}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !metav1.IsControlledBy(existing, instance) {
+		return nil
+	}
+
+	logger.Info("Deleting object that is no longer needed", "kind", reflect.TypeOf(existing).Elem().Name(), "name", name)
+	err = r.client.Delete(context.TODO(), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestAgentScaling(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, autoscalingv2beta2.AddToScheme(s))
+	assert.NilError(t, policyv1beta1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Agent: &forwardv1.AgentSpec{
+				Autoscaling: &forwardv1.AgentAutoscalingSpec{MinReplicas: toInt32(2), MaxReplicas: 5},
+			},
+		},
+	}
+	r := &ReconcileWebhookRelayForward{
+		client: newApplyClient(fake.NewFakeClientWithScheme(s, instance)),
+		scheme: s,
+		config: &config.Config{Image: "webhookrelay/webhookrelayd"},
+	}
+	name := types.NamespacedName{Namespace: "default", Name: "fwd-whr-agent"}
+
+	t.Run("TestAutoscaler", func(t *testing.T) {
+		assert.NilError(t, r.ensureAgentAutoscaler(log, instance))
+
+		hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+		assert.NilError(t, r.client.Get(context.TODO(), name, hpa))
+		assert.Equal(t, "fwd-whr-deployment", hpa.Spec.ScaleTargetRef.Name)
+		assert.Equal(t, int32(2), *hpa.Spec.MinReplicas)
+		assert.Equal(t, int32(defaultTargetCPUUtilization), *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization)
+	})
+
+	t.Run("TestReplicasManagedByAutoscaler", func(t *testing.T) {
+		creds := &agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}
+		current := r.newDeploymentForCR(creds, instance)
+		assert.Equal(t, int32(2), *current.Spec.Replicas)
+
+		current.Spec.Replicas = toInt32(4)
+		_, equal := r.checkDeployment(creds, instance, current)
+		assert.Assert(t, equal)
+	})
+
+	t.Run("TestPodDisruptionBudget", func(t *testing.T) {
+		assert.NilError(t, r.ensureAgentPodDisruptionBudget(log, instance))
+
+		pdb := &policyv1beta1.PodDisruptionBudget{}
+		assert.NilError(t, r.client.Get(context.TODO(), name, pdb))
+		assert.Equal(t, intstr.FromInt(1), *pdb.Spec.MaxUnavailable)
+		assert.Equal(t, "fwd", pdb.Spec.Selector.MatchLabels[instanceLabel])
+
+		minAvailable := intstr.FromString("50%")
+		instance.Spec.Agent.PodDisruptionBudget = &forwardv1.AgentPodDisruptionBudgetSpec{MinAvailable: &minAvailable}
+		assert.NilError(t, r.ensureAgentPodDisruptionBudget(log, instance))
+		pdb = &policyv1beta1.PodDisruptionBudget{}
+		assert.NilError(t, r.client.Get(context.TODO(), name, pdb))
+		assert.Equal(t, minAvailable, *pdb.Spec.MinAvailable)
+		assert.Assert(t, pdb.Spec.MaxUnavailable == nil)
+	})
+
+	t.Run("TestTopologySpread", func(t *testing.T) {
+		constraints := r.agentTopologySpreadConstraints(instance)
+		assert.Equal(t, 2, len(constraints))
+		assert.Equal(t, "fwd", constraints[0].LabelSelector.MatchLabels[instanceLabel])
+	})
+
+	t.Run("TestSingleReplica", func(t *testing.T) {
+		instance.Spec.Agent = &forwardv1.AgentSpec{Replicas: toInt32(1)}
+		assert.NilError(t, r.ensureAgentAutoscaler(log, instance))
+		assert.NilError(t, r.ensureAgentPodDisruptionBudget(log, instance))
+
+		err := r.client.Get(context.TODO(), name, &autoscalingv2beta2.HorizontalPodAutoscaler{})
+		assert.Assert(t, errors.IsNotFound(err))
+		err = r.client.Get(context.TODO(), name, &policyv1beta1.PodDisruptionBudget{})
+		assert.Assert(t, errors.IsNotFound(err))
+
+		// single agent doesn't have to be spread
+		assert.Assert(t, r.agentTopologySpreadConstraints(instance) == nil)
+	})
+}
+
+// dropTopologySpreadClient drops topology spread constraints like the API server
+// does when the EvenPodsSpread feature is disabled
+type dropTopologySpreadClient struct {
+	client.Client
+}
+
+func (c *dropTopologySpreadClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if deployment, ok := obj.(*appsv1.Deployment); ok {
+		deployment.Spec.Template.Spec.TopologySpreadConstraints = nil
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplyDeployment_TopologySpreadUnsupported(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, appsv1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Agent: &forwardv1.AgentSpec{Replicas: toInt32(2)},
+		},
+	}
+	r := &ReconcileWebhookRelayForward{
+		client: &dropTopologySpreadClient{newApplyClient(fake.NewFakeClientWithScheme(s, instance))},
+		scheme: s,
+		config: &config.Config{Image: "webhookrelay/webhookrelayd"},
+	}
+	creds := &agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}
+
+	deployment := r.newDeploymentForCR(creds, instance)
+	assert.Equal(t, 2, len(deployment.Spec.Template.Spec.TopologySpreadConstraints))
+	assert.NilError(t, r.applyDeployment(log, instance, deployment))
+
+	current := &appsv1.Deployment{}
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "fwd-whr-deployment"}, current))
+
+	// constraints are no longer set so the deployment matches the spec
+	_, equal := r.checkDeployment(creds, instance, current)
+	assert.Assert(t, equal)
+}
+
+func TestApplyDeployment_EnableAutoscaling(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, appsv1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Agent: &forwardv1.AgentSpec{Replicas: toInt32(2)},
+		},
+	}
+	r := &ReconcileWebhookRelayForward{
+		client: newApplyClient(fake.NewFakeClientWithScheme(s, instance)),
+		scheme: s,
+		config: &config.Config{Image: "webhookrelay/webhookrelayd"},
+	}
+	creds := &agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}
+	name := types.NamespacedName{Namespace: "default", Name: "fwd-whr-deployment"}
+
+	assert.NilError(t, r.applyDeployment(log, instance, r.newDeploymentForCR(creds, instance)))
+
+	// autoscaler is enabled and scales the deployment
+	instance.Spec.Agent.Autoscaling = &forwardv1.AgentAutoscalingSpec{MinReplicas: toInt32(2), MaxReplicas: 5}
+	current := &appsv1.Deployment{}
+	assert.NilError(t, r.client.Get(context.TODO(), name, current))
+	current.Spec.Replicas = toInt32(4)
+	assert.NilError(t, r.client.Update(context.TODO(), current))
+
+	// spec change is applied
+	instance.Spec.Agent.PodLabels = map[string]string{"team": "a"}
+	desired, equal := r.checkDeployment(creds, instance, current)
+	assert.Assert(t, !equal)
+	assert.NilError(t, r.applyDeployment(log, instance, desired))
+
+	updated := &appsv1.Deployment{}
+	assert.NilError(t, r.client.Get(context.TODO(), name, updated))
+	assert.Equal(t, "a", updated.Spec.Template.Labels["team"])
+	assert.Equal(t, int32(4), *updated.Spec.Replicas)
+}
@@ -0,0 +1,64 @@
+package webhookrelayforward
+
+import (
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// agentResourceName is the name of the agent service, autoscaler and disruption budget
+func agentResourceName(cr *forwardv1.WebhookRelayForward) string {
+	return cr.Name + "-whr-agent"
+}
+
+// newServiceForCR returns a service that exposes agent health and metrics port,
+// nil if the health endpoint is disabled
+func newServiceForCR(cr *forwardv1.WebhookRelayForward) *corev1.Service {
+	health := agentHealth(cr)
+	if health == nil {
+		return nil
+	}
+
+	labels := labelsForCR(cr)
+	labels["app"] = cr.Name
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agentResourceName(cr),
+			Namespace: cr.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: selectorLabelsForCR(cr),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       agentHealthPortName,
+					Port:       health.Port,
+					TargetPort: intstr.FromString(agentHealthPortName),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+}
+
+// ensureAgentService creates or updates the agent service, service is removed
+// when the health endpoint is disabled
+func (r *ReconcileWebhookRelayForward) ensureAgentService(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+	existing := &corev1.Service{}
+	desired := newServiceForCR(instance)
+	if desired == nil {
+		return r.deleteOwnedObject(logger, instance, existing)
+	}
+
+	return r.ensureOwnedObject(logger, instance, existing, desired, func() bool {
+		// cluster IP and other defaulted fields are not managed by the operator
+		return specEqual(desired.Spec.Selector, existing.Spec.Selector) &&
+			specEqual(desired.Spec.Ports, existing.Spec.Ports) &&
+			specEqual(desired.Labels, existing.Labels)
+	})
+}
@@ -0,0 +1,62 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestEnsureAgentService(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Agent: &forwardv1.AgentSpec{Health: &forwardv1.AgentHealthSpec{Enabled: true}},
+		},
+	}
+	r := &ReconcileWebhookRelayForward{
+		client: newApplyClient(fake.NewFakeClientWithScheme(s, instance)),
+		scheme: s,
+	}
+	serviceName := types.NamespacedName{Namespace: "default", Name: "fwd-whr-agent"}
+
+	t.Run("TestCreate", func(t *testing.T) {
+		assert.NilError(t, r.ensureAgentService(log, instance))
+
+		service := &corev1.Service{}
+		assert.NilError(t, r.client.Get(context.TODO(), serviceName, service))
+		assert.Equal(t, int32(defaultAgentHealthPort), service.Spec.Ports[0].Port)
+		assert.Equal(t, "fwd", service.Spec.Selector[instanceLabel])
+		assert.Assert(t, metav1.IsControlledBy(service, instance))
+	})
+
+	t.Run("TestUpdatePort", func(t *testing.T) {
+		instance.Spec.Agent.Health.Port = 9090
+		assert.NilError(t, r.ensureAgentService(log, instance))
+
+		service := &corev1.Service{}
+		assert.NilError(t, r.client.Get(context.TODO(), serviceName, service))
+		assert.Equal(t, int32(9090), service.Spec.Ports[0].Port)
+	})
+
+	t.Run("TestDisabled", func(t *testing.T) {
+		instance.Spec.Agent.Health.Enabled = false
+		assert.NilError(t, r.ensureAgentService(log, instance))
+
+		err := r.client.Get(context.TODO(), serviceName, &corev1.Service{})
+		assert.Assert(t, errors.IsNotFound(err))
+	})
+}
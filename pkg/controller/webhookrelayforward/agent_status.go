@@ -0,0 +1,151 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// failingWaitingReasons are container waiting reasons that won't
+// resolve without an intervention
+var failingWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// unreadyAgentGracePeriod - agent that is running but not ready for longer
+// than this is reported as failing
+const unreadyAgentGracePeriod = 2 * time.Minute
+
+// agentState is the state of the agent deployment derived from its status
+type agentState struct {
+	phase   forwardv1.AgentStatus
+	ready   bool
+	reason  string
+	message string
+}
+
+// agentStateForDeployment computes agent status from the deployment rollout status. Agent
+// is ready while at least one pod is available, even if the rollout is still in progress.
+func (r *ReconcileWebhookRelayForward) agentStateForDeployment(deployment *appsv1.Deployment) (*agentState, error) {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	st := deployment.Status
+
+	state := &agentState{
+		ready: st.AvailableReplicas > 0,
+	}
+
+	if cond := deploymentCondition(deployment, appsv1.DeploymentProgressing); cond != nil &&
+		cond.Reason == "ProgressDeadlineExceeded" {
+		state.phase = forwardv1.AgentStatusDegraded
+		state.reason = forwardv1.ReasonDeploymentStalled
+		state.message = cond.Message
+		return state, nil
+	}
+
+	if deploymentRolledOut(deployment) {
+		state.phase = forwardv1.AgentStatusRunning
+		state.reason = forwardv1.ReasonDeploymentReady
+		state.message = fmt.Sprintf("%d/%d replicas available", st.AvailableReplicas, replicas)
+		if replicas == 0 {
+			state.reason = forwardv1.ReasonNotReady
+			state.message = "deployment is scaled down to 0 replicas"
+		}
+		return state, nil
+	}
+
+	// checking pods only when the rollout hasn't finished as the pods
+	// might never become available
+	failing, err := r.failingAgentPods(deployment)
+	if err != nil {
+		return nil, err
+	}
+	if len(failing) > 0 {
+		state.phase = forwardv1.AgentStatusDegraded
+		state.reason = forwardv1.ReasonAgentPodsFailing
+		state.message = strings.Join(failing, ", ")
+		return state, nil
+	}
+
+	state.phase = forwardv1.AgentStatusProgressing
+	state.reason = forwardv1.ReasonDeploymentProgressing
+	switch {
+	case deployment.Generation > st.ObservedGeneration:
+		state.message = "waiting for the deployment spec to be observed"
+	case st.UpdatedReplicas < replicas:
+		state.message = fmt.Sprintf("%d/%d replicas updated", st.UpdatedReplicas, replicas)
+	case st.Replicas > st.UpdatedReplicas:
+		state.message = fmt.Sprintf("%d old replicas pending termination", st.Replicas-st.UpdatedReplicas)
+	default:
+		state.message = fmt.Sprintf("%d/%d replicas available", st.AvailableReplicas, replicas)
+	}
+	return state, nil
+}
+
+// failingAgentPods returns "<pod>: <reason>" for agent pods with containers that
+// are crash looping, can't be started or keep failing readiness probes
+func (r *ReconcileWebhookRelayForward) failingAgentPods(deployment *appsv1.Deployment) ([]string, error) {
+	if deployment.Spec.Selector == nil {
+		return nil, nil
+	}
+
+	// reading pods directly from the API server so the operator
+	// doesn't have to cache all pods in the cluster
+	pods := &corev1.PodList{}
+	err := r.apiReader.List(context.TODO(), pods,
+		client.InNamespace(deployment.Namespace),
+		client.MatchingLabels(deployment.Spec.Selector.MatchLabels),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent pods: %w", err)
+	}
+
+	var failing []string
+	for i := range pods.Items {
+		for _, cs := range pods.Items[i].Status.ContainerStatuses {
+			switch {
+			case cs.State.Waiting != nil && failingWaitingReasons[cs.State.Waiting.Reason]:
+				failing = append(failing, pods.Items[i].Name+": "+cs.State.Waiting.Reason)
+			case cs.State.Running != nil && !cs.Ready && time.Since(cs.State.Running.StartedAt.Time) > unreadyAgentGracePeriod:
+				// agent is running but its health endpoint reports
+				// that it's not connected
+				failing = append(failing, pods.Items[i].Name+": readiness probe failing")
+			}
+		}
+	}
+	sort.Strings(failing)
+	return failing, nil
+}
+
+func deploymentCondition(deployment *appsv1.Deployment, t appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == t {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setAgentState records the agent deployment state in the status and emits an event
+// when the agent becomes degraded
+func (r *ReconcileWebhookRelayForward) setAgentState(instance *forwardv1.WebhookRelayForward, status *forwardv1.WebhookRelayForwardStatus, state *agentState) {
+	if state.phase == forwardv1.AgentStatusDegraded && instance.Status.AgentStatus != forwardv1.AgentStatusDegraded {
+		r.recorder.Event(instance, corev1.EventTypeWarning, state.reason, "Agent is degraded: "+state.message)
+	}
+	setAgentStatus(status, instance.GetGeneration(), state.phase, state.ready, state.reason, state.message)
+}
@@ -0,0 +1,129 @@
+package webhookrelayforward
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestAgentStateForDeployment(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+
+	selector := map[string]string{instanceLabel: "fwd"}
+	crashing := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd-crashing", Namespace: "default", Labels: selector},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "webhookrelayd",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}},
+		},
+	}
+
+	unready := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd-unready", Namespace: "default", Labels: selector},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "webhookrelayd",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(time.Now().Add(-time.Hour))}},
+			}},
+		},
+	}
+
+	deployment := func(replicas int32, st appsv1.DeploymentStatus) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "fwd-whr-deployment", Namespace: "default", Generation: 2},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: toInt32(replicas),
+				Selector: &metav1.LabelSelector{MatchLabels: selector},
+			},
+			Status: st,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		deployment *appsv1.Deployment
+		pods       []runtime.Object
+		want       agentState
+	}{
+		{
+			name:       "rolled out",
+			deployment: deployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}),
+			want:       agentState{phase: forwardv1.AgentStatusRunning, ready: true, reason: forwardv1.ReasonDeploymentReady, message: "2/2 replicas available"},
+		},
+		{
+			name:       "not observed",
+			deployment: deployment(1, appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}),
+			want:       agentState{phase: forwardv1.AgentStatusProgressing, ready: true, reason: forwardv1.ReasonDeploymentProgressing, message: "waiting for the deployment spec to be observed"},
+		},
+		{
+			name:       "updating",
+			deployment: deployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2}),
+			want:       agentState{phase: forwardv1.AgentStatusProgressing, ready: true, reason: forwardv1.ReasonDeploymentProgressing, message: "1/2 replicas updated"},
+		},
+		{
+			name:       "crash looping",
+			deployment: deployment(1, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1}),
+			pods:       []runtime.Object{crashing},
+			want:       agentState{phase: forwardv1.AgentStatusDegraded, reason: forwardv1.ReasonAgentPodsFailing, message: "fwd-crashing: CrashLoopBackOff"},
+		},
+		{
+			name:       "readiness probe failing",
+			deployment: deployment(1, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1}),
+			pods:       []runtime.Object{unready},
+			want:       agentState{phase: forwardv1.AgentStatusDegraded, reason: forwardv1.ReasonAgentPodsFailing, message: "fwd-unready: readiness probe failing"},
+		},
+		{
+			name: "stalled",
+			deployment: deployment(1, appsv1.DeploymentStatus{
+				ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1,
+				Conditions: []appsv1.DeploymentCondition{{
+					Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse,
+					Reason: "ProgressDeadlineExceeded", Message: "ReplicaSet has timed out progressing.",
+				}},
+			}),
+			want: agentState{phase: forwardv1.AgentStatusDegraded, reason: forwardv1.ReasonDeploymentStalled, message: "ReplicaSet has timed out progressing."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ReconcileWebhookRelayForward{apiReader: fake.NewFakeClientWithScheme(s, tt.pods...)}
+			state, err := r.agentStateForDeployment(tt.deployment)
+			assert.NilError(t, err)
+			assert.Equal(t, tt.want.phase, state.phase)
+			assert.Equal(t, tt.want.ready, state.ready)
+			assert.Equal(t, tt.want.reason, state.reason)
+			assert.Equal(t, tt.want.message, state.message)
+		})
+	}
+}
+
+func TestSetAgentState_DegradedEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileWebhookRelayForward{recorder: recorder}
+	instance := &forwardv1.WebhookRelayForward{}
+	degraded := &agentState{phase: forwardv1.AgentStatusDegraded, reason: forwardv1.ReasonDeploymentStalled, message: "timed out"}
+
+	status := instance.Status.DeepCopy()
+	r.setAgentState(instance, status, degraded)
+	assert.Equal(t, forwardv1.AgentStatusDegraded, status.AgentStatus)
+	assert.Equal(t, 1, len(recorder.Events))
+
+	// event is emitted only when the agent becomes degraded
+	instance.Status = *status
+	r.setAgentState(instance, status, degraded)
+	assert.Equal(t, 1, len(recorder.Events))
+}
@@ -0,0 +1,286 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// defaultAgentTokenRotationPeriod is used when the CR doesn't set one
+const defaultAgentTokenRotationPeriod = 30 * 24 * time.Hour
+
+// Agent token secret annotations
+const (
+	// agentTokenCreatedAnnotation is the time when the token was created
+	agentTokenCreatedAnnotation = "forward.webhookrelay.com/token-created"
+	// agentTokenBucketsAnnotation lists buckets the token is scoped to
+	agentTokenBucketsAnnotation = "forward.webhookrelay.com/token-buckets"
+	// agentTokenPreviousAnnotation is the key of the rotated token, it's revoked once
+	// the agent deployment picks up the new one
+	agentTokenPreviousAnnotation = "forward.webhookrelay.com/previous-token"
+)
+
+// agentCredentials are the credentials used by the agent deployment
+type agentCredentials struct {
+	// secretName is the secret in the CR namespace with the credentials
+	secretName string
+	key        string
+	secret     string
+}
+
+func agentTokenSecretName(instance *forwardv1.WebhookRelayForward) string {
+	return instance.GetName() + "-whr-agent-token"
+}
+
+// agentTokenProvisioned checks whether the agent uses a scoped token, it's always provisioned
+// for CRs using an account so the account credentials don't end up in the CR namespace
+func agentTokenProvisioned(instance *forwardv1.WebhookRelayForward) bool {
+	if instance.Spec.AccountRef != nil {
+		return true
+	}
+	return instance.Spec.AgentToken != nil && instance.Spec.AgentToken.Provision
+}
+
+func agentTokenRotationPeriod(instance *forwardv1.WebhookRelayForward) time.Duration {
+	if instance.Spec.AgentToken == nil || instance.Spec.AgentToken.RotationPeriod == nil ||
+		instance.Spec.AgentToken.RotationPeriod.Duration <= 0 {
+		return defaultAgentTokenRotationPeriod
+	}
+	return instance.Spec.AgentToken.RotationPeriod.Duration
+}
+
+// agentTokenBuckets returns sorted bucket names from the spec, token is scoped to them
+func agentTokenBuckets(instance *forwardv1.WebhookRelayForward) []string {
+	buckets := make([]string, 0, len(instance.Spec.Buckets))
+	for i := range instance.Spec.Buckets {
+		buckets = append(buckets, instance.Spec.Buckets[i].Name)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// ensureAgentCredentials returns credentials for the agent deployment. If the CR asks for it,
+// a scoped token is provisioned, otherwise operator credentials are used.
+func (r *ReconcileWebhookRelayForward) ensureAgentCredentials(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) (*agentCredentials, error) {
+	if agentTokenProvisioned(instance) {
+		return r.ensureAgentToken(logger, apiClient, instance)
+	}
+
+	// token might have been provisioned previously
+	if err := r.revokeAgentToken(logger, apiClient, instance); err != nil {
+		return nil, err
+	}
+
+	return &agentCredentials{
+		secretName: agentCredentialsSecretName(instance),
+		key:        apiClient.accessTokenKey,
+		secret:     apiClient.accessTokenSecret,
+	}, nil
+}
+
+// ensureAgentToken creates a token scoped to the CR buckets or rotates the existing one if it's
+// too old or bucket list has changed
+func (r *ReconcileWebhookRelayForward) ensureAgentToken(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) (*agentCredentials, error) {
+	existing, err := r.getAgentTokenSecret(instance)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && !metav1.IsControlledBy(existing, instance) {
+		return nil, fmt.Errorf("secret '%s' already exists and is not managed by this CR", existing.Name)
+	}
+
+	buckets := agentTokenBuckets(instance)
+
+	if existing != nil {
+		creds := &agentCredentials{
+			secretName: existing.Name,
+			key:        string(existing.Data[forwardv1.AccessTokenKeyName]),
+			secret:     string(existing.Data[forwardv1.AccessTokenSecretName]),
+		}
+		created, _ := time.Parse(time.RFC3339, existing.Annotations[agentTokenCreatedAnnotation])
+		switch {
+		case creds.key == "" || creds.secret == "":
+			logger.Info("Agent token secret is incomplete, provisioning a new token")
+		case existing.Annotations[agentTokenBucketsAnnotation] != strings.Join(buckets, ","):
+			logger.Info("Agent token buckets have changed, rotating token")
+		case time.Since(created) > agentTokenRotationPeriod(instance):
+			logger.Info("Agent token rotation period has passed, rotating token")
+		default:
+			return creds, nil
+		}
+	}
+
+	token, err := apiClient.client.CreateAccessToken(&webhookrelay.AccessTokenCreateOptions{
+		Description: withOwnershipMarker("Agent token", ownerForCR(instance)),
+		Scopes: webhookrelay.AccessTokenScopes{
+			Buckets: buckets,
+		},
+		APIAccess: webhookrelay.AccessTokenAPIAccessDisabled,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent access token: %w", err)
+	}
+
+	secret := newAgentTokenSecret(instance, time.Now().UTC().Format(time.RFC3339), strings.Join(buckets, ","), token.Key, token.Secret)
+
+	if existing != nil {
+		// previous token might still not be revoked if we are rotating
+		// before the deployment was rolled out
+		r.revokeToken(logger, apiClient, existing.Annotations[agentTokenPreviousAnnotation])
+		secret.Annotations[agentTokenPreviousAnnotation] = string(existing.Data[forwardv1.AccessTokenKeyName])
+	}
+
+	err = r.apply(instance, secret)
+	if err != nil {
+		// token wasn't saved, no point in keeping it
+		r.revokeToken(logger, apiClient, token.Key)
+		return nil, fmt.Errorf("failed to save agent access token: %w", err)
+	}
+
+	logger.Info("Agent access token provisioned", "Secret.Name", secret.Name)
+	r.recorder.Event(instance, corev1.EventTypeNormal, "AgentTokenProvisioned",
+		fmt.Sprintf("Access token for buckets '%s' stored in secret '%s'", strings.Join(buckets, ","), secret.Name))
+
+	return &agentCredentials{
+		secretName: secret.Name,
+		key:        token.Key,
+		secret:     token.Secret,
+	}, nil
+}
+
+// revokePreviousAgentToken revokes the rotated token once the agent deployment
+// is running with the new one
+func (r *ReconcileWebhookRelayForward) revokePreviousAgentToken(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward, deployment *appsv1.Deployment) error {
+	if !agentTokenProvisioned(instance) || !deploymentRolledOut(deployment) {
+		return nil
+	}
+
+	secret, err := r.getAgentTokenSecret(instance)
+	if err != nil || secret == nil {
+		return err
+	}
+	previous := secret.Annotations[agentTokenPreviousAnnotation]
+	if previous == "" {
+		return nil
+	}
+
+	r.revokeToken(logger, apiClient, previous)
+
+	// applying the secret without the annotation removes it
+	return r.apply(instance, newAgentTokenSecret(instance,
+		secret.Annotations[agentTokenCreatedAnnotation],
+		secret.Annotations[agentTokenBucketsAnnotation],
+		string(secret.Data[forwardv1.AccessTokenKeyName]),
+		string(secret.Data[forwardv1.AccessTokenSecretName]),
+	))
+}
+
+// newAgentTokenSecret returns the agent token secret with the fields managed by the operator
+func newAgentTokenSecret(instance *forwardv1.WebhookRelayForward, created, buckets, key, secret string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agentTokenSecretName(instance),
+			Namespace: instance.GetNamespace(),
+			Labels: map[string]string{
+				"app": instance.GetName(),
+			},
+			Annotations: map[string]string{
+				agentTokenCreatedAnnotation: created,
+				agentTokenBucketsAnnotation: buckets,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			forwardv1.AccessTokenKeyName:    []byte(key),
+			forwardv1.AccessTokenSecretName: []byte(secret),
+		},
+	}
+}
+
+// revokeAgentToken revokes the agent tokens and deletes the secret, used when the
+// CR is deleted or token provisioning is disabled
+func (r *ReconcileWebhookRelayForward) revokeAgentToken(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) error {
+	secret, err := r.getAgentTokenSecret(instance)
+	if err != nil || secret == nil {
+		return err
+	}
+	if !metav1.IsControlledBy(secret, instance) {
+		return nil
+	}
+
+	for _, key := range []string{string(secret.Data[forwardv1.AccessTokenKeyName]), secret.Annotations[agentTokenPreviousAnnotation]} {
+		if key == "" {
+			continue
+		}
+		err = apiClient.client.DeleteAccessToken(&webhookrelay.AccessTokenDeleteOptions{ID: key})
+		if err != nil && !isNotFoundError(err) {
+			return fmt.Errorf("failed to revoke agent access token: %w", err)
+		}
+	}
+
+	logger.Info("Agent access token revoked", "Secret.Name", secret.Name)
+
+	err = r.client.Delete(context.TODO(), secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// revokeToken revokes a token, failures are only logged as the token
+// will be revoked again when the CR is deleted
+func (r *ReconcileWebhookRelayForward) revokeToken(logger logr.Logger, apiClient *WebhookRelayClient, key string) {
+	if key == "" {
+		return
+	}
+	err := apiClient.client.DeleteAccessToken(&webhookrelay.AccessTokenDeleteOptions{ID: key})
+	if err != nil && !isNotFoundError(err) {
+		logger.Error(err, "failed to revoke access token")
+	}
+}
+
+func (r *ReconcileWebhookRelayForward) getAgentTokenSecret(instance *forwardv1.WebhookRelayForward) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{
+		Namespace: instance.GetNamespace(),
+		Name:      agentTokenSecretName(instance),
+	}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+// deploymentRolledOut checks whether all deployment replicas run the latest pod template
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	if deployment == nil || deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// isNotFoundError checks whether Webhook Relay API responded with 404
+func isNotFoundError(err error) bool {
+	return strings.Contains(err.Error(), "HTTP status 404")
+}
@@ -0,0 +1,128 @@
+package webhookrelayforward
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// fakeTokensAPI issues and revokes access tokens
+type fakeTokensAPI struct {
+	mu      sync.Mutex
+	issued  int
+	revoked []string
+}
+
+func (f *fakeTokensAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == "/tokens":
+		f.issued++
+		fmt.Fprintf(w, `{"key": "00000000-0000-0000-0000-%012d", "secret": "secret-%d"}`, f.issued, f.issued)
+	case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/tokens/"):
+		f.revoked = append(f.revoked, strings.TrimPrefix(req.URL.Path, "/tokens/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAgentToken(t *testing.T) {
+	tokens := &fakeTokensAPI{}
+	srv := httptest.NewServer(tokens)
+	defer srv.Close()
+
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Buckets:    []forwardv1.BucketSpec{{Name: "b-1"}},
+			AgentToken: &forwardv1.AgentTokenSpec{Provision: true},
+		},
+	}
+
+	r := &ReconcileWebhookRelayForward{
+		client:   &applyOnlyClient{newApplyClient(fake.NewFakeClientWithScheme(s, instance))},
+		scheme:   s,
+		recorder: record.NewFakeRecorder(10),
+	}
+	apiClient := newTestAPIClient(t, srv)
+
+	t.Run("TestProvision", func(t *testing.T) {
+		creds, err := r.ensureAgentCredentials(log, apiClient, instance)
+		assert.NilError(t, err)
+		assert.Equal(t, "fwd-whr-agent-token", creds.secretName)
+		assert.Equal(t, "secret-1", creds.secret)
+
+		secret, err := r.getAgentTokenSecret(instance)
+		assert.NilError(t, err)
+		assert.Equal(t, "b-1", secret.Annotations[agentTokenBucketsAnnotation])
+		assert.Assert(t, metav1.IsControlledBy(secret, instance))
+	})
+
+	t.Run("TestReuse", func(t *testing.T) {
+		creds, err := r.ensureAgentCredentials(log, apiClient, instance)
+		assert.NilError(t, err)
+		assert.Equal(t, "secret-1", creds.secret)
+		assert.Equal(t, 1, tokens.issued)
+	})
+
+	t.Run("TestRotateOnBucketsChange", func(t *testing.T) {
+		instance.Spec.Buckets = append(instance.Spec.Buckets, forwardv1.BucketSpec{Name: "b-2"})
+
+		creds, err := r.ensureAgentCredentials(log, apiClient, instance)
+		assert.NilError(t, err)
+		assert.Equal(t, "secret-2", creds.secret)
+
+		secret, err := r.getAgentTokenSecret(instance)
+		assert.NilError(t, err)
+		assert.Equal(t, "b-1,b-2", secret.Annotations[agentTokenBucketsAnnotation])
+		assert.Equal(t, "00000000-0000-0000-0000-000000000001", secret.Annotations[agentTokenPreviousAnnotation])
+	})
+
+	t.Run("TestRevokePrevious", func(t *testing.T) {
+		rolledOut := &appsv1.Deployment{
+			Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		}
+		assert.NilError(t, r.revokePreviousAgentToken(log, apiClient, instance, rolledOut))
+		assert.DeepEqual(t, []string{"00000000-0000-0000-0000-000000000001"}, tokens.revoked)
+
+		secret, err := r.getAgentTokenSecret(instance)
+		assert.NilError(t, err)
+		_, ok := secret.Annotations[agentTokenPreviousAnnotation]
+		assert.Assert(t, !ok)
+		assert.Equal(t, "b-1,b-2", secret.Annotations[agentTokenBucketsAnnotation])
+		assert.Equal(t, "secret-2", string(secret.Data[forwardv1.AccessTokenSecretName]))
+	})
+
+	t.Run("TestRevoke", func(t *testing.T) {
+		assert.NilError(t, r.revokeAgentToken(log, apiClient, instance))
+
+		assert.DeepEqual(t, []string{
+			"00000000-0000-0000-0000-000000000001",
+			"00000000-0000-0000-0000-000000000002",
+		}, tokens.revoked)
+
+		secret, err := r.getAgentTokenSecret(instance)
+		assert.NilError(t, err)
+		assert.Assert(t, secret == nil)
+	})
+}
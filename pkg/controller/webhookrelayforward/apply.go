@@ -0,0 +1,64 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// fieldManager is the server-side apply field manager of the operator. Only fields
+// set by the operator are owned by it, so fields added by other controllers or
+// admission webhooks (i.e. sidecars) are left untouched.
+const fieldManager = "webhookrelay-operator"
+
+// apply creates or updates an object owned by the CR using server-side apply. Object
+// should only have the fields that the operator manages.
+func (r *ReconcileWebhookRelayForward) apply(instance *forwardv1.WebhookRelayForward, obj ownedObject) error {
+	gvk, err := apiutil.GVKForObject(obj, r.scheme)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+
+	if err := controllerutil.SetControllerReference(instance, obj, r.scheme); err != nil {
+		return err
+	}
+
+	return r.client.Patch(context.TODO(), obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// managedFields returns names of the fields owned by the operator field manager under
+// the given path, i.e. "f:metadata", "f:labels" returns label keys applied by the operator
+func managedFields(obj metav1.Object, path ...string) []string {
+	var names []string
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != fieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for _, p := range path {
+			fields, _ = fields[p].(map[string]interface{})
+		}
+		for name := range fields {
+			if strings.HasPrefix(name, "f:") {
+				names = append(names, strings.TrimPrefix(name, "f:"))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,50 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// applyClient handles server-side apply patches that are not supported by the
+// fake client, applied object replaces the stored one
+type applyClient struct {
+	client.Client
+}
+
+func newApplyClient(c client.Client) client.Client {
+	return &applyClient{Client: c}
+}
+
+// applyOnlyClient rejects updates, objects managed by the operator field
+// manager have to be changed through server-side apply
+type applyOnlyClient struct {
+	client.Client
+}
+
+func (c *applyOnlyClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return fmt.Errorf("unexpected update of %T, use server-side apply", obj)
+}
+
+func (c *applyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	meta := obj.(metav1.Object)
+	existing := obj.DeepCopyObject()
+	err := c.Client.Get(ctx, types.NamespacedName{Namespace: meta.GetNamespace(), Name: meta.GetName()}, existing)
+	if errors.IsNotFound(err) {
+		return c.Client.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	meta.SetResourceVersion(existing.(metav1.Object).GetResourceVersion())
+	return c.Client.Update(ctx, obj)
+}
@@ -2,6 +2,7 @@ package webhookrelayforward
 
 import (
 	"sync"
+	"time"
 
 	"github.com/jinzhu/copier"
 	"github.com/webhookrelay/webhookrelay-go"
@@ -10,6 +11,8 @@ import (
 type bucketsCache struct {
 	items map[string]*webhookrelay.Bucket
 	mu    *sync.RWMutex
+	// refreshed is the time when buckets were last listed
+	refreshed time.Time
 }
 
 func newBucketsCache() *bucketsCache {
@@ -23,9 +26,25 @@ func newBucketsCache() *bucketsCache {
 func (c *bucketsCache) Reset() {
 	c.mu.Lock()
 	c.items = make(map[string]*webhookrelay.Bucket)
+	c.refreshed = time.Time{}
 	c.mu.Unlock()
 }
 
+// Invalidate marks cache as stale so the buckets are listed again during
+// the next reconcile, cached entries are kept
+func (c *bucketsCache) Invalidate() {
+	c.mu.Lock()
+	c.refreshed = time.Time{}
+	c.mu.Unlock()
+}
+
+// Stale checks whether buckets were listed longer than maxAge ago
+func (c *bucketsCache) Stale(maxAge time.Duration) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.refreshed.IsZero() || time.Since(c.refreshed) > maxAge
+}
+
 // Set a list of buckets, any previous entries are removed
 func (c *bucketsCache) Set(buckets []*webhookrelay.Bucket) {
 	items := make(map[string]*webhookrelay.Bucket)
@@ -36,39 +55,82 @@ func (c *bucketsCache) Set(buckets []*webhookrelay.Bucket) {
 
 	c.mu.Lock()
 	c.items = items
+	c.refreshed = time.Now()
 	c.mu.Unlock()
 }
 
 // AddOutput if bucket is found, it updates existing output or
-// appends it to the output list.
+// appends it to the output list. Cached buckets are never modified in place
+// as copies returned by Get and List share the output lists with them.
 func (c *bucketsCache) AddOutput(o *webhookrelay.Output) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	for k, bucket := range c.items {
 		if bucket.ID == o.BucketID {
+			updated := *bucket
+			updated.Outputs = make([]*webhookrelay.Output, 0, len(bucket.Outputs)+1)
+
 			// checking outputs
 			var found bool
-			for idx, output := range bucket.Outputs {
+			for _, output := range bucket.Outputs {
 				if output.ID == o.ID {
 					found = true
-					// updating item in the list
-					bucket.Outputs[idx] = o
+					// replacing item in the list
+					output = o
 				}
+				updated.Outputs = append(updated.Outputs, output)
 			}
 
 			if !found {
-				bucket.Outputs = append(bucket.Outputs, o)
+				updated.Outputs = append(updated.Outputs, o)
 			}
-			c.items[k] = bucket
+			c.items[k] = &updated
+		}
+	}
+}
+
+// AddInput if bucket is found, it updates existing input or
+// appends it to the input list. Cached buckets are never modified in place.
+func (c *bucketsCache) AddInput(i *webhookrelay.Input) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, bucket := range c.items {
+		if bucket.ID == i.BucketID {
+			updated := *bucket
+			updated.Inputs = make([]*webhookrelay.Input, 0, len(bucket.Inputs)+1)
+
+			var found bool
+			for _, input := range bucket.Inputs {
+				if input.ID == i.ID {
+					found = true
+					input = i
+				}
+				updated.Inputs = append(updated.Inputs, input)
+			}
+
+			if !found {
+				updated.Inputs = append(updated.Inputs, i)
+			}
+			c.items[k] = &updated
 		}
 	}
 }
 
 // Add a bucket to the cache. Can be used after creation or bucket update
 func (c *bucketsCache) Add(b *webhookrelay.Bucket) {
+	// caller keeps using the bucket, storing a copy
+	cp := *b
+	c.mu.Lock()
+	c.items[b.Name] = &cp
+	c.mu.Unlock()
+}
+
+// Delete removes a bucket from the cache by name
+func (c *bucketsCache) Delete(name string) {
 	c.mu.Lock()
-	c.items[b.Name] = b
+	delete(c.items, name)
 	c.mu.Unlock()
 }
 
@@ -117,7 +179,7 @@ func (c *bucketsCache) List() []*webhookrelay.Bucket {
 
 	for _, v := range c.items {
 		cp := new(webhookrelay.Bucket)
-		err = copier.Copy(v, cp)
+		err = copier.Copy(cp, v)
 		if err != nil {
 			continue
 		}
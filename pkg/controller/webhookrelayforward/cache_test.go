@@ -36,3 +36,50 @@ func TestCache_AddOutput(t *testing.T) {
 		assert.Equal(t, "o-1", name)
 	})
 }
+
+func TestCache_AddInput(t *testing.T) {
+
+	c := newBucketsCache()
+	c.Add(&webhookrelay.Bucket{ID: "foo", Name: "b-1"})
+
+	t.Run("TestAddInput", func(t *testing.T) {
+		c.AddInput(&webhookrelay.Input{ID: "in", BucketID: "foo"})
+
+		assert.Equal(t, 1, len(c.items["b-1"].Inputs))
+	})
+
+	t.Run("TestUpdateInput", func(t *testing.T) {
+		c.AddInput(&webhookrelay.Input{ID: "in", BucketID: "foo", Name: "i-1"})
+
+		assert.Equal(t, 1, len(c.items["b-1"].Inputs))
+		assert.Equal(t, "i-1", c.items["b-1"].Inputs[0].Name)
+	})
+}
+
+func TestCache_CopiesNotModified(t *testing.T) {
+	c := newBucketsCache()
+	c.Set([]*webhookrelay.Bucket{{
+		ID:      "foo",
+		Name:    "b-1",
+		Outputs: make([]*webhookrelay.Output, 1, 2),
+		Inputs:  []*webhookrelay.Input{{ID: "in", BucketID: "foo", Name: "i-1"}},
+	}})
+	c.items["b-1"].Outputs[0] = &webhookrelay.Output{ID: "out", BucketID: "foo", Name: "o-1"}
+
+	listed := c.List()
+
+	// buckets returned to callers are read without the lock
+	c.AddOutput(&webhookrelay.Output{ID: "out", BucketID: "foo", Name: "o-2"})
+	c.AddOutput(&webhookrelay.Output{ID: "out-2", BucketID: "foo", Name: "o-3"})
+	c.AddInput(&webhookrelay.Input{ID: "in", BucketID: "foo", Name: "i-2"})
+
+	assert.Equal(t, 1, len(listed[0].Outputs))
+	assert.Equal(t, "o-1", listed[0].Outputs[0].Name)
+	assert.Equal(t, "i-1", listed[0].Inputs[0].Name)
+
+	bucket, ok := c.Get("b-1")
+	assert.Assert(t, ok)
+	assert.Equal(t, 2, len(bucket.Outputs))
+	assert.Equal(t, "o-2", bucket.Outputs[0].Name)
+	assert.Equal(t, "i-2", bucket.Inputs[0].Name)
+}
@@ -0,0 +1,85 @@
+package webhookrelayforward
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// clientIdleTimeout - clients that weren't used for this long are removed from
+// the pool, i.e. after credentials were rotated
+const clientIdleTimeout = time.Hour
+
+// clientPool shares Webhook Relay API clients and their bucket caches between
+// CRs that use the same credentials. Safe for concurrent use.
+type clientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+
+	// refreshInterval - how long listed buckets are reused
+	// before they are listed again
+	refreshInterval time.Duration
+}
+
+type pooledClient struct {
+	client   *WebhookRelayClient
+	lastUsed time.Time
+}
+
+func newClientPool(refreshInterval time.Duration) *clientPool {
+	return &clientPool{
+		clients:         make(map[string]*pooledClient),
+		refreshInterval: refreshInterval,
+	}
+}
+
+// get returns a client for the credentials, creating it if there's none yet
+func (p *clientPool) get(key, secret string) (*WebhookRelayClient, error) {
+	id := credentialsID(key, secret)
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.prune(now)
+
+	if pooled, ok := p.clients[id]; ok {
+		pooled.lastUsed = now
+		return pooled.client, nil
+	}
+
+	apiClient, rateLimit, err := newAPIClient(key, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &WebhookRelayClient{
+		client: apiClient,
+		// setting credentials that can be reused for deployments
+		accessTokenKey:    key,
+		accessTokenSecret: secret,
+		bucketsCache:      newBucketsCache(),
+		refreshInterval:   p.refreshInterval,
+		rateLimit:         rateLimit,
+	}
+	p.clients[id] = &pooledClient{client: c, lastUsed: now}
+
+	return c, nil
+}
+
+// prune removes idle clients, must be called with the lock held
+func (p *clientPool) prune(now time.Time) {
+	for id, pooled := range p.clients {
+		if now.Sub(pooled.lastUsed) > clientIdleTimeout {
+			delete(p.clients, id)
+		}
+	}
+}
+
+// credentialsID identifies credentials without keeping the secret
+// in the map keys
+func credentialsID(key, secret string) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package webhookrelayforward
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestClientPool(t *testing.T) {
+	p := newClientPool(time.Minute)
+
+	first, err := p.get("key", "secret")
+	assert.NilError(t, err)
+
+	t.Run("TestSameCredentials", func(t *testing.T) {
+		c, err := p.get("key", "secret")
+		assert.NilError(t, err)
+		assert.Assert(t, first == c)
+		assert.Assert(t, first.bucketsCache == c.bucketsCache)
+	})
+
+	t.Run("TestRotatedSecret", func(t *testing.T) {
+		c, err := p.get("key", "new-secret")
+		assert.NilError(t, err)
+		assert.Assert(t, first != c)
+		assert.Equal(t, "new-secret", c.accessTokenSecret)
+	})
+
+	t.Run("TestIdleClientsRemoved", func(t *testing.T) {
+		p.prune(time.Now().Add(2 * clientIdleTimeout))
+		assert.Equal(t, 0, len(p.clients))
+	})
+}
+
+func TestBucketsCache_Stale(t *testing.T) {
+	c := newBucketsCache()
+	assert.Assert(t, c.Stale(time.Minute))
+
+	c.Set(nil)
+	assert.Assert(t, !c.Stale(time.Minute))
+
+	c.Invalidate()
+	assert.Assert(t, c.Stale(time.Minute))
+}
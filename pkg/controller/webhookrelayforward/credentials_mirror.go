@@ -0,0 +1,116 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// credentialsSecretNamespace returns the namespace of the access token secret
+func credentialsSecretNamespace(instance *forwardv1.WebhookRelayForward) string {
+	if instance.Spec.SecretRefNamespace == "" {
+		// defaulting to CR namespace
+		return instance.GetNamespace()
+	}
+	return instance.Spec.SecretRefNamespace
+}
+
+// credentialsMirrored checks whether the agent credentials have to be copied into an operator
+// managed secret in the CR namespace. Pods can only reference secrets from their own namespace,
+// and operator credentials are never inlined into the deployment so they can't be
+// read by anyone with access to deployments. Nothing is mirrored when the agent uses a scoped
+// token, full access credentials never leave their namespace then.
+func credentialsMirrored(instance *forwardv1.WebhookRelayForward) bool {
+	if agentTokenProvisioned(instance) {
+		return false
+	}
+	return instance.Spec.SecretRefName == "" ||
+		credentialsSecretNamespace(instance) != instance.GetNamespace()
+}
+
+// credentialsSource describes where the mirrored credentials come from, used for logging
+func credentialsSource(instance *forwardv1.WebhookRelayForward) string {
+	if instance.Spec.SecretRefName == "" {
+		return "operator configuration"
+	}
+	return types.NamespacedName{Namespace: credentialsSecretNamespace(instance), Name: instance.Spec.SecretRefName}.String()
+}
+
+// mirroredCredentialsName is the name of the secret with access token copied from another
+// namespace or from the operator configuration
+func mirroredCredentialsName(instance *forwardv1.WebhookRelayForward) string {
+	return instance.GetName() + "-whr-credentials"
+}
+
+// agentCredentialsSecretName returns the name of the secret that the agent deployment should use
+func agentCredentialsSecretName(instance *forwardv1.WebhookRelayForward) string {
+	if credentialsMirrored(instance) {
+		return mirroredCredentialsName(instance)
+	}
+	return instance.Spec.SecretRefName
+}
+
+// ensureCredentialsMirror copies the access token secret from another namespace or the operator
+// credentials into the CR namespace and keeps it in sync. Mirror is removed if it's no longer needed.
+func (r *ReconcileWebhookRelayForward) ensureCredentialsMirror(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) error {
+	existing := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{
+		Namespace: instance.GetNamespace(),
+		Name:      mirroredCredentialsName(instance),
+	}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if !credentialsMirrored(instance) {
+		if found && metav1.IsControlledBy(existing, instance) {
+			logger.Info("Deleting mirrored credentials secret, no longer needed", "Secret.Name", existing.Name)
+			return r.client.Delete(context.TODO(), existing)
+		}
+		return nil
+	}
+
+	// apiClient already holds the credentials read from the source secret
+	// or the operator configuration
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mirroredCredentialsName(instance),
+			Namespace: instance.GetNamespace(),
+			Labels: map[string]string{
+				"app": instance.GetName(),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			forwardv1.AccessTokenKeyName:    []byte(apiClient.accessTokenKey),
+			forwardv1.AccessTokenSecretName: []byte(apiClient.accessTokenSecret),
+		},
+	}
+	if !found {
+		logger.Info("Mirroring credentials secret",
+			"source", credentialsSource(instance),
+			"Secret.Name", desired.Name,
+		)
+		return r.apply(instance, desired)
+	}
+
+	if !metav1.IsControlledBy(existing, instance) {
+		return fmt.Errorf("secret '%s' already exists and is not managed by this CR", existing.Name)
+	}
+
+	if string(existing.Data[forwardv1.AccessTokenKeyName]) == apiClient.accessTokenKey &&
+		string(existing.Data[forwardv1.AccessTokenSecretName]) == apiClient.accessTokenSecret {
+		return nil
+	}
+
+	logger.Info("Updating mirrored credentials secret", "Secret.Name", existing.Name)
+	return r.apply(instance, desired)
+}
@@ -0,0 +1,171 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestEnsureCredentialsMirror(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			SecretRefName:      "whr-credentials",
+			SecretRefNamespace: "secrets",
+		},
+	}
+
+	r := &ReconcileWebhookRelayForward{
+		client: newApplyClient(fake.NewFakeClientWithScheme(s, instance)),
+		scheme: s,
+	}
+	mirrorName := types.NamespacedName{Namespace: "default", Name: "fwd-whr-credentials"}
+
+	t.Run("TestCreate", func(t *testing.T) {
+		err := r.ensureCredentialsMirror(log, &WebhookRelayClient{accessTokenKey: "key", accessTokenSecret: "secret"}, instance)
+		assert.NilError(t, err)
+
+		mirror := &corev1.Secret{}
+		assert.NilError(t, r.client.Get(context.TODO(), mirrorName, mirror))
+		assert.Equal(t, "secret", string(mirror.Data[forwardv1.AccessTokenSecretName]))
+		assert.Assert(t, metav1.IsControlledBy(mirror, instance))
+		assert.Equal(t, "fwd-whr-credentials", agentCredentialsSecretName(instance))
+	})
+
+	t.Run("TestRotate", func(t *testing.T) {
+		err := r.ensureCredentialsMirror(log, &WebhookRelayClient{accessTokenKey: "key", accessTokenSecret: "rotated"}, instance)
+		assert.NilError(t, err)
+
+		mirror := &corev1.Secret{}
+		assert.NilError(t, r.client.Get(context.TODO(), mirrorName, mirror))
+		assert.Equal(t, "rotated", string(mirror.Data[forwardv1.AccessTokenSecretName]))
+	})
+
+	t.Run("TestNoLongerNeeded", func(t *testing.T) {
+		sameNamespace := instance.DeepCopy()
+		sameNamespace.Spec.SecretRefNamespace = ""
+
+		err := r.ensureCredentialsMirror(log, &WebhookRelayClient{}, sameNamespace)
+		assert.NilError(t, err)
+
+		err = r.client.Get(context.TODO(), mirrorName, &corev1.Secret{})
+		assert.Assert(t, errors.IsNotFound(err))
+		assert.Equal(t, "whr-credentials", agentCredentialsSecretName(sameNamespace))
+	})
+
+	t.Run("TestOperatorCredentials", func(t *testing.T) {
+		operatorCredentials := instance.DeepCopy()
+		operatorCredentials.Spec.SecretRefName = ""
+		operatorCredentials.Spec.SecretRefNamespace = ""
+
+		err := r.ensureCredentialsMirror(log, &WebhookRelayClient{accessTokenKey: "key", accessTokenSecret: "operator"}, operatorCredentials)
+		assert.NilError(t, err)
+
+		mirror := &corev1.Secret{}
+		assert.NilError(t, r.client.Get(context.TODO(), mirrorName, mirror))
+		assert.Equal(t, "operator", string(mirror.Data[forwardv1.AccessTokenSecretName]))
+		assert.Equal(t, "fwd-whr-credentials", agentCredentialsSecretName(operatorCredentials))
+	})
+
+	t.Run("TestScopedAgentToken", func(t *testing.T) {
+		scoped := instance.DeepCopy()
+		scoped.Spec.AgentToken = &forwardv1.AgentTokenSpec{Provision: true}
+
+		err := r.ensureCredentialsMirror(log, &WebhookRelayClient{accessTokenKey: "key", accessTokenSecret: "operator"}, scoped)
+		assert.NilError(t, err)
+
+		// agent uses the scoped token, full access credentials are not copied
+		err = r.client.Get(context.TODO(), mirrorName, &corev1.Secret{})
+		assert.Assert(t, errors.IsNotFound(err))
+	})
+
+	t.Run("TestAccount", func(t *testing.T) {
+		account := instance.DeepCopy()
+		account.Spec.SecretRefName = ""
+		account.Spec.SecretRefNamespace = ""
+		account.Spec.AccountRef = &forwardv1.AccountReference{Name: "team-a"}
+
+		// account credentials are never copied, agent always gets a scoped token
+		assert.Assert(t, agentTokenProvisioned(account))
+
+		err := r.ensureCredentialsMirror(log, &WebhookRelayClient{accessTokenKey: "key", accessTokenSecret: "account"}, account)
+		assert.NilError(t, err)
+
+		err = r.client.Get(context.TODO(), mirrorName, &corev1.Secret{})
+		assert.Assert(t, errors.IsNotFound(err))
+	})
+}
+
+func TestClientForCR_SecretFromAnotherNamespace(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			SecretRefName:      "whr-credentials",
+			SecretRefNamespace: "secrets",
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "whr-credentials", Namespace: "secrets"},
+		Data: map[string][]byte{
+			forwardv1.AccessTokenKeyName:    []byte("key"),
+			forwardv1.AccessTokenSecretName: []byte("secret"),
+		},
+	}
+
+	// cache only holds the CR namespace
+	r := &ReconcileWebhookRelayForward{
+		client:    fake.NewFakeClientWithScheme(s, instance),
+		apiReader: fake.NewFakeClientWithScheme(s, secret),
+		clients:   newClientPool(0),
+		config:    &config.Config{},
+	}
+
+	apiClient, err := r.clientForCR(instance)
+	assert.NilError(t, err)
+	assert.Equal(t, "key", apiClient.accessTokenKey)
+}
+
+func TestClientForCR_AccountSecret(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	account, secret := newTestAccount()
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "team-a"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			AccountRef: &forwardv1.AccountReference{Name: account.GetName()},
+		},
+	}
+
+	// account secret is in the operator namespace which isn't cached
+	r := &ReconcileWebhookRelayForward{
+		client:    fake.NewFakeClientWithScheme(s, instance, account),
+		apiReader: fake.NewFakeClientWithScheme(s, secret),
+		clients:   newClientPool(0),
+		config:    &config.Config{},
+	}
+
+	apiClient, err := r.clientForCR(instance)
+	assert.NilError(t, err)
+	assert.Equal(t, "key", apiClient.accessTokenKey)
+}
@@ -0,0 +1,106 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// legacyAgentLabel marks replica sets of agent deployments that were replaced because
+// of a selector change. Their pods keep forwarding until the new deployment is rolled out.
+const legacyAgentLabel = "forward.webhookrelay.com/legacy-agent"
+
+// legacyPodLabel was the selector of all agent deployments before
+// selectors were unique per CR
+const legacyPodLabel = "name"
+
+// selectorChanged checks whether the deployment selector differs from the desired one.
+// Selectors are immutable so such deployment has to be recreated.
+func selectorChanged(current, desired *appsv1.Deployment) bool {
+	return !equality.Semantic.DeepEqual(current.Spec.Selector, desired.Spec.Selector)
+}
+
+// replaceDeployment starts the cutover of a deployment with an outdated selector. Its replica
+// sets are detached so that no other deployment adopts them and the deployment is deleted
+// without its pods. A new deployment is created during the next reconcile and the old pods
+// are removed by cleanupLegacyAgents once it's rolled out.
+func (r *ReconcileWebhookRelayForward) replaceDeployment(logger logr.Logger, instance *forwardv1.WebhookRelayForward, current *appsv1.Deployment) error {
+	if current.GetDeletionTimestamp() != nil {
+		// already being deleted, waiting for the garbage collector
+		return nil
+	}
+
+	replicaSets := &appsv1.ReplicaSetList{}
+	err := r.client.List(context.TODO(), replicaSets, client.InNamespace(current.Namespace))
+	if err != nil {
+		return fmt.Errorf("failed to list replica sets: %w", err)
+	}
+
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(rs, current) {
+			continue
+		}
+		patch := client.MergeFrom(rs.DeepCopy())
+		if rs.Labels == nil {
+			rs.Labels = make(map[string]string)
+		}
+		// legacy deployments of other CRs would adopt the replica set
+		// if it kept the shared label
+		delete(rs.Labels, legacyPodLabel)
+		rs.Labels[legacyAgentLabel] = instance.GetName()
+		if err := r.client.Patch(context.TODO(), rs, patch); err != nil {
+			return fmt.Errorf("failed to detach replica set '%s': %w", rs.Name, err)
+		}
+	}
+
+	logger.Info("Deployment selector has changed, recreating Deployment", "Deployment.Name", current.Name)
+	r.recorder.Event(instance, corev1.EventTypeNormal, "RecreatingDeployment",
+		fmt.Sprintf("Deployment '%s' selector has changed, existing agents keep running until the new Deployment is ready", current.Name))
+
+	err = r.client.Delete(context.TODO(), current, client.PropagationPolicy(metav1.DeletePropagationOrphan))
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Deployment: %w", err)
+	}
+	return nil
+}
+
+// cleanupLegacyAgents removes replica sets detached by replaceDeployment once the
+// new deployment is rolled out
+func (r *ReconcileWebhookRelayForward) cleanupLegacyAgents(logger logr.Logger, instance *forwardv1.WebhookRelayForward, deployment *appsv1.Deployment) error {
+	if !deploymentRolledOut(deployment) {
+		return nil
+	}
+
+	replicaSets := &appsv1.ReplicaSetList{}
+	err := r.client.List(context.TODO(), replicaSets,
+		client.InNamespace(instance.GetNamespace()),
+		client.MatchingLabels{legacyAgentLabel: instance.GetName()},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to list replica sets: %w", err)
+	}
+
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		// replica set might have been adopted by something else in the meantime
+		if metav1.GetControllerOf(rs) != nil {
+			continue
+		}
+		logger.Info("Deleting replaced agent replica set", "ReplicaSet.Name", rs.Name)
+		err = r.client.Delete(context.TODO(), rs, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete replica set '%s': %w", rs.Name, err)
+		}
+	}
+	return nil
+}
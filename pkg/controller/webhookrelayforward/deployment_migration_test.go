@@ -0,0 +1,84 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestReplaceDeployment(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, appsv1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+	}
+	r := &ReconcileWebhookRelayForward{
+		config:   &config.Config{Image: "webhookrelay/webhookrelayd"},
+		scheme:   s,
+		recorder: record.NewFakeRecorder(10),
+	}
+	creds := &agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}
+
+	// deployment created by an older operator version
+	legacySelector := map[string]string{legacyPodLabel: "webhookrelay-forwarder"}
+	legacy := r.newDeploymentForCR(creds, instance)
+	legacy.UID = "5678"
+	legacy.Spec.Selector = &metav1.LabelSelector{MatchLabels: legacySelector}
+	legacy.Spec.Template.Labels = legacySelector
+
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fwd-whr-deployment-abc",
+			Namespace: "default",
+			Labels:    map[string]string{legacyPodLabel: "webhookrelay-forwarder", "pod-template-hash": "abc"},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(legacy, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+			},
+		},
+	}
+
+	r.client = fake.NewFakeClientWithScheme(s, instance, legacy, rs)
+
+	assert.Assert(t, selectorChanged(legacy, r.newDeploymentForCR(creds, instance)))
+	assert.NilError(t, r.replaceDeployment(log, instance, legacy))
+
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: legacy.Name}, &appsv1.Deployment{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	detached := &appsv1.ReplicaSet{}
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: rs.Name}, detached))
+	assert.Equal(t, "fwd", detached.Labels[legacyAgentLabel])
+	_, ok := detached.Labels[legacyPodLabel]
+	assert.Assert(t, !ok)
+
+	// garbage collector removes owner references of orphaned objects
+	detached.OwnerReferences = nil
+	assert.NilError(t, r.client.Update(context.TODO(), detached))
+
+	deployment := r.newDeploymentForCR(creds, instance)
+
+	// new deployment is not ready yet
+	assert.NilError(t, r.cleanupLegacyAgents(log, instance, deployment))
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: rs.Name}, &appsv1.ReplicaSet{}))
+
+	deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	assert.NilError(t, r.cleanupLegacyAgents(log, instance, deployment))
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: rs.Name}, &appsv1.ReplicaSet{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
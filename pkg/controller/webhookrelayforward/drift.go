@@ -0,0 +1,184 @@
+package webhookrelayforward
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// maxDriftChanges limits how many changes are kept in the status
+const maxDriftChanges = 20
+
+// driftFieldDeleted is reported instead of the fields when an input or output
+// was deleted outside of the operator and created again
+const driftFieldDeleted = "deleted"
+
+// driftChange is a bucket, input or output that didn't match the spec, fields
+// are named after the spec fields
+type driftChange struct {
+	kind   routingObjectKind
+	bucket string
+	name   string
+	fields []string
+}
+
+func (c *driftChange) String() string {
+	if c.kind == kindBucket {
+		return fmt.Sprintf("bucket '%s': %s", c.bucket, strings.Join(c.fields, ", "))
+	}
+	return fmt.Sprintf("%s '%s' in bucket '%s': %s", strings.ToLower(string(c.kind)), c.name, c.bucket, strings.Join(c.fields, ", "))
+}
+
+// diffBucket returns bucket fields that don't match the spec. Authentication is
+// only compared if it's managed by the operator.
+func diffBucket(spec *forwardv1.BucketSpec, auth *webhookrelay.BucketAuth, bucket *webhookrelay.Bucket) []string {
+	var fields []string
+	if spec.Description != bucket.Description {
+		fields = append(fields, "description")
+	}
+	if auth != nil && !bucketAuthEqual(&bucket.Auth, auth) {
+		fields = append(fields, "auth")
+	}
+	return fields
+}
+
+// diffInput returns input fields that don't match the desired input
+func diffInput(current, desired *webhookrelay.Input) []string {
+	var fields []string
+	if current.FunctionID != desired.FunctionID {
+		fields = append(fields, "functionId")
+	}
+	if !headersEqual(current.Headers, desired.Headers) {
+		fields = append(fields, "responseHeaders")
+	}
+	if current.StatusCode != desired.StatusCode {
+		fields = append(fields, "responseStatusCode")
+	}
+	if current.Body != desired.Body {
+		fields = append(fields, "responseBody")
+	}
+	if current.ResponseFromOutput != desired.ResponseFromOutput {
+		fields = append(fields, "responseFromOutput")
+	}
+	if current.CustomDomain != desired.CustomDomain {
+		fields = append(fields, "customDomain")
+	}
+	if current.PathPrefix != desired.PathPrefix {
+		fields = append(fields, "pathPrefix")
+	}
+	if current.Description != desired.Description {
+		fields = append(fields, "description")
+	}
+	return fields
+}
+
+// diffOutput returns output fields that don't match the desired output
+func diffOutput(current, desired *webhookrelay.Output) []string {
+	var fields []string
+	if current.FunctionID != desired.FunctionID {
+		fields = append(fields, "function_id")
+	}
+	if !headersEqual(current.Headers, desired.Headers) {
+		fields = append(fields, "overrideHeaders")
+	}
+	if current.Destination != desired.Destination {
+		fields = append(fields, "destination")
+	}
+	if current.Internal != desired.Internal {
+		fields = append(fields, "internal")
+	}
+	if current.Timeout != desired.Timeout {
+		fields = append(fields, "timeout")
+	}
+	if current.Description != desired.Description {
+		fields = append(fields, "description")
+	}
+	return fields
+}
+
+// headersEqual compares headers, nil and empty headers are equal
+func headersEqual(current, desired map[string][]string) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	for k, v := range desired {
+		c, ok := current[k]
+		if !ok || !sliceEqual(c, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDrift checks whether the object was already synced with the current spec, otherwise the
+// difference comes from a spec change or adoption rather than an out-of-band change
+func isDrift(instance *forwardv1.WebhookRelayForward, change *driftChange) bool {
+	if instance.Status.ObservedGeneration != instance.GetGeneration() {
+		return false
+	}
+	for i := range instance.Status.Buckets {
+		bucket := &instance.Status.Buckets[i]
+		if bucket.Name != change.bucket {
+			continue
+		}
+		switch change.kind {
+		case kindBucket:
+			return bucket.State == forwardv1.SyncStateSynced
+		case kindInput:
+			for _, input := range bucket.Inputs {
+				if input.Name == change.name {
+					return input.State == forwardv1.SyncStateSynced
+				}
+			}
+		case kindOutput:
+			for _, output := range bucket.Outputs {
+				if output.Name == change.name {
+					return output.State == forwardv1.SyncStateSynced
+				}
+			}
+		}
+	}
+	return false
+}
+
+// setDriftStatus records changes that were changed back during this reconcile, previous
+// report is kept if nothing has drifted
+func setDriftStatus(status *forwardv1.WebhookRelayForwardStatus, changes []driftChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	drift := &forwardv1.DriftStatus{}
+	if status.Drift != nil {
+		drift.Corrections = status.Drift.Corrections
+	}
+	now := metav1.Now()
+	drift.LastDetectedTime = &now
+	drift.Corrections += int64(len(changes))
+
+	for i := range changes {
+		if i == maxDriftChanges {
+			break
+		}
+		drift.Changes = append(drift.Changes, forwardv1.DriftChange{
+			Kind:   string(changes[i].kind),
+			Bucket: changes[i].bucket,
+			Name:   changes[i].name,
+			Fields: changes[i].fields,
+		})
+	}
+	status.Drift = drift
+}
+
+// recordDriftEvents emits an event for every object that was changed back to match the spec
+func (r *ReconcileWebhookRelayForward) recordDriftEvents(instance *forwardv1.WebhookRelayForward, result *routingResult) {
+	for i := range result.drift {
+		r.recorder.Event(instance, corev1.EventTypeNormal, "DriftCorrected",
+			"Changed outside of the operator, restored "+result.drift[i].String())
+	}
+}
@@ -0,0 +1,136 @@
+package webhookrelayforward
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestDiffInput(t *testing.T) {
+	desired := &webhookrelay.Input{
+		Name:       "in",
+		Headers:    map[string][]string{"X-Custom": {"a"}},
+		StatusCode: 200,
+		PathPrefix: "/gh",
+	}
+
+	current := *desired
+	assert.Equal(t, 0, len(diffInput(&current, desired)))
+
+	// same number of headers, different values
+	current.Headers = map[string][]string{"X-Custom": {"b"}}
+	current.PathPrefix = ""
+	assert.DeepEqual(t, []string{"responseHeaders", "pathPrefix"}, diffInput(&current, desired))
+}
+
+func TestDiffOutput(t *testing.T) {
+	desired := &webhookrelay.Output{
+		Name:        "out",
+		Headers:     map[string][]string{},
+		Destination: "http://svc",
+		Internal:    true,
+	}
+
+	// nil and empty headers are the same
+	current := *desired
+	current.Headers = nil
+	assert.Equal(t, 0, len(diffOutput(&current, desired)))
+
+	current.Headers = map[string][]string{"Authorization": {"token"}}
+	current.Destination = "http://other"
+	current.Internal = false
+	assert.DeepEqual(t, []string{"overrideHeaders", "destination", "internal"}, diffOutput(&current, desired))
+}
+
+func TestIsDrift(t *testing.T) {
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Generation: 2},
+		Status: forwardv1.WebhookRelayForwardStatus{
+			ObservedGeneration: 2,
+			Buckets: []forwardv1.BucketStatus{{
+				Name:    "b-1",
+				State:   forwardv1.SyncStateSynced,
+				Outputs: []forwardv1.OutputStatus{{Name: "out", State: forwardv1.SyncStateSynced}},
+				Inputs:  []forwardv1.InputStatus{{Name: "in", State: forwardv1.SyncStateFailed}},
+			}},
+		},
+	}
+
+	assert.Assert(t, isDrift(instance, &driftChange{kind: kindBucket, bucket: "b-1"}))
+	assert.Assert(t, isDrift(instance, &driftChange{kind: kindOutput, bucket: "b-1", name: "out"}))
+	// failed inputs weren't synced
+	assert.Assert(t, !isDrift(instance, &driftChange{kind: kindInput, bucket: "b-1", name: "in"}))
+	assert.Assert(t, !isDrift(instance, &driftChange{kind: kindBucket, bucket: "b-2"}))
+
+	// spec was changed
+	instance.Generation = 3
+	assert.Assert(t, !isDrift(instance, &driftChange{kind: kindBucket, bucket: "b-1"}))
+}
+
+func TestSetDriftStatus(t *testing.T) {
+	status := &forwardv1.WebhookRelayForwardStatus{}
+
+	setDriftStatus(status, nil)
+	assert.Assert(t, status.Drift == nil)
+
+	setDriftStatus(status, []driftChange{{kind: kindOutput, bucket: "b-1", name: "out", fields: []string{"destination"}}})
+	assert.Equal(t, int64(1), status.Drift.Corrections)
+	assert.Equal(t, "Output", status.Drift.Changes[0].Kind)
+
+	setDriftStatus(status, []driftChange{
+		{kind: kindBucket, bucket: "b-1", fields: []string{"description"}},
+		{kind: kindInput, bucket: "b-1", name: "in", fields: []string{"responseBody"}},
+	})
+	assert.Equal(t, int64(3), status.Drift.Corrections)
+	assert.Equal(t, 2, len(status.Drift.Changes))
+	assert.Equal(t, "input 'in' in bucket 'b-1': responseBody", (&driftChange{kind: kindInput, bucket: "b-1", name: "in", fields: []string{"responseBody"}}).String())
+
+	// report is kept until something drifts again
+	setDriftStatus(status, nil)
+	assert.Equal(t, 2, len(status.Drift.Changes))
+}
+
+func TestEnsureBucketOutputs_DeletedOutOfBand(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var created webhookrelay.Output
+		assert.NilError(t, json.NewDecoder(req.Body).Decode(&created))
+		created.ID = testOutputID
+		assert.NilError(t, json.NewEncoder(w).Encode(&created))
+	}))
+	defer srv.Close()
+
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+	r := &ReconcileWebhookRelayForward{}
+	apiClient := newTestAPIClient(t, srv)
+	apiClient.bucketsCache.Add(&webhookrelay.Bucket{ID: testBucketID, Name: "b-1"})
+
+	_, changes, errs := r.ensureBucketOutputs(log, apiClient, o, &forwardv1.BucketSpec{
+		Name:    "b-1",
+		Outputs: []forwardv1.OutputSpec{{Name: "out", Destination: "http://localhost"}},
+	})
+	assert.Equal(t, 0, len(errs))
+	assert.DeepEqual(t, []string{driftFieldDeleted}, changes[0].fields)
+	assert.Equal(t, "output 'out' in bucket 'b-1': deleted", changes[0].String())
+
+	// only reported as drift if the output was synced before
+	instance := &forwardv1.WebhookRelayForward{
+		Status: forwardv1.WebhookRelayForwardStatus{
+			Buckets: []forwardv1.BucketStatus{{
+				Name:    "b-1",
+				Outputs: []forwardv1.OutputStatus{{Name: "out", State: forwardv1.SyncStateSynced}},
+			}},
+		},
+	}
+	assert.Assert(t, isDrift(instance, &changes[0]))
+
+	instance.Status.Buckets[0].Outputs = nil
+	assert.Assert(t, !isDrift(instance, &changes[0]))
+}
@@ -0,0 +1,333 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// webhookRelayForwardFinalizer is set on every CR so the operator gets a chance
+// to clean up Webhook Relay configuration before the CR is removed
+const webhookRelayForwardFinalizer = "finalizer.forward.webhookrelay.com"
+
+// ensureFinalizer adds the finalizer to the CR if it's not there yet. Returns
+// true if the CR was updated.
+func (r *ReconcileWebhookRelayForward) ensureFinalizer(logger logr.Logger, instance *forwardv1.WebhookRelayForward) (bool, error) {
+	if hasFinalizer(instance) {
+		return false, nil
+	}
+
+	patch := instance.DeepCopy()
+	controllerutil.AddFinalizer(patch, webhookRelayForwardFinalizer)
+
+	logger.Info("Adding finalizer")
+
+	err := r.client.Patch(context.TODO(), patch, client.MergeFrom(instance))
+	return true, err
+}
+
+// removeFinalizer removes the finalizer from the CR, allowing Kubernetes
+// to delete it
+func (r *ReconcileWebhookRelayForward) removeFinalizer(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+	patch := instance.DeepCopy()
+	controllerutil.RemoveFinalizer(patch, webhookRelayForwardFinalizer)
+
+	logger.Info("Removing finalizer")
+
+	return r.client.Patch(context.TODO(), patch, client.MergeFrom(instance))
+}
+
+// reconcileDelete runs the cleanup for a CR that is being deleted and releases it
+// by removing the finalizer
+func (r *ReconcileWebhookRelayForward) reconcileDelete(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+	if !hasFinalizer(instance) {
+		// nothing to do, waiting for Kubernetes to remove the CR
+		return nil
+	}
+
+	status := instance.Status.DeepCopy()
+	setAgentStatus(status, instance.GetGeneration(), forwardv1.AgentStatusTerminating, false,
+		forwardv1.ReasonTerminating, "CR is being deleted")
+	setReadyCondition(status, instance.GetGeneration())
+	if updateErr := r.updateStatus(logger, instance, status); updateErr != nil {
+		logger.Error(updateErr, "Failed to update CR status",
+			"status", forwardv1.AgentStatusTerminating,
+		)
+	}
+
+	tokenSecret, err := r.getAgentTokenSecret(instance)
+	if err != nil {
+		return err
+	}
+	cleanupRouting := instance.Spec.DeletionPolicy == forwardv1.DeletionPolicyDeleteOutputs ||
+		instance.Spec.DeletionPolicy == forwardv1.DeletionPolicyDeleteAll
+	if tokenSecret == nil && !cleanupRouting {
+		return r.removeFinalizer(logger, instance)
+	}
+
+	if planMode(instance) {
+		// nothing is removed in Plan mode, cleanup is only reported
+		r.planCleanup(logger, instance, tokenSecret, cleanupRouting)
+		return r.removeFinalizer(logger, instance)
+	}
+
+	apiClient, err := r.clientForCR(instance)
+	if err != nil {
+		if !isCredentialsNotFound(err) {
+			return fmt.Errorf("failed to configure Webhook Relay API client for cleanup: %w", err)
+		}
+		// credentials secret is usually removed first when the namespace is deleted,
+		// retrying would keep the CR in Terminating state forever
+		logger.Info("Credentials not found, skipping cleanup", "error", err.Error())
+		r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupSkipped",
+			fmt.Sprintf("Agent token and routing configuration were not cleaned up: %s", err))
+		return r.removeFinalizer(logger, instance)
+	}
+
+	// agent token is revoked regardless of the deletion policy
+	if err := r.revokeAgentToken(logger, apiClient, instance); err != nil {
+		return err
+	}
+
+	if cleanupRouting {
+		if err := r.finalize(logger, apiClient, instance); err != nil {
+			return err
+		}
+		r.recorder.Event(instance, corev1.EventTypeNormal, "CleanedUp",
+			fmt.Sprintf("Routing configuration removed according to '%s' deletion policy", instance.Spec.DeletionPolicy))
+	}
+
+	return r.removeFinalizer(logger, instance)
+}
+
+func hasFinalizer(instance *forwardv1.WebhookRelayForward) bool {
+	for _, f := range instance.GetFinalizers() {
+		if f == webhookRelayForwardFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// finalize cleans up Webhook Relay buckets, inputs and outputs based on the CR deletion policy
+func (r *ReconcileWebhookRelayForward) finalize(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) error {
+	buckets, err := apiClient.client.ListBuckets(&webhookrelay.BucketListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list buckets, error: %w", err)
+	}
+
+	var errors []string
+
+	for i := range instance.Spec.Buckets {
+		bucket, ok := getBucketByName(instance.Spec.Buckets[i].Name, buckets)
+		if !ok {
+			// nothing to clean up
+			continue
+		}
+
+		err = r.cleanupBucket(logger, apiClient, ownerForCR(instance), instance.Spec.DeletionPolicy, &instance.Spec.Buckets[i], bucket)
+		if err != nil {
+			r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupFailed", err.Error())
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to clean up one or more buckets: %s", strings.Join(errors, ", "))
+	}
+
+	return nil
+}
+
+// planCleanup reports what would be removed in Apply mode through events. Failures
+// are only reported as deletion of the CR shouldn't be blocked in Plan mode.
+func (r *ReconcileWebhookRelayForward) planCleanup(logger logr.Logger, instance *forwardv1.WebhookRelayForward, tokenSecret *corev1.Secret, cleanupRouting bool) {
+	if tokenSecret != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupSkipped",
+			fmt.Sprintf("Plan mode: agent token from secret '%s' was not revoked", tokenSecret.Name))
+	}
+	if !cleanupRouting {
+		return
+	}
+
+	actions, err := r.planFinalize(logger, instance)
+	if err != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupSkipped",
+			fmt.Sprintf("Plan mode: failed to plan routing configuration cleanup: %s", err))
+		return
+	}
+
+	r.recorder.Event(instance, corev1.EventTypeNormal, "CleanupPlanned",
+		fmt.Sprintf("Plan mode: routing configuration was not removed, '%s' deletion policy would remove: %s",
+			instance.Spec.DeletionPolicy, planSummary(actions)))
+	for i := range actions {
+		r.recorder.Event(instance, corev1.EventTypeNormal, "Planned"+actions[i].op+string(actions[i].kind), actions[i].String())
+	}
+}
+
+// planFinalize returns what finalize would remove, without modifying the configuration
+func (r *ReconcileWebhookRelayForward) planFinalize(logger logr.Logger, instance *forwardv1.WebhookRelayForward) ([]plannedAction, error) {
+	apiClient, err := r.clientForCR(instance)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := apiClient.client.ListBuckets(&webhookrelay.BucketListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buckets, error: %w", err)
+	}
+
+	var actions []plannedAction
+	for i := range instance.Spec.Buckets {
+		bucket, ok := getBucketByName(instance.Spec.Buckets[i].Name, buckets)
+		if !ok {
+			continue
+		}
+		cleanup := planBucketCleanup(logger, ownerForCR(instance), instance.Spec.DeletionPolicy, &instance.Spec.Buckets[i], bucket)
+		actions = append(actions, cleanup.actions(bucket.Name)...)
+	}
+	return actions, nil
+}
+
+// bucketCleanup lists inputs and outputs that are removed from the bucket when the CR is deleted
+type bucketCleanup struct {
+	outputs []*webhookrelay.Output
+	inputs  []*webhookrelay.Input
+	// deleteBucket is set if the bucket itself is deleted afterwards
+	deleteBucket bool
+}
+
+func (c *bucketCleanup) actions(bucket string) []plannedAction {
+	var actions []plannedAction
+	for _, output := range c.outputs {
+		actions = append(actions, plannedAction{op: opDelete, kind: kindOutput, bucket: bucket, name: output.Name})
+	}
+	for _, input := range c.inputs {
+		actions = append(actions, plannedAction{op: opDelete, kind: kindInput, bucket: bucket, name: input.Name})
+	}
+	if c.deleteBucket {
+		actions = append(actions, plannedAction{op: opDelete, kind: kindBucket, bucket: bucket})
+	}
+	return actions
+}
+
+// planBucketCleanup selects outputs (and inputs with DeleteAll policy) that are defined in the
+// bucket spec and carry the CR ownership marker. Bucket itself is only deleted if it was created
+// by the CR and doesn't have any other inputs or outputs that were created outside of this CR.
+func planBucketCleanup(logger logr.Logger, crOwner owner, policy forwardv1.DeletionPolicy, bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket) *bucketCleanup {
+	cleanup := &bucketCleanup{}
+	remaining := 0
+
+	for _, output := range bucket.Outputs {
+		if !outputInSpec(output.Name, bucketSpec) || !ownedBy(output.Description, crOwner) {
+			remaining++
+			continue
+		}
+		cleanup.outputs = append(cleanup.outputs, output)
+	}
+
+	if policy != forwardv1.DeletionPolicyDeleteAll {
+		return cleanup
+	}
+
+	for _, input := range bucket.Inputs {
+		if !inputInSpec(input.Name, bucketSpec) || !ownedBy(input.Description, crOwner) {
+			remaining++
+			continue
+		}
+		cleanup.inputs = append(cleanup.inputs, input)
+	}
+
+	switch {
+	case !ownedBy(bucket.Description, crOwner):
+		logger.Info("bucket is not managed by this CR, not deleting it")
+	case adopted(bucket.Description):
+		logger.Info("bucket existed before the CR adopted it, not deleting it")
+	case remaining > 0:
+		logger.Info("bucket has inputs or outputs that are not managed by this CR, not deleting it",
+			"remaining", remaining,
+		)
+	default:
+		cleanup.deleteBucket = true
+	}
+
+	return cleanup
+}
+
+// cleanupBucket removes inputs, outputs and the bucket selected by planBucketCleanup
+func (r *ReconcileWebhookRelayForward) cleanupBucket(logger logr.Logger, apiClient *WebhookRelayClient, crOwner owner, policy forwardv1.DeletionPolicy, bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket) error {
+	logger = logger.WithValues(
+		"bucket_name", bucket.Name,
+		"bucket_id", bucket.ID,
+	)
+
+	cleanup := planBucketCleanup(logger, crOwner, policy, bucketSpec, bucket)
+
+	for _, output := range cleanup.outputs {
+		logger.Info("deleting output",
+			"output_id", output.ID,
+			"output_name", output.Name,
+		)
+		err := apiClient.client.DeleteOutput(&webhookrelay.OutputDeleteOptions{
+			Bucket: bucket.ID,
+			Output: output.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete output '%s' from bucket '%s': %w", output.Name, bucket.Name, err)
+		}
+	}
+
+	for _, input := range cleanup.inputs {
+		logger.Info("deleting input",
+			"input_id", input.ID,
+			"input_name", input.Name,
+		)
+		err := apiClient.client.DeleteInput(&webhookrelay.InputDeleteOptions{
+			Bucket: bucket.ID,
+			Input:  input.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete input '%s' from bucket '%s': %w", input.Name, bucket.Name, err)
+		}
+	}
+
+	if !cleanup.deleteBucket {
+		return nil
+	}
+
+	logger.Info("deleting bucket")
+	err := apiClient.client.DeleteBucket(&webhookrelay.BucketDeleteOptions{
+		Ref: bucket.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete bucket '%s': %w", bucket.Name, err)
+	}
+	apiClient.bucketsCache.Delete(bucket.Name)
+
+	return nil
+}
+
+func outputInSpec(name string, bucketSpec *forwardv1.BucketSpec) bool {
+	for i := range bucketSpec.Outputs {
+		if bucketSpec.Outputs[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func inputInSpec(name string, bucketSpec *forwardv1.BucketSpec) bool {
+	for i := range bucketSpec.Inputs {
+		if bucketSpec.Inputs[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestReconcileDelete_CredentialsNotFound(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	now := metav1.Now()
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "fwd",
+			Namespace:         "default",
+			UID:               "1234",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{webhookRelayForwardFinalizer},
+		},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			SecretRefName:  "deleted-secret",
+			DeletionPolicy: forwardv1.DeletionPolicyDeleteAll,
+			Buckets:        []forwardv1.BucketSpec{{Name: "b-1"}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileWebhookRelayForward{
+		client:   fake.NewFakeClientWithScheme(s, instance),
+		scheme:   s,
+		recorder: recorder,
+		clients:  newClientPool(0),
+		config:   &config.Config{},
+	}
+
+	assert.NilError(t, r.reconcileDelete(log, instance))
+
+	updated := &forwardv1.WebhookRelayForward{}
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "fwd"}, updated))
+	assert.Assert(t, !hasFinalizer(updated))
+	assert.Equal(t, `Warning CleanupSkipped Agent token and routing configuration were not cleaned up: failed to get access token secret 'default/deleted-secret': secrets "deleted-secret" not found`, <-recorder.Events)
+}
+
+func TestReconcileDelete_APIUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	now := metav1.Now()
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "fwd",
+			Namespace:         "default",
+			UID:               "1234",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{webhookRelayForwardFinalizer},
+		},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			DeletionPolicy: forwardv1.DeletionPolicyDeleteAll,
+			Buckets:        []forwardv1.BucketSpec{{Name: "b-1"}},
+		},
+	}
+
+	cfg := &config.Config{}
+	cfg.Relay.Key = "key"
+	cfg.Relay.Secret = "secret"
+	clients := newClientPool(0)
+	clients.clients[credentialsID("key", "secret")] = &pooledClient{client: newTestAPIClient(t, srv), lastUsed: time.Now()}
+
+	r := &ReconcileWebhookRelayForward{
+		client:   fake.NewFakeClientWithScheme(s, instance),
+		scheme:   s,
+		recorder: record.NewFakeRecorder(10),
+		clients:  clients,
+		config:   cfg,
+	}
+
+	// transient API errors are retried, finalizer is kept
+	assert.ErrorContains(t, r.reconcileDelete(log, instance), "failed to list buckets")
+
+	updated := &forwardv1.WebhookRelayForward{}
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "fwd"}, updated))
+	assert.Assert(t, hasFinalizer(updated))
+}
+
+func TestReconcileDelete_PlanMode(t *testing.T) {
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+	buckets := []*webhookrelay.Bucket{{
+		ID:          testBucketID,
+		Name:        "b-1",
+		Description: withOwnershipMarker("", o),
+		Inputs:      []*webhookrelay.Input{{ID: testInputID, Name: "in", Description: withOwnershipMarker("", o)}},
+		Outputs:     []*webhookrelay.Output{{ID: testOutputID, Name: "out", Description: withOwnershipMarker("", o)}},
+	}}
+
+	var (
+		mu       sync.Mutex
+		modified []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Method != http.MethodGet {
+			modified = append(modified, req.Method+" "+req.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		assert.NilError(t, json.NewEncoder(w).Encode(buckets))
+	}))
+	defer srv.Close()
+
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	now := metav1.Now()
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "fwd",
+			Namespace:         "default",
+			UID:               "1234",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{webhookRelayForwardFinalizer},
+		},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Mode:           forwardv1.RoutingModePlan,
+			DeletionPolicy: forwardv1.DeletionPolicyDeleteAll,
+			Buckets: []forwardv1.BucketSpec{{
+				Name:    "b-1",
+				Inputs:  []forwardv1.InputSpec{{Name: "in"}},
+				Outputs: []forwardv1.OutputSpec{{Name: "out"}},
+			}},
+		},
+	}
+
+	cfg := &config.Config{}
+	cfg.Relay.Key = "key"
+	cfg.Relay.Secret = "secret"
+	clients := newClientPool(0)
+	clients.clients[credentialsID("key", "secret")] = &pooledClient{client: newTestAPIClient(t, srv), lastUsed: time.Now()}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileWebhookRelayForward{
+		client:   fake.NewFakeClientWithScheme(s, instance),
+		scheme:   s,
+		recorder: recorder,
+		clients:  clients,
+		config:   cfg,
+	}
+
+	assert.NilError(t, r.reconcileDelete(log, instance))
+
+	// nothing is removed, only reported
+	assert.Equal(t, 0, len(modified))
+
+	updated := &forwardv1.WebhookRelayForward{}
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "fwd"}, updated))
+	assert.Assert(t, !hasFinalizer(updated))
+
+	assert.Equal(t, "Normal CleanupPlanned Plan mode: routing configuration was not removed, 'DeleteAll' deletion policy would remove: 0 to create, 0 to update, 3 to delete", <-recorder.Events)
+	assert.Equal(t, "Normal PlannedDeleteOutput output 'out' in bucket 'b-1' will be deleted", <-recorder.Events)
+	assert.Equal(t, "Normal PlannedDeleteInput input 'in' in bucket 'b-1' will be deleted", <-recorder.Events)
+	assert.Equal(t, "Normal PlannedDeleteBucket bucket 'b-1' will be deleted", <-recorder.Events)
+}
+
+// input and output IDs have to be UUIDs, otherwise the client looks them up by name
+const (
+	testInputID  = "2f0c5a2e-8a8b-4b7e-9f4e-3c1f5b2d7a01"
+	testOutputID = "9d3e1c4b-6f2a-4e8d-8b1c-5a7f0e2d4c02"
+)
+
+func TestCleanupBucket_Adopted(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Method == http.MethodDelete {
+			deleted = append(deleted, req.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+	adopter := managingOwner(o, "created in UI")
+
+	bucketSpec := &forwardv1.BucketSpec{
+		Name:    "b-1",
+		Inputs:  []forwardv1.InputSpec{{Name: "in"}},
+		Outputs: []forwardv1.OutputSpec{{Name: "out"}},
+	}
+	bucket := &webhookrelay.Bucket{
+		ID:          testBucketID,
+		Name:        "b-1",
+		Description: withOwnershipMarker("created in UI", adopter),
+		Inputs:      []*webhookrelay.Input{{ID: testInputID, Name: "in", Description: withOwnershipMarker("", o)}},
+		Outputs:     []*webhookrelay.Output{{ID: testOutputID, Name: "out", Description: withOwnershipMarker("", o)}},
+	}
+
+	r := &ReconcileWebhookRelayForward{recorder: record.NewFakeRecorder(10)}
+	apiClient := newTestAPIClient(t, srv)
+
+	assert.NilError(t, r.cleanupBucket(log, apiClient, o, forwardv1.DeletionPolicyDeleteAll, bucketSpec, bucket))
+
+	// inputs and outputs created by the CR are removed, adopted bucket is kept
+	assert.DeepEqual(t, []string{
+		"/buckets/" + testBucketID + "/outputs/" + testOutputID,
+		"/buckets/" + testBucketID + "/inputs/" + testInputID,
+	}, deleted)
+}
+
+func TestReconcileDelete_DeletionPolicy(t *testing.T) {
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+	manual := &webhookrelay.Output{ID: "5b8e2f1a-3c4d-4e6f-9a7b-1c2d3e4f5a03", Name: "manual", Description: "created in UI"}
+
+	tests := []struct {
+		policy forwardv1.DeletionPolicy
+		// outputs that exist in the bucket next to the ones created by the CR
+		outputs []*webhookrelay.Output
+		deleted []string
+	}{
+		{
+			policy:  forwardv1.DeletionPolicyRetain,
+			deleted: nil,
+		},
+		{
+			policy:  forwardv1.DeletionPolicyDeleteOutputs,
+			outputs: []*webhookrelay.Output{manual},
+			deleted: []string{
+				"/buckets/" + testBucketID + "/outputs/" + testOutputID,
+			},
+		},
+		{
+			policy:  forwardv1.DeletionPolicyDeleteAll,
+			outputs: []*webhookrelay.Output{manual},
+			deleted: []string{
+				"/buckets/" + testBucketID + "/outputs/" + testOutputID,
+				"/buckets/" + testBucketID + "/inputs/" + testInputID,
+			},
+		},
+		{
+			policy: forwardv1.DeletionPolicyDeleteAll,
+			deleted: []string{
+				"/buckets/" + testBucketID + "/outputs/" + testOutputID,
+				"/buckets/" + testBucketID + "/inputs/" + testInputID,
+				"/buckets/" + testBucketID,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			buckets := []*webhookrelay.Bucket{{
+				ID:          testBucketID,
+				Name:        "b-1",
+				Description: withOwnershipMarker("", o),
+				Inputs:      []*webhookrelay.Input{{ID: testInputID, Name: "in", Description: withOwnershipMarker("", o)}},
+				Outputs: append([]*webhookrelay.Output{
+					{ID: testOutputID, Name: "out", Description: withOwnershipMarker("", o)},
+				}, tc.outputs...),
+			}}
+
+			var (
+				mu      sync.Mutex
+				deleted []string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if req.Method == http.MethodDelete {
+					deleted = append(deleted, req.URL.Path)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				assert.NilError(t, json.NewEncoder(w).Encode(buckets))
+			}))
+			defer srv.Close()
+
+			s := runtime.NewScheme()
+			assert.NilError(t, corev1.AddToScheme(s))
+			assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+			now := metav1.Now()
+			instance := &forwardv1.WebhookRelayForward{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "fwd",
+					Namespace:         "default",
+					UID:               "1234",
+					DeletionTimestamp: &now,
+					Finalizers:        []string{webhookRelayForwardFinalizer},
+				},
+				Spec: forwardv1.WebhookRelayForwardSpec{
+					DeletionPolicy: tc.policy,
+					Buckets: []forwardv1.BucketSpec{{
+						Name:    "b-1",
+						Inputs:  []forwardv1.InputSpec{{Name: "in"}},
+						Outputs: []forwardv1.OutputSpec{{Name: "out"}, {Name: "manual"}},
+					}},
+				},
+			}
+
+			cfg := &config.Config{}
+			cfg.Relay.Key = "key"
+			cfg.Relay.Secret = "secret"
+			clients := newClientPool(0)
+			clients.clients[credentialsID("key", "secret")] = &pooledClient{client: newTestAPIClient(t, srv), lastUsed: time.Now()}
+
+			r := &ReconcileWebhookRelayForward{
+				client:   fake.NewFakeClientWithScheme(s, instance),
+				scheme:   s,
+				recorder: record.NewFakeRecorder(10),
+				clients:  clients,
+				config:   cfg,
+			}
+
+			assert.NilError(t, r.reconcileDelete(log, instance))
+
+			// outputs that weren't created by the CR are never removed
+			assert.DeepEqual(t, tc.deleted, deleted)
+
+			updated := &forwardv1.WebhookRelayForward{}
+			assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "fwd"}, updated))
+			assert.Assert(t, !hasFinalizer(updated))
+		})
+	}
+}
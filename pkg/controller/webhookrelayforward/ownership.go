@@ -0,0 +1,245 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// Buckets, inputs and outputs don't have labels or tags so the operator stamps
+// their descriptions with an ownership marker:
+//   [webhookrelay-operator:<namespace>/<name>/<uid>]
+// or, for the bucket, input and output CRs:
+//   [webhookrelay-operator:<kind>:<namespace>/<name>/<uid>]
+// Buckets that existed before the CR started managing them are marked with an
+// ":adopted" suffix after the uid. Marker is checked before the operator updates
+// or deletes anything.
+var ownershipMarkerRegexp = regexp.MustCompile(`\s*\[webhookrelay-operator:(?:(\w+):)?([^/\]:]+)/([^/\]]+)/([^\]:]*)(:adopted)?\]`)
+
+// owner identifies CR that created or adopted Webhook Relay object
+type owner struct {
+	// kind is empty for WebhookRelayForward CRs
+	kind      string
+	namespace string
+	name      string
+	uid       types.UID
+	// adopted is set if the object wasn't created by the CR, such
+	// objects are never deleted
+	adopted bool
+}
+
+func ownerForCR(instance *forwardv1.WebhookRelayForward) owner {
+	return owner{
+		namespace: instance.GetNamespace(),
+		name:      instance.GetName(),
+		uid:       instance.GetUID(),
+	}
+}
+
+// ownerForObject returns owner for the bucket, input and output CRs
+func ownerForObject(kind string, obj metav1.Object) owner {
+	return owner{
+		kind:      kind,
+		namespace: obj.GetNamespace(),
+		name:      obj.GetName(),
+		uid:       obj.GetUID(),
+	}
+}
+
+func (o owner) marker() string {
+	suffix := ""
+	if o.adopted {
+		suffix = ":adopted"
+	}
+	if o.kind != "" {
+		return fmt.Sprintf("[webhookrelay-operator:%s:%s/%s/%s%s]", o.kind, o.namespace, o.name, o.uid, suffix)
+	}
+	return fmt.Sprintf("[webhookrelay-operator:%s/%s/%s%s]", o.namespace, o.name, o.uid, suffix)
+}
+
+func (o owner) String() string {
+	if o.kind != "" {
+		return o.kind + " " + o.namespace + "/" + o.name
+	}
+	return o.namespace + "/" + o.name
+}
+
+// sameCR checks whether both owners point to the same CR. UID is ignored
+// so a re-created CR can continue managing its own objects.
+func (o owner) sameCR(other owner) bool {
+	return o.kind == other.kind && o.namespace == other.namespace && o.name == other.name
+}
+
+// parseOwner extracts owner from the description
+func parseOwner(description string) (owner, bool) {
+	matches := ownershipMarkerRegexp.FindStringSubmatch(description)
+	if len(matches) != 6 {
+		return owner{}, false
+	}
+	return owner{
+		kind:      matches[1],
+		namespace: matches[2],
+		name:      matches[3],
+		uid:       types.UID(matches[4]),
+		adopted:   matches[5] != "",
+	}, true
+}
+
+// withOwnershipMarker replaces any existing marker in the description with the
+// one of the provided owner
+func withOwnershipMarker(description string, o owner) string {
+	description = stripOwnershipMarker(description)
+	if description == "" {
+		return o.marker()
+	}
+	return description + " " + o.marker()
+}
+
+func stripOwnershipMarker(description string) string {
+	return strings.TrimSpace(ownershipMarkerRegexp.ReplaceAllString(description, ""))
+}
+
+// ownedBy checks whether description carries a marker of the provided owner
+func ownedBy(description string, o owner) bool {
+	current, ok := parseOwner(description)
+	if !ok {
+		return false
+	}
+	return current.sameCR(o)
+}
+
+// adopted checks whether description carries a marker of an object that wasn't
+// created by the operator
+func adopted(description string) bool {
+	current, ok := parseOwner(description)
+	return ok && current.adopted
+}
+
+// managingOwner returns the owner to record on an existing bucket that the CR is allowed
+// to manage. Buckets the CR didn't create are marked as adopted and stay marked.
+func managingOwner(crOwner owner, description string) owner {
+	current, ok := parseOwner(description)
+	crOwner.adopted = !ok || !current.sameCR(crOwner) || current.adopted
+	return crOwner
+}
+
+// ownershipDecision is the outcome of the bucket ownership check
+type ownershipDecision int
+
+const (
+	// ownershipManage - bucket belongs to this CR or can be adopted by it
+	ownershipManage ownershipDecision = iota
+	// ownershipSkip - bucket was not created by the operator and adoption policy
+	// only allows managing own buckets, it can still be used by the agent
+	ownershipSkip
+	// ownershipRefused - bucket was not created by the operator and adoption
+	// policy forbids using it
+	ownershipRefused
+	// ownershipConflict - bucket is managed by another CR
+	ownershipConflict
+)
+
+// checkBucketOwnership decides whether the CR is allowed to manage an existing bucket
+func (r *ReconcileWebhookRelayForward) checkBucketOwnership(instance *forwardv1.WebhookRelayForward, bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket) (ownershipDecision, string) {
+	return checkBucketOwnership(r.client, ownerForCR(instance), bucketSpec.AdoptionPolicy, bucket)
+}
+
+// checkBucketOwnership decides whether the owner is allowed to manage an existing bucket
+func checkBucketOwnership(c client.Client, crOwner owner, policy forwardv1.AdoptionPolicy, bucket *webhookrelay.Bucket) (ownershipDecision, string) {
+	current, marked := parseOwner(bucket.Description)
+	if marked {
+		if current.sameCR(crOwner) {
+			return ownershipManage, ""
+		}
+		if ownerExists(c, current) {
+			if current.kind == kindBucketCR && policy == forwardv1.AdoptionPolicyManagedOnly {
+				// buckets of WebhookRelayBucket CRs are meant to be shared
+				return ownershipSkip, fmt.Sprintf("bucket '%s' is managed by %s, leaving it unmanaged", bucket.Name, current)
+			}
+			return ownershipConflict, fmt.Sprintf("bucket '%s' is managed by %s", bucket.Name, current)
+		}
+		// CR that created the bucket is gone, treating bucket as
+		// not managed by the operator
+	}
+
+	switch policy {
+	case forwardv1.AdoptionPolicyManagedOnly:
+		return ownershipSkip, fmt.Sprintf("bucket '%s' was not created by the operator, leaving it unmanaged", bucket.Name)
+	case forwardv1.AdoptionPolicyFail:
+		return ownershipRefused, fmt.Sprintf("bucket '%s' already exists and adoption policy forbids using it", bucket.Name)
+	default:
+		return ownershipManage, ""
+	}
+}
+
+// ownerExists checks whether CR that is recorded in the ownership marker still exists
+func ownerExists(c client.Client, o owner) bool {
+	var existing runtime.Object
+	switch o.kind {
+	case "":
+		existing = &forwardv1.WebhookRelayForward{}
+	case kindBucketCR:
+		existing = &forwardv1.WebhookRelayBucket{}
+	case kindInputCR:
+		existing = &forwardv1.WebhookRelayInput{}
+	case kindOutputCR:
+		existing = &forwardv1.WebhookRelayOutput{}
+	default:
+		// marker of an unknown kind, i.e. made by a newer operator version
+		return true
+	}
+
+	err := c.Get(context.TODO(), types.NamespacedName{Namespace: o.namespace, Name: o.name}, existing)
+	if err != nil {
+		// if we can't tell, assume it exists so we don't take over
+		// somebody else's bucket
+		return !errors.IsNotFound(err)
+	}
+	meta, err := apimeta.Accessor(existing)
+	if err != nil {
+		return true
+	}
+	return o.uid == "" || meta.GetUID() == o.uid
+}
+
+// ownershipCondition builds BucketsOwned condition, conflicts with other CRs take
+// priority over the adoption policy outcomes
+func ownershipCondition(ownership *bucketsOwnership) forwardv1.Condition {
+	condition := forwardv1.Condition{
+		Type:   forwardv1.ConditionBucketsOwned,
+		Status: corev1.ConditionTrue,
+		Reason: forwardv1.ReasonOwned,
+	}
+
+	for _, problem := range []struct {
+		decision ownershipDecision
+		reason   string
+	}{
+		{ownershipConflict, forwardv1.ReasonConflict},
+		{ownershipRefused, forwardv1.ReasonAdoptionRefused},
+		{ownershipSkip, forwardv1.ReasonNotManaged},
+	} {
+		messages := ownership.problems[problem.decision]
+		if len(messages) == 0 {
+			continue
+		}
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = problem.reason
+		condition.Message = strings.Join(messages, "; ")
+		break
+	}
+
+	return condition
+}
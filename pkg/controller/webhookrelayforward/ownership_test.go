@@ -0,0 +1,128 @@
+package webhookrelayforward
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestOwnershipMarker(t *testing.T) {
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+
+	t.Run("TestEmptyDescription", func(t *testing.T) {
+		description := withOwnershipMarker("", o)
+		assert.Equal(t, "[webhookrelay-operator:default/fwd/1234]", description)
+
+		parsed, ok := parseOwner(description)
+		assert.Assert(t, ok)
+		assert.Equal(t, o, parsed)
+	})
+
+	t.Run("TestReplaceMarker", func(t *testing.T) {
+		other := owner{namespace: "default", name: "other", uid: "5678"}
+		description := withOwnershipMarker(withOwnershipMarker("my bucket", other), o)
+		assert.Equal(t, "my bucket [webhookrelay-operator:default/fwd/1234]", description)
+		assert.Equal(t, "my bucket", stripOwnershipMarker(description))
+	})
+
+	t.Run("TestNotMarked", func(t *testing.T) {
+		assert.Assert(t, !ownedBy("hand-made output", o))
+	})
+
+	t.Run("TestKind", func(t *testing.T) {
+		output := owner{kind: kindOutputCR, namespace: "default", name: "fwd", uid: "1234"}
+		description := withOwnershipMarker("", output)
+		assert.Equal(t, "[webhookrelay-operator:WebhookRelayOutput:default/fwd/1234]", description)
+
+		parsed, ok := parseOwner(description)
+		assert.Assert(t, ok)
+		assert.Equal(t, output, parsed)
+		// CRs of different kinds never share objects
+		assert.Assert(t, !ownedBy(description, o))
+	})
+
+	t.Run("TestAdopted", func(t *testing.T) {
+		// bucket created in the UI
+		adopter := managingOwner(o, "my bucket")
+		description := withOwnershipMarker("my bucket", adopter)
+		assert.Equal(t, "my bucket [webhookrelay-operator:default/fwd/1234:adopted]", description)
+		assert.Assert(t, ownedBy(description, o))
+		assert.Assert(t, adopted(description))
+
+		// adopted bucket stays adopted
+		assert.Assert(t, managingOwner(o, description).adopted)
+
+		// bucket created by the CR
+		created := withOwnershipMarker("my bucket", o)
+		assert.Assert(t, !adopted(created))
+		assert.Assert(t, !managingOwner(o, created).adopted)
+	})
+}
+
+func TestGetOutputsDiff_KeepsUnownedOutputs(t *testing.T) {
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+
+	current := []*webhookrelay.Output{
+		{ID: "1", Name: "hand-made", Destination: "http://a", Description: "created in UI"},
+		{ID: "2", Name: "removed", Destination: "http://b", Description: withOwnershipMarker("", o)},
+	}
+
+	diff := getOutputsDiff(current, nil, o)
+
+	assert.Equal(t, 1, len(diff.delete))
+	assert.Equal(t, "2", diff.delete[0].ID)
+}
+
+func TestCheckBucketOwnership(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234"},
+	}
+	other := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "5678"},
+	}
+	bucketCR := &forwardv1.WebhookRelayBucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default", UID: "9012"},
+	}
+
+	r := &ReconcileWebhookRelayForward{
+		client: fake.NewFakeClientWithScheme(s, instance, other, bucketCR),
+	}
+
+	tests := []struct {
+		name        string
+		policy      forwardv1.AdoptionPolicy
+		description string
+		want        ownershipDecision
+	}{
+		{"own bucket", forwardv1.AdoptionPolicyFail, withOwnershipMarker("", ownerForCR(instance)), ownershipManage},
+		{"re-created CR", forwardv1.AdoptionPolicyFail, "[webhookrelay-operator:default/fwd/old-uid]", ownershipManage},
+		{"other CR bucket", forwardv1.AdoptionPolicyAdopt, withOwnershipMarker("", ownerForCR(other)), ownershipConflict},
+		{"bucket CR bucket", forwardv1.AdoptionPolicyAdopt, withOwnershipMarker("", ownerForObject(kindBucketCR, bucketCR)), ownershipConflict},
+		{"shared bucket CR bucket", forwardv1.AdoptionPolicyManagedOnly, withOwnershipMarker("", ownerForObject(kindBucketCR, bucketCR)), ownershipSkip},
+		{"deleted CR bucket", forwardv1.AdoptionPolicyAdopt, "[webhookrelay-operator:default/gone/0000]", ownershipManage},
+		{"adopt", forwardv1.AdoptionPolicyAdopt, "created in UI", ownershipManage},
+		{"default policy adopts", "", "created in UI", ownershipManage},
+		{"managed only", forwardv1.AdoptionPolicyManagedOnly, "created in UI", ownershipSkip},
+		{"fail", forwardv1.AdoptionPolicyFail, "created in UI", ownershipRefused},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, _ := r.checkBucketOwnership(instance,
+				&forwardv1.BucketSpec{Name: "b", AdoptionPolicy: tc.policy},
+				&webhookrelay.Bucket{Name: "b", Description: tc.description},
+			)
+			assert.Equal(t, tc.want, decision)
+		})
+	}
+}
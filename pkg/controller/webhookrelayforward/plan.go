@@ -0,0 +1,226 @@
+package webhookrelayforward
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// plannedAction is a change that would be made to a bucket, input or output in Plan mode
+type plannedAction struct {
+	op     string
+	kind   routingObjectKind
+	bucket string
+	// name of the input or output, empty for buckets
+	name   string
+	fields []string
+}
+
+func (a *plannedAction) String() string {
+	verb := strings.ToLower(a.op) + "d"
+	msg := fmt.Sprintf("%s '%s' in bucket '%s' will be %s", strings.ToLower(string(a.kind)), a.name, a.bucket, verb)
+	if a.kind == kindBucket {
+		msg = fmt.Sprintf("bucket '%s' will be %s", a.bucket, verb)
+	}
+	if len(a.fields) > 0 {
+		msg += ": " + strings.Join(a.fields, ", ")
+	}
+	return msg
+}
+
+// planMode checks whether routing changes should only be planned
+func planMode(instance *forwardv1.WebhookRelayForward) bool {
+	return instance.Spec.Mode == forwardv1.RoutingModePlan
+}
+
+// planRoutingConfiguration computes the changes that ensureRoutingConfiguration would make
+// without calling any of the Webhook Relay API methods that modify the configuration
+func (r *ReconcileWebhookRelayForward) planRoutingConfiguration(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) *routingResult {
+	result := newRoutingResult()
+
+	buckets, err := apiClient.listBuckets()
+	if err != nil {
+		result.listErr = fmt.Errorf("failed to list buckets, error: %w", err)
+		return result
+	}
+	result.ownership.checked = true
+
+	crOwner := ownerForCR(instance)
+
+	for i := range instance.Spec.Buckets {
+		desired := instance.Spec.Buckets[i].DeepCopy()
+		if desired.Description == "" {
+			desired.Description = getBucketDescription(instance)
+		}
+		desired.Description = withOwnershipMarker(desired.Description, crOwner)
+
+		auth, err := r.desiredBucketAuth(instance, desired)
+		if err != nil {
+			result.errs = append(result.errs, newRoutingError(kindBucket, opConfigure, desired.Name, "", err))
+			continue
+		}
+
+		existing, ok := getBucketByName(desired.Name, buckets)
+		if !ok {
+			// everything in a new bucket is created
+			result.plan = append(result.plan, plannedAction{op: opCreate, kind: kindBucket, bucket: desired.Name})
+			for _, output := range desired.Outputs {
+				result.plan = append(result.plan, plannedAction{op: opCreate, kind: kindOutput, bucket: desired.Name, name: output.Name})
+			}
+			for _, input := range desired.Inputs {
+				result.plan = append(result.plan, plannedAction{op: opCreate, kind: kindInput, bucket: desired.Name, name: input.Name})
+			}
+			continue
+		}
+
+		decision, reason := r.checkBucketOwnership(instance, desired, existing)
+		if decision != ownershipManage {
+			result.ownership.problems[decision] = append(result.ownership.problems[decision], reason)
+			if decision != ownershipSkip {
+				result.errs = append(result.errs, newRoutingError(kindBucket, opAdopt, desired.Name, "", errors.New(reason)))
+			}
+			continue
+		}
+		result.ownership.managed[existing.Name] = true
+		desired.Description = withOwnershipMarker(desired.Description, managingOwner(crOwner, existing.Description))
+
+		if fields := diffBucket(desired, auth, existing); len(fields) > 0 {
+			result.plan = append(result.plan, plannedAction{op: opUpdate, kind: kindBucket, bucket: desired.Name, fields: fields})
+		}
+
+		outputs := getOutputsDiff(existing.Outputs, desiredOutputs(desired, existing, crOwner), crOwner)
+		result.plan = append(result.plan, planOutputs(desired.Name, outputs)...)
+
+		inputs := getInputsDiff(existing.Inputs, desiredInputs(desired, existing, crOwner))
+		result.plan = append(result.plan, planInputs(desired.Name, inputs)...)
+	}
+
+	logger.Info("routing changes planned", "actions", len(result.plan))
+
+	return result
+}
+
+func planOutputs(bucket string, diff *outputsDiff) []plannedAction {
+	var actions []plannedAction
+	for _, o := range diff.create {
+		actions = append(actions, plannedAction{op: opCreate, kind: kindOutput, bucket: bucket, name: o.Name})
+	}
+	for _, o := range diff.update {
+		actions = append(actions, plannedAction{op: opUpdate, kind: kindOutput, bucket: bucket, name: o.Name, fields: diff.fields[o.Name]})
+	}
+	for _, o := range diff.delete {
+		actions = append(actions, plannedAction{op: opDelete, kind: kindOutput, bucket: bucket, name: o.Name})
+	}
+	return actions
+}
+
+func planInputs(bucket string, diff *inputsDiff) []plannedAction {
+	var actions []plannedAction
+	for _, i := range diff.create {
+		actions = append(actions, plannedAction{op: opCreate, kind: kindInput, bucket: bucket, name: i.Name})
+	}
+	for _, i := range diff.update {
+		actions = append(actions, plannedAction{op: opUpdate, kind: kindInput, bucket: bucket, name: i.Name, fields: diff.fields[i.Name]})
+	}
+	for _, i := range diff.delete {
+		actions = append(actions, plannedAction{op: opDelete, kind: kindInput, bucket: bucket, name: i.Name})
+	}
+	return actions
+}
+
+// planSummary counts planned actions, i.e. "2 to create, 1 to update, 0 to delete"
+func planSummary(actions []plannedAction) string {
+	counts := make(map[string]int)
+	for i := range actions {
+		counts[actions[i].op]++
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete", counts[opCreate], counts[opUpdate], counts[opDelete])
+}
+
+// setPlanStatus records planned changes in the status. Routing conditions are only
+// true when there is nothing to change.
+func setPlanStatus(status *forwardv1.WebhookRelayForwardStatus, instance *forwardv1.WebhookRelayForward, result *routingResult) {
+	generation := instance.GetGeneration()
+
+	if !result.ownership.checked {
+		// credentials and connectivity are reported the same way as in
+		// the Apply mode
+		status.RoutingStatus = forwardv1.RoutingStatusFailed
+		status.Message = result.listErr.Error()
+		setBucketsNotChecked(status, generation, result.listErr)
+		status.Plan = nil
+		return
+	}
+
+	plan := &forwardv1.RoutingPlan{
+		ObservedGeneration: generation,
+		Summary:            planSummary(result.plan),
+	}
+	planned := make(map[routingObjectKind][]string)
+	for i := range result.plan {
+		a := &result.plan[i]
+		plan.Actions = append(plan.Actions, forwardv1.PlannedAction{
+			Action: a.op,
+			Kind:   string(a.kind),
+			Bucket: a.bucket,
+			Name:   a.name,
+			Fields: a.fields,
+		})
+		planned[a.kind] = append(planned[a.kind], a.String())
+	}
+	status.Plan = plan
+
+	status.RoutingStatus = forwardv1.RoutingStatusPlanned
+	status.Message = "Plan mode: " + plan.Summary + ", set spec.mode to Apply to make the changes"
+	if err := result.err(); err != nil {
+		status.Message += " (" + err.Error() + ")"
+	}
+
+	status.SetCondition(newCondition(forwardv1.ConditionCredentialsValid, generation, true,
+		forwardv1.ReasonCredentialsAccepted, ""))
+	ownership := ownershipCondition(result.ownership)
+	ownership.ObservedGeneration = generation
+	status.SetCondition(ownership)
+
+	for _, c := range []struct {
+		t    forwardv1.ConditionType
+		kind routingObjectKind
+	}{
+		{forwardv1.ConditionBucketsReady, kindBucket},
+		{forwardv1.ConditionInputsReady, kindInput},
+		{forwardv1.ConditionOutputsReady, kindOutput},
+	} {
+		if errs := result.errs.messages(c.kind); len(errs) > 0 {
+			status.SetCondition(errorCondition(c.t, generation, errs))
+			continue
+		}
+		if len(planned[c.kind]) > 0 {
+			status.SetCondition(newCondition(c.t, generation, false, forwardv1.ReasonPlanned, strings.Join(planned[c.kind], ", ")))
+			continue
+		}
+		status.SetCondition(newCondition(c.t, generation, true, forwardv1.ReasonConfigured, ""))
+	}
+}
+
+// recordPlanEvents emits an event for every planned action when the plan changes, so the
+// same plan isn't reported again on every resync
+func (r *ReconcileWebhookRelayForward) recordPlanEvents(instance *forwardv1.WebhookRelayForward, status *forwardv1.WebhookRelayForwardStatus) {
+	if status.Plan == nil {
+		return
+	}
+	if instance.Status.Plan != nil && apiequality.Semantic.DeepEqual(instance.Status.Plan.Actions, status.Plan.Actions) {
+		return
+	}
+
+	r.recorder.Event(instance, corev1.EventTypeNormal, "RoutingPlanned", "Plan: "+status.Plan.Summary)
+	for _, a := range status.Plan.Actions {
+		action := plannedAction{op: a.Action, kind: routingObjectKind(a.Kind), bucket: a.Bucket, name: a.Name, fields: a.Fields}
+		r.recorder.Event(instance, corev1.EventTypeNormal, "Planned"+a.Action+a.Kind, action.String())
+	}
+}
@@ -0,0 +1,86 @@
+package webhookrelayforward
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestPlanRoutingConfiguration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected API request in Plan mode: %s %s", req.Method, req.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default", UID: "1234", Generation: 1},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Mode: forwardv1.RoutingModePlan,
+			Buckets: []forwardv1.BucketSpec{
+				{
+					Name:        "b-1",
+					Description: "existing",
+					Inputs:      []forwardv1.InputSpec{{Name: "in"}},
+					Outputs:     []forwardv1.OutputSpec{{Name: "out", Destination: "http://new"}},
+				},
+				{
+					Name:    "b-2",
+					Outputs: []forwardv1.OutputSpec{{Name: "out", Destination: "http://svc"}},
+				},
+			},
+		},
+	}
+	o := ownerForCR(instance)
+
+	r := &ReconcileWebhookRelayForward{recorder: record.NewFakeRecorder(10)}
+	apiClient := newTestAPIClient(t, srv)
+	apiClient.refreshInterval = time.Minute
+	apiClient.bucketsCache.Set([]*webhookrelay.Bucket{{
+		ID:          "bucket-id",
+		Name:        "b-1",
+		Description: withOwnershipMarker("existing", o),
+		Outputs: []*webhookrelay.Output{
+			{ID: "o-1", BucketID: "bucket-id", Name: "out", Destination: "http://old", Internal: true, Description: withOwnershipMarker("", o)},
+			{ID: "o-2", BucketID: "bucket-id", Name: "removed", Description: withOwnershipMarker("", o)},
+		},
+	}})
+
+	result := r.planRoutingConfiguration(log, apiClient, instance)
+	assert.NilError(t, result.err())
+
+	var actions []string
+	for i := range result.plan {
+		actions = append(actions, result.plan[i].String())
+	}
+	assert.DeepEqual(t, []string{
+		"output 'out' in bucket 'b-1' will be updated: destination",
+		"output 'removed' in bucket 'b-1' will be deleted",
+		"input 'in' in bucket 'b-1' will be created",
+		"bucket 'b-2' will be created",
+		"output 'out' in bucket 'b-2' will be created",
+	}, actions)
+
+	status := instance.Status.DeepCopy()
+	setPlanStatus(status, instance, result)
+	assert.Equal(t, forwardv1.RoutingStatusPlanned, status.RoutingStatus)
+	assert.Equal(t, "3 to create, 1 to update, 1 to delete", status.Plan.Summary)
+	assert.Equal(t, 5, len(status.Plan.Actions))
+	assert.Assert(t, !status.IsConditionTrue(forwardv1.ConditionOutputsReady))
+
+	// events are only emitted when the plan changes
+	r.recordPlanEvents(instance, status)
+	assert.Equal(t, 6, len(r.recorder.(*record.FakeRecorder).Events))
+	instance.Status = *status
+	r.recordPlanEvents(instance, status)
+	assert.Equal(t, 6, len(r.recorder.(*record.FakeRecorder).Events))
+}
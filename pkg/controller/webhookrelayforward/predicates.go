@@ -0,0 +1,29 @@
+package webhookrelayforward
+
+import (
+	"reflect"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// specChangedPredicate filters out CR updates that only change the status (i.e. status
+// patches made by the operator itself), so the CR is only reconciled on spec, labels,
+// annotations or deletion changes and the periodic resync
+var specChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.MetaOld == nil || e.MetaNew == nil {
+			return true
+		}
+		if e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() {
+			return true
+		}
+		if e.MetaNew.GetDeletionTimestamp() != nil {
+			return true
+		}
+		if !reflect.DeepEqual(e.MetaOld.GetLabels(), e.MetaNew.GetLabels()) {
+			return true
+		}
+		return !reflect.DeepEqual(e.MetaOld.GetAnnotations(), e.MetaNew.GetAnnotations())
+	},
+}
@@ -6,31 +6,17 @@ import (
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
 )
 
-func (r *ReconcileWebhookRelayForward) shouldUpdatePublicEndpoints(instance *forwardv1.WebhookRelayForward) (*forwardv1.WebhookRelayForward, bool) {
-	if len(instance.Spec.Buckets) == 0 && len(instance.Status.PublicEndpoints) == 0 {
-		// nothing to do
-		return nil, false
+// desiredPublicEndpoints returns a sorted list of input public endpoints from
+// the buckets defined in the spec
+func desiredPublicEndpoints(instance *forwardv1.WebhookRelayForward, bucketsCache *bucketsCache) []string {
+	if len(instance.Spec.Buckets) == 0 {
+		return []string{}
 	}
 
-	// if status is set but we don't have any buckets anymore, need to remove it
-	if len(instance.Spec.Buckets) == 0 && len(instance.Status.PublicEndpoints) > 0 {
-		patch := instance.DeepCopy()
-		patch.Status.PublicEndpoints = []string{}
-		return patch, true
-	}
-
-	desiredEndpoints := computePublicEndpoints(instance, r.apiClient.bucketsCache)
+	endpoints := computePublicEndpoints(instance, bucketsCache)
+	sort.Strings(endpoints)
 
-	sort.Strings(desiredEndpoints)
-	sort.Strings(instance.Status.PublicEndpoints)
-
-	if !sliceEquals(desiredEndpoints, instance.Status.PublicEndpoints) {
-		patch := instance.DeepCopy()
-		patch.Status.PublicEndpoints = desiredEndpoints
-		return patch, true
-	}
-
-	return nil, false
+	return endpoints
 }
 
 func computePublicEndpoints(instance *forwardv1.WebhookRelayForward, bucketsCache *bucketsCache) []string {
@@ -69,20 +55,3 @@ func getInputPublicEndpoint(bucketName, inputName string, bucketsCache *bucketsC
 
 	return "", false
 }
-
-func sliceEquals(l, r []string) bool {
-	// If one is nil, the other must also be nil.
-	if (l == nil) != (r == nil) {
-		return false
-	}
-	if len(l) != len(r) {
-		return false
-	}
-
-	for i := range l {
-		if l[i] != r[i] {
-			return false
-		}
-	}
-	return true
-}
@@ -0,0 +1,73 @@
+package webhookrelayforward
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter is used when Webhook Relay API responds with 429
+// but doesn't say when to retry
+const defaultRetryAfter = 30 * time.Second
+
+// rateLimitTransport records Retry-After from the Webhook Relay API responses
+// so reconciles can be postponed until the API accepts requests again
+type rateLimitTransport struct {
+	next http.RoundTripper
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newRateLimitTransport(next http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{next: next}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	until := time.Now().Add(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+
+	t.mu.Lock()
+	if until.After(t.until) {
+		t.until = until
+	}
+	t.mu.Unlock()
+
+	return resp, err
+}
+
+// retryAfter returns how long to wait before calling the API again,
+// zero if we are not rate limited
+func (t *rateLimitTransport) retryAfter() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wait := time.Until(t.until)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// parseRetryAfter parses Retry-After header which can be either
+// seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
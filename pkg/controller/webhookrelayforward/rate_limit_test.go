@@ -0,0 +1,54 @@
+package webhookrelayforward
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultRetryAfter},
+		{"120", 2 * time.Minute},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", defaultRetryAfter},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseRetryAfter(tc.value, now))
+		})
+	}
+}
+
+func TestAPIClient_RateLimited(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := newTestAPIClient(t, srv)
+	assert.Equal(t, time.Duration(0), c.retryAfter())
+
+	_, err := c.client.ListBuckets(&webhookrelay.BucketListOptions{})
+	assert.ErrorContains(t, err, "HTTP status 429")
+
+	// client shouldn't retry on its own, reconcile is postponed instead
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	wait := c.retryAfter()
+	assert.Assert(t, wait > 50*time.Second && wait <= time.Minute, "unexpected wait %s", wait)
+}
@@ -0,0 +1,103 @@
+package webhookrelayforward
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// routingObjectKind is a kind of the Webhook Relay routing object
+type routingObjectKind string
+
+const (
+	kindBucket routingObjectKind = "Bucket"
+	kindInput  routingObjectKind = "Input"
+	kindOutput routingObjectKind = "Output"
+)
+
+// operations performed on the routing objects
+const (
+	opCreate    = "Create"
+	opUpdate    = "Update"
+	opDelete    = "Delete"
+	opConfigure = "Configure"
+	opAdopt     = "Adopt"
+	opSync      = "Sync"
+)
+
+// routingError describes a failed operation on a single bucket, input or output
+type routingError struct {
+	kind   routingObjectKind
+	op     string
+	bucket string
+	// name of the input or output, empty for bucket errors or
+	// when the whole list of bucket inputs/outputs failed
+	name string
+	err  error
+}
+
+func newRoutingError(kind routingObjectKind, op, bucket, name string, err error) *routingError {
+	return &routingError{
+		kind:   kind,
+		op:     op,
+		bucket: bucket,
+		name:   name,
+		err:    err,
+	}
+}
+
+func (e *routingError) Error() string {
+	switch {
+	case e.kind == kindBucket:
+		return fmt.Sprintf("failed to %s bucket '%s': %s", strings.ToLower(e.op), e.bucket, e.err)
+	case e.name == "":
+		return fmt.Sprintf("failed to %s bucket '%s' %ss: %s", strings.ToLower(e.op), e.bucket, strings.ToLower(string(e.kind)), e.err)
+	}
+	return fmt.Sprintf("failed to %s %s '%s' in bucket '%s': %s", strings.ToLower(e.op), strings.ToLower(string(e.kind)), e.name, e.bucket, e.err)
+}
+
+func (e *routingError) Unwrap() error {
+	return e.err
+}
+
+// reason is used for the Kubernetes events, i.e. FailedCreateOutput
+func (e *routingError) reason() string {
+	return "Failed" + e.op + string(e.kind)
+}
+
+// routingErrors aggregates errors from the whole routing configuration
+type routingErrors []*routingError
+
+func (errs routingErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// messages returns error messages of the specified object kind
+func (errs routingErrors) messages(kind routingObjectKind) []string {
+	var msgs []string
+	for _, e := range errs {
+		if e.kind == kind {
+			msgs = append(msgs, e.Error())
+		}
+	}
+	return msgs
+}
+
+// recordRoutingEvents emits a Warning event for every routing object that
+// failed to be configured
+func (r *ReconcileWebhookRelayForward) recordRoutingEvents(instance *forwardv1.WebhookRelayForward, result *routingResult) {
+	if result.listErr != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedListBuckets", result.listErr.Error())
+		return
+	}
+	for _, e := range result.errs {
+		r.recorder.Event(instance, corev1.EventTypeWarning, e.reason(), e.Error())
+	}
+}
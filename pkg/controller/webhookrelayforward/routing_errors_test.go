@@ -0,0 +1,80 @@
+package webhookrelayforward
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// newTestAPIClient returns Webhook Relay API client that talks to the test server
+func newTestAPIClient(t *testing.T, srv *httptest.Server) *WebhookRelayClient {
+	api, rateLimit, err := newAPIClient("key", "secret")
+	assert.NilError(t, err)
+	api.BaseURL = srv.URL
+
+	return &WebhookRelayClient{
+		client:       api,
+		bucketsCache: newBucketsCache(),
+		rateLimit:    rateLimit,
+	}
+}
+
+func TestRoutingErrors(t *testing.T) {
+	errs := routingErrors{
+		newRoutingError(kindBucket, opCreate, "b-1", "", fmt.Errorf("boom")),
+		newRoutingError(kindOutput, opUpdate, "b-1", "o-1", fmt.Errorf("bad destination")),
+		newRoutingError(kindInput, opSync, "b-2", "", fmt.Errorf("not found")),
+	}
+
+	assert.Equal(t, "failed to create bucket 'b-1': boom, "+
+		"failed to update output 'o-1' in bucket 'b-1': bad destination, "+
+		"failed to sync bucket 'b-2' inputs: not found", errs.Error())
+	assert.DeepEqual(t, []string{"failed to update output 'o-1' in bucket 'b-1': bad destination"}, errs.messages(kindOutput))
+	assert.Equal(t, "FailedUpdateOutput", errs[1].reason())
+}
+
+func TestEnsureBucketOutputs_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"message": "invalid destination"}`)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusPaymentRequired)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	o := owner{namespace: "default", name: "fwd", uid: "1234"}
+	r := &ReconcileWebhookRelayForward{}
+	apiClient := newTestAPIClient(t, srv)
+	apiClient.bucketsCache.Add(&webhookrelay.Bucket{
+		ID:   "bucket-id",
+		Name: "b-1",
+		Outputs: []*webhookrelay.Output{
+			{ID: "o-2", BucketID: "bucket-id", Name: "removed", Description: withOwnershipMarker("", o)},
+		},
+	})
+
+	statuses, _, errs := r.ensureBucketOutputs(log, apiClient, o, &forwardv1.BucketSpec{
+		Name:    "b-1",
+		Outputs: []forwardv1.OutputSpec{{Name: "o-1", Destination: "http://localhost"}},
+	})
+
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, forwardv1.SyncStateFailed, statuses[0].State)
+	assert.Assert(t, statuses[0].LastError != "")
+
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, "FailedCreateOutput", errs[0].reason())
+	assert.Equal(t, "FailedDeleteOutput", errs[1].reason())
+	assert.Equal(t, "removed", errs[1].name)
+}
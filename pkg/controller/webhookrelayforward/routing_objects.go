@@ -0,0 +1,393 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+// Kinds of the bucket, input and output CRs, recorded in the ownership markers
+const (
+	kindBucketCR = "WebhookRelayBucket"
+	kindInputCR  = "WebhookRelayInput"
+	kindOutputCR = "WebhookRelayOutput"
+)
+
+// bucketRefIndexKey indexes input and output CRs by the bucket CR they reference
+const bucketRefIndexKey = "spec.bucketRef.name"
+
+// routingObject is a bucket, input or output CR
+type routingObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// routingObjectReconciler has the dependencies shared by the bucket, input and
+// output controllers
+type routingObjectReconciler struct {
+	client   client.Client
+	recorder record.EventRecorder
+	// clients are shared with the WebhookRelayForward controller so
+	// all controllers use the same buckets cache
+	clients *clientPool
+	config  *config.Config
+}
+
+// clientForBucket returns Webhook Relay API client for the credentials of the bucket CR
+func (r *routingObjectReconciler) clientForBucket(instance *forwardv1.WebhookRelayBucket) (*WebhookRelayClient, error) {
+	var secretRef *types.NamespacedName
+	if instance.Spec.SecretRefName != "" {
+		secretRef = &types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.Spec.SecretRefName}
+	}
+	return clientForSecret(r.client, r.clients, r.config, secretRef)
+}
+
+// bucketNotReadyError is returned when the referenced bucket CR doesn't exist or its
+// bucket wasn't configured yet. Input and output CRs are reconciled again once the
+// bucket CR changes.
+type bucketNotReadyError struct {
+	msg string
+}
+
+func (e *bucketNotReadyError) Error() string {
+	return e.msg
+}
+
+func isBucketNotReady(err error) bool {
+	_, ok := err.(*bucketNotReadyError)
+	return ok
+}
+
+// referencedBucket is the bucket that input or output CR references together with an
+// API client for the bucket credentials
+type referencedBucket struct {
+	cr        *forwardv1.WebhookRelayBucket
+	apiClient *WebhookRelayClient
+	bucket    *webhookrelay.Bucket
+}
+
+// resolveBucket returns the bucket that input or output CR references. Buckets that are left
+// unmanaged because of the adoption policy can still be used.
+func (r *routingObjectReconciler) resolveBucket(namespace, name string) (*referencedBucket, error) {
+	bucketCR := &forwardv1.WebhookRelayBucket{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, bucketCR)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &bucketNotReadyError{msg: fmt.Sprintf("WebhookRelayBucket '%s' not found", name)}
+		}
+		return nil, err
+	}
+	switch bucketCR.Status.State {
+	case forwardv1.SyncStateSynced, forwardv1.SyncStateUnmanaged:
+	default:
+		return nil, &bucketNotReadyError{msg: fmt.Sprintf("waiting for WebhookRelayBucket '%s' to be synced", name)}
+	}
+	if bucketCR.Status.ID == "" {
+		return nil, &bucketNotReadyError{msg: fmt.Sprintf("waiting for WebhookRelayBucket '%s' to be synced", name)}
+	}
+
+	apiClient, err := r.clientForBucket(bucketCR)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := apiClient.listBuckets(); err != nil {
+		return nil, fmt.Errorf("failed to list buckets, error: %w", err)
+	}
+	bucket, ok := apiClient.bucketsCache.Get(bucketCR.Status.ID)
+	if !ok {
+		// bucket was deleted outside of the operator, bucket controller will
+		// create it again
+		return nil, &bucketNotReadyError{msg: fmt.Sprintf("bucket '%s' not found", bucketCR.BucketName())}
+	}
+	return &referencedBucket{cr: bucketCR, apiClient: apiClient, bucket: bucket}, nil
+}
+
+// bucketObjectHandler has the parts of the input and output controllers that depend on the
+// kind, the rest of the reconcile loop is shared in reconcileBucketObject
+type bucketObjectHandler interface {
+	// newObject returns an empty CR to read into
+	newObject() routingObject
+	// crKind is the CR kind recorded in the ownership markers
+	crKind() string
+	// bucketRef returns the name of the referenced bucket CR
+	bucketRef(instance routingObject) string
+	deletionPolicy(instance routingObject) forwardv1.RoutingObjectDeletionPolicy
+	// objectStatus returns the part of the CR status shared by routing object CRs
+	objectStatus(instance routingObject) *forwardv1.RoutingObjectStatus
+	// sync creates or updates the object so it matches the CR spec, state is recorded
+	// in the CR status
+	sync(logger logr.Logger, ref *referencedBucket, instance routingObject) error
+	// cleanup deletes the object created by the CR
+	cleanup(logger logr.Logger, ref *referencedBucket, instance routingObject) error
+}
+
+// reconcileBucketObject is the reconcile loop of the input and output controllers
+func (r *routingObjectReconciler) reconcileBucketObject(h bucketObjectHandler, request reconcile.Request) (reconcile.Result, error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name, "Kind", h.crKind())
+
+	reconcileResult := reconcile.Result{RequeueAfter: r.config.ResyncPeriod}
+
+	instance := h.newObject()
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcileResult, err
+	}
+
+	if instance.GetDeletionTimestamp() != nil {
+		if err := r.reconcileBucketObjectDelete(logger, h, instance); err != nil {
+			logger.Error(err, "Failed to finalize CR")
+			return reconcileResult, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	updated, err := r.ensureObjectFinalizer(logger, instance, h.deletionPolicy(instance))
+	if err != nil {
+		logger.Error(err, "Failed to update finalizer")
+		return reconcileResult, err
+	}
+	if updated {
+		return reconcile.Result{RequeueAfter: time.Second}, nil
+	}
+
+	// status is changed on a copy and patched afterwards
+	synced := instance.DeepCopyObject().(routingObject)
+	syncErr := r.syncBucketObject(logger, h, synced)
+	if syncErr != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedSync", syncErr.Error())
+	}
+
+	if err := r.updateObjectStatus(logger, h, instance, synced); err != nil {
+		logger.Error(err, "Failed to update CR status")
+		return reconcileResult, err
+	}
+
+	return reconcileResult, syncErr
+}
+
+// syncBucketObject configures the input or output once its bucket is ready and
+// records the state in the CR status
+func (r *routingObjectReconciler) syncBucketObject(logger logr.Logger, h bucketObjectHandler, instance routingObject) error {
+	status := h.objectStatus(instance)
+
+	ref, err := r.resolveBucket(instance.GetNamespace(), h.bucketRef(instance))
+	if err != nil {
+		if isBucketNotReady(err) {
+			// reconciled again once the bucket CR changes
+			setObjectState(status, instance.GetGeneration(), forwardv1.SyncStatePending, err.Error())
+			return nil
+		}
+		setObjectState(status, instance.GetGeneration(), forwardv1.SyncStateFailed, err.Error())
+		return err
+	}
+
+	logger = logger.WithValues(
+		"bucket_name", ref.bucket.Name,
+		"bucket_id", ref.bucket.ID,
+	)
+
+	if err := h.sync(logger, ref, instance); err != nil {
+		setObjectState(status, instance.GetGeneration(), forwardv1.SyncStateFailed, err.Error())
+		return err
+	}
+	return nil
+}
+
+// reconcileBucketObjectDelete removes the input or output with "Delete" deletion policy
+// if it was created by the CR
+func (r *routingObjectReconciler) reconcileBucketObjectDelete(logger logr.Logger, h bucketObjectHandler, instance routingObject) error {
+	if !hasObjectFinalizer(instance) {
+		return nil
+	}
+
+	ref, err := r.resolveBucket(instance.GetNamespace(), h.bucketRef(instance))
+	if err != nil {
+		if !isBucketNotReady(err) && !isCredentialsNotFound(err) {
+			return err
+		}
+		// without the bucket CR or its credentials there is nothing to clean up with
+		r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupSkipped", err.Error())
+		return r.removeObjectFinalizer(logger, instance)
+	}
+
+	if err := h.cleanup(logger, ref, instance); err != nil {
+		return err
+	}
+	return r.removeObjectFinalizer(logger, instance)
+}
+
+// updateObjectStatus patches CR status if it has changed
+func (r *routingObjectReconciler) updateObjectStatus(logger logr.Logger, h bucketObjectHandler, instance, synced routingObject) error {
+	if apiequality.Semantic.DeepEqual(instance, synced) {
+		return nil
+	}
+
+	logger.Info("Updating status", "state", h.objectStatus(synced).State)
+
+	return r.client.Status().Patch(context.TODO(), synced, client.MergeFrom(instance))
+}
+
+// ensureObjectFinalizer adds the finalizer when the Webhook Relay object has to be cleaned
+// up on deletion and removes it otherwise. Returns true if the CR was updated.
+func (r *routingObjectReconciler) ensureObjectFinalizer(logger logr.Logger, instance routingObject, policy forwardv1.RoutingObjectDeletionPolicy) (bool, error) {
+	want := policy == forwardv1.RoutingObjectDeletionPolicyDelete
+	if hasObjectFinalizer(instance) == want {
+		return false, nil
+	}
+
+	patch := instance.DeepCopyObject().(routingObject)
+	if want {
+		logger.Info("Adding finalizer")
+		controllerutil.AddFinalizer(patch, webhookRelayForwardFinalizer)
+	} else {
+		logger.Info("Removing finalizer")
+		controllerutil.RemoveFinalizer(patch, webhookRelayForwardFinalizer)
+	}
+
+	return true, r.client.Patch(context.TODO(), patch, client.MergeFrom(instance))
+}
+
+// removeObjectFinalizer releases the CR once the cleanup is done
+func (r *routingObjectReconciler) removeObjectFinalizer(logger logr.Logger, instance routingObject) error {
+	if !hasObjectFinalizer(instance) {
+		return nil
+	}
+	patch := instance.DeepCopyObject().(routingObject)
+	controllerutil.RemoveFinalizer(patch, webhookRelayForwardFinalizer)
+
+	logger.Info("Removing finalizer")
+
+	return r.client.Patch(context.TODO(), patch, client.MergeFrom(instance))
+}
+
+// checkObjectOwnership decides whether the CR is allowed to manage an existing input or output.
+// Objects that were not created by the operator are treated according to the adoption policy
+// of the bucket CR.
+func (r *routingObjectReconciler) checkObjectOwnership(crOwner owner, policy forwardv1.AdoptionPolicy, kind routingObjectKind, name, description string) (ownershipDecision, string) {
+	current, marked := parseOwner(description)
+	if marked {
+		if current.sameCR(crOwner) {
+			return ownershipManage, ""
+		}
+		if ownerExists(r.client, current) {
+			return ownershipConflict, fmt.Sprintf("%s '%s' is managed by %s", kind, name, current)
+		}
+		// CR that created the object is gone, treating it as
+		// not managed by the operator
+	}
+
+	switch policy {
+	case forwardv1.AdoptionPolicyManagedOnly:
+		return ownershipSkip, fmt.Sprintf("%s '%s' was not created by the operator, leaving it unmanaged", kind, name)
+	case forwardv1.AdoptionPolicyFail:
+		return ownershipRefused, fmt.Sprintf("%s '%s' already exists and adoption policy forbids using it", kind, name)
+	default:
+		return ownershipManage, ""
+	}
+}
+
+// adoptObject checks the ownership of an existing input or output and records the outcome.
+// Returns false if the object must be left untouched.
+func (r *routingObjectReconciler) adoptObject(instance routingObject, status *forwardv1.RoutingObjectStatus, ref *referencedBucket, crOwner owner, kind routingObjectKind, name, description string) bool {
+	decision, reason := r.checkObjectOwnership(crOwner, ref.cr.Spec.AdoptionPolicy, kind, name, description)
+	switch decision {
+	case ownershipManage:
+		if !ownedBy(description, crOwner) {
+			r.recorder.Event(instance, corev1.EventTypeNormal, "Adopted",
+				fmt.Sprintf("%s '%s' was not created by the operator, taking it over", kind, name))
+		}
+		return true
+	case ownershipSkip:
+		setObjectState(status, instance.GetGeneration(), forwardv1.SyncStateUnmanaged, reason)
+		return false
+	default:
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedAdoption", reason)
+		setObjectState(status, instance.GetGeneration(), forwardv1.SyncStateFailed, reason)
+		return false
+	}
+}
+
+// recordObjectDrift emits an event if the object was changed outside of the operator
+// after it was synced with the current spec
+func (r *routingObjectReconciler) recordObjectDrift(instance routingObject, status *forwardv1.RoutingObjectStatus, change driftChange) {
+	if status.State != forwardv1.SyncStateSynced || status.ObservedGeneration != instance.GetGeneration() {
+		return
+	}
+	r.recorder.Event(instance, corev1.EventTypeNormal, "DriftCorrected",
+		"Changed outside of the operator, restored "+change.String())
+}
+
+func hasObjectFinalizer(instance metav1.Object) bool {
+	for _, f := range instance.GetFinalizers() {
+		if f == webhookRelayForwardFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// setObjectState records the state of the Webhook Relay object in the CR status
+func setObjectState(status *forwardv1.RoutingObjectStatus, generation int64, state forwardv1.SyncState, message string) {
+	status.ObservedGeneration = generation
+	status.State = state
+	status.Message = message
+}
+
+// indexBucketRef indexes input and output CRs by the referenced bucket CR
+func indexBucketRef(obj runtime.Object) []string {
+	switch instance := obj.(type) {
+	case *forwardv1.WebhookRelayInput:
+		return []string{instance.Spec.BucketRef.Name}
+	case *forwardv1.WebhookRelayOutput:
+		return []string{instance.Spec.BucketRef.Name}
+	}
+	return nil
+}
+
+// requestsForBucketRefs maps a bucket CR to the input or output CRs that reference it
+func requestsForBucketRefs(c client.Client, list runtime.Object) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		items := list.DeepCopyObject()
+		err := c.List(context.TODO(), items,
+			client.InNamespace(obj.Meta.GetNamespace()),
+			client.MatchingFields{bucketRefIndexKey: obj.Meta.GetName()},
+		)
+		if err != nil {
+			log.Error(err, "failed to list CRs referencing the bucket", "bucket", obj.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		switch l := items.(type) {
+		case *forwardv1.WebhookRelayInputList:
+			for i := range l.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: l.Items[i].GetNamespace(), Name: l.Items[i].GetName()}})
+			}
+		case *forwardv1.WebhookRelayOutputList:
+			for i := range l.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: l.Items[i].GetNamespace(), Name: l.Items[i].GetName()}})
+			}
+		}
+		return requests
+	}
+}
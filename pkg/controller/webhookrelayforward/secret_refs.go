@@ -0,0 +1,104 @@
+package webhookrelayforward
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// secretRefsIndexKey indexes CRs by the secrets they reference so secret
+// changes can be mapped back to the CRs
+const secretRefsIndexKey = "spec.secretRefs"
+
+// credentialsHashAnnotation is set on the agent pod template so the pods are
+// restarted when credentials are rotated
+const credentialsHashAnnotation = "forward.webhookrelay.com/credentials-hash"
+
+// secretRefs returns <namespace>/<name> of all secrets referenced by the CR:
+// access token secret and bucket authentication secrets
+func secretRefs(instance *forwardv1.WebhookRelayForward) []string {
+	var refs []string
+
+	if instance.Spec.SecretRefName != "" {
+		namespace := instance.Spec.SecretRefNamespace
+		if namespace == "" {
+			namespace = instance.GetNamespace()
+		}
+		refs = append(refs, types.NamespacedName{Namespace: namespace, Name: instance.Spec.SecretRefName}.String())
+	}
+
+	for i := range instance.Spec.Buckets {
+		auth := instance.Spec.Buckets[i].Auth
+		if auth == nil || auth.SecretRefName == "" {
+			continue
+		}
+		refs = append(refs, types.NamespacedName{Namespace: instance.GetNamespace(), Name: auth.SecretRefName}.String())
+	}
+
+	return refs
+}
+
+func indexSecretRefs(obj runtime.Object) []string {
+	instance, ok := obj.(*forwardv1.WebhookRelayForward)
+	if !ok {
+		return nil
+	}
+	return secretRefs(instance)
+}
+
+// requestsForSecret maps a secret to the CRs that reference it directly or through
+// their WebhookRelayAccount
+func (r *ReconcileWebhookRelayForward) requestsForSecret(obj handler.MapObject) []reconcile.Request {
+	ref := types.NamespacedName{Namespace: obj.Meta.GetNamespace(), Name: obj.Meta.GetName()}.String()
+
+	requests := r.requestsForIndex(secretRefsIndexKey, ref)
+
+	accounts, err := accountsForSecret(r.client, obj.Meta)
+	if err != nil {
+		log.Error(err, "failed to list accounts referencing the secret", "secret", ref)
+		return requests
+	}
+	for i := range accounts {
+		requests = append(requests, r.requestsForIndex(accountRefIndexKey, accounts[i].GetName())...)
+	}
+	return requests
+}
+
+// requestsForAccount maps a WebhookRelayAccount to the CRs that use it
+func (r *ReconcileWebhookRelayForward) requestsForAccount(obj handler.MapObject) []reconcile.Request {
+	return r.requestsForIndex(accountRefIndexKey, obj.Meta.GetName())
+}
+
+func (r *ReconcileWebhookRelayForward) requestsForIndex(key, value string) []reconcile.Request {
+	instances := &forwardv1.WebhookRelayForwardList{}
+	err := r.client.List(context.TODO(), instances, client.MatchingFields{key: value})
+	if err != nil {
+		log.Error(err, "failed to list CRs", "index", key, "value", value)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range instances.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: instances.Items[i].GetNamespace(),
+				Name:      instances.Items[i].GetName(),
+			},
+		})
+	}
+	return requests
+}
+
+func indexAccountRef(obj runtime.Object) []string {
+	instance, ok := obj.(*forwardv1.WebhookRelayForward)
+	if !ok || instance.Spec.AccountRef == nil {
+		return nil
+	}
+	return []string{instance.Spec.AccountRef.Name}
+}
@@ -0,0 +1,65 @@
+package webhookrelayforward
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestSecretRefs(t *testing.T) {
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			SecretRefName:      "whr-credentials",
+			SecretRefNamespace: "secrets",
+			Buckets: []forwardv1.BucketSpec{
+				{Name: "b-1"},
+				{Name: "b-2", Auth: &forwardv1.BucketAuth{Type: forwardv1.BucketAuthTypeToken, SecretRefName: "bucket-auth"}},
+			},
+		},
+	}
+
+	assert.DeepEqual(t, []string{"secrets/whr-credentials", "default/bucket-auth"}, secretRefs(instance))
+}
+
+func TestCheckDeployment_CredentialsRotated(t *testing.T) {
+	r := &ReconcileWebhookRelayForward{config: &config.Config{Image: "webhookrelay/webhookrelayd"}}
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+		Spec:       forwardv1.WebhookRelayForwardSpec{SecretRefName: "whr-credentials"},
+	}
+
+	current := r.newDeploymentForCR(&agentCredentials{secretName: "whr-credentials", key: "key", secret: "secret"}, instance)
+
+	_, equal := r.checkDeployment(&agentCredentials{secretName: "whr-credentials", key: "key", secret: "secret"}, instance, current)
+	assert.Assert(t, equal)
+
+	patched, equal := r.checkDeployment(&agentCredentials{secretName: "whr-credentials", key: "key", secret: "rotated"}, instance, current)
+	assert.Assert(t, !equal)
+	assert.Equal(t, credentialsID("key", "rotated")[:16], patched.Spec.Template.Annotations[credentialsHashAnnotation])
+}
+
+func TestCheckDeployment_InlinedCredentials(t *testing.T) {
+	r := &ReconcileWebhookRelayForward{config: &config.Config{Image: "webhookrelay/webhookrelayd"}}
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+	}
+	creds := &agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}
+
+	// deployment created by an older operator version
+	current := r.newDeploymentForCR(creds, instance)
+	current.Spec.Template.Spec.Containers[0].Env[1] = corev1.EnvVar{Name: containerTokenKeyEnvName, Value: "key"}
+	current.Spec.Template.Spec.Containers[0].Env[2] = corev1.EnvVar{Name: containerTokenSecretEnvName, Value: "secret"}
+	assert.Assert(t, deploymentHasInlinedCredentials(current))
+
+	patched, equal := r.checkDeployment(creds, instance, current)
+	assert.Assert(t, !equal)
+	assert.Assert(t, !deploymentHasInlinedCredentials(patched))
+	assert.Equal(t, "fwd-whr-credentials", patched.Spec.Template.Spec.Containers[0].Env[2].ValueFrom.SecretKeyRef.Name)
+}
@@ -0,0 +1,155 @@
+package webhookrelayforward
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// readinessConditions must all be true for the CR to be Ready
+var readinessConditions = []forwardv1.ConditionType{
+	forwardv1.ConditionCredentialsValid,
+	forwardv1.ConditionBucketsReady,
+	forwardv1.ConditionInputsReady,
+	forwardv1.ConditionOutputsReady,
+	forwardv1.ConditionAgentAvailable,
+}
+
+func newCondition(t forwardv1.ConditionType, generation int64, ok bool, reason, message string) forwardv1.Condition {
+	status := corev1.ConditionFalse
+	if ok {
+		status = corev1.ConditionTrue
+	}
+	return forwardv1.Condition{
+		Type:               t,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+func newUnknownCondition(t forwardv1.ConditionType, generation int64, reason, message string) forwardv1.Condition {
+	return forwardv1.Condition{
+		Type:               t,
+		Status:             corev1.ConditionUnknown,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// errorCondition sets condition to true if there are no errors, otherwise
+// to false with all errors in the message
+func errorCondition(t forwardv1.ConditionType, generation int64, errs []string) forwardv1.Condition {
+	if len(errs) == 0 {
+		return newCondition(t, generation, true, forwardv1.ReasonConfigured, "")
+	}
+	return newCondition(t, generation, false, forwardv1.ReasonConfigFailed, strings.Join(errs, ", "))
+}
+
+// isInvalidCredentialsError checks whether Webhook Relay API rejected the credentials
+func isInvalidCredentialsError(err error) bool {
+	return strings.Contains(err.Error(), "invalid credentials")
+}
+
+// setCredentialsNotFound is used when API client couldn't be configured
+func setCredentialsNotFound(status *forwardv1.WebhookRelayForwardStatus, generation int64, err error) {
+	status.SetCondition(newCondition(forwardv1.ConditionCredentialsValid, generation, false,
+		forwardv1.ReasonCredentialsNotFound, err.Error()))
+	status.RoutingStatus = forwardv1.RoutingStatusFailed
+	status.Message = err.Error()
+}
+
+// setRoutingStatus records routing configuration results in the status
+func (r *ReconcileWebhookRelayForward) setRoutingStatus(status *forwardv1.WebhookRelayForwardStatus, instance *forwardv1.WebhookRelayForward, result *routingResult) {
+	generation := instance.GetGeneration()
+
+	if err := result.err(); err != nil {
+		status.RoutingStatus = forwardv1.RoutingStatusFailed
+		status.Message = "encountered errors (" + err.Error() + ") while ensuring routing configuration, check your CR spec"
+	} else {
+		status.RoutingStatus = forwardv1.RoutingStatusConfigured
+		status.Message = ""
+	}
+
+	if !result.ownership.checked {
+		setBucketsNotChecked(status, generation, result.listErr)
+		// keeping previously observed bucket states
+		return
+	}
+
+	status.Buckets = result.bucketStatuses(instance)
+
+	status.SetCondition(newCondition(forwardv1.ConditionCredentialsValid, generation, true,
+		forwardv1.ReasonCredentialsAccepted, ""))
+
+	ownership := ownershipCondition(result.ownership)
+	ownership.ObservedGeneration = generation
+	status.SetCondition(ownership)
+
+	status.SetCondition(errorCondition(forwardv1.ConditionBucketsReady, generation, result.errs.messages(kindBucket)))
+	status.SetCondition(errorCondition(forwardv1.ConditionInputsReady, generation, result.errs.messages(kindInput)))
+	status.SetCondition(errorCondition(forwardv1.ConditionOutputsReady, generation, result.errs.messages(kindOutput)))
+
+	status.PublicEndpoints = result.publicEndpoints
+
+	setDriftStatus(status, result.drift)
+	status.Plan = nil
+}
+
+// setBucketsNotChecked is used when buckets couldn't be listed, nothing can be
+// told about the routing configuration then
+func setBucketsNotChecked(status *forwardv1.WebhookRelayForwardStatus, generation int64, listErr error) {
+	if isInvalidCredentialsError(listErr) {
+		status.SetCondition(newCondition(forwardv1.ConditionCredentialsValid, generation, false,
+			forwardv1.ReasonInvalidCredentials, listErr.Error()))
+	} else {
+		status.SetCondition(newUnknownCondition(forwardv1.ConditionCredentialsValid, generation,
+			forwardv1.ReasonAPIUnavailable, listErr.Error()))
+	}
+	for _, t := range []forwardv1.ConditionType{
+		forwardv1.ConditionBucketsReady,
+		forwardv1.ConditionInputsReady,
+		forwardv1.ConditionOutputsReady,
+	} {
+		status.SetCondition(newUnknownCondition(t, generation, forwardv1.ReasonNotChecked, "failed to list buckets"))
+	}
+}
+
+func setBucketSynced(status *forwardv1.BucketStatus, id string) {
+	status.ID = id
+	status.State = forwardv1.SyncStateSynced
+	status.LastError = ""
+}
+
+func setBucketFailed(status *forwardv1.BucketStatus, err error) {
+	status.State = forwardv1.SyncStateFailed
+	status.LastError = err.Error()
+}
+
+// setAgentStatus records agent deployment state in the status
+func setAgentStatus(status *forwardv1.WebhookRelayForwardStatus, generation int64, agentStatus forwardv1.AgentStatus, ready bool, reason, message string) {
+	status.AgentStatus = agentStatus
+	status.Ready = ready
+	status.SetCondition(newCondition(forwardv1.ConditionAgentAvailable, generation, ready, reason, message))
+}
+
+// setReadyCondition sets Ready condition based on all other conditions
+func setReadyCondition(status *forwardv1.WebhookRelayForwardStatus, generation int64) {
+	var notReady []string
+	for _, t := range readinessConditions {
+		if !status.IsConditionTrue(t) {
+			notReady = append(notReady, string(t))
+		}
+	}
+
+	if len(notReady) > 0 {
+		status.SetCondition(newCondition(forwardv1.ConditionReady, generation, false,
+			forwardv1.ReasonNotReady, "waiting for: "+strings.Join(notReady, ", ")))
+		return
+	}
+	status.SetCondition(newCondition(forwardv1.ConditionReady, generation, true, forwardv1.ReasonReady, ""))
+}
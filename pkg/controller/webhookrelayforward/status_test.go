@@ -0,0 +1,54 @@
+package webhookrelayforward
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestSetReadyCondition(t *testing.T) {
+	status := &forwardv1.WebhookRelayForwardStatus{}
+
+	for _, ct := range readinessConditions {
+		status.SetCondition(newCondition(ct, 2, true, forwardv1.ReasonConfigured, ""))
+	}
+	setReadyCondition(status, 2)
+
+	ready := status.GetCondition(forwardv1.ConditionReady)
+	assert.Equal(t, corev1.ConditionTrue, ready.Status)
+	assert.Equal(t, int64(2), ready.ObservedGeneration)
+	transitioned := ready.LastTransitionTime
+
+	status.SetCondition(errorCondition(forwardv1.ConditionOutputsReady, 3, []string{"failed to create output"}))
+	setReadyCondition(status, 3)
+
+	ready = status.GetCondition(forwardv1.ConditionReady)
+	assert.Equal(t, corev1.ConditionFalse, ready.Status)
+	assert.Equal(t, "waiting for: OutputsReady", ready.Message)
+
+	// setting the same status again shouldn't change transition time
+	setReadyCondition(status, 3)
+	assert.Equal(t, ready.LastTransitionTime, status.GetCondition(forwardv1.ConditionReady).LastTransitionTime)
+	assert.Assert(t, !transitioned.After(ready.LastTransitionTime.Time))
+}
+
+func TestSetRoutingStatus_InvalidCredentials(t *testing.T) {
+	r := &ReconcileWebhookRelayForward{}
+	status := &forwardv1.WebhookRelayForwardStatus{}
+
+	result := newRoutingResult()
+	result.listErr = fmt.Errorf("failed to list buckets, error: HTTP status 401: invalid credentials")
+
+	r.setRoutingStatus(status, &forwardv1.WebhookRelayForward{}, result)
+
+	assert.Equal(t, forwardv1.RoutingStatusFailed, status.RoutingStatus)
+	credentials := status.GetCondition(forwardv1.ConditionCredentialsValid)
+	assert.Equal(t, corev1.ConditionFalse, credentials.Status)
+	assert.Equal(t, forwardv1.ReasonInvalidCredentials, credentials.Reason)
+	assert.Equal(t, corev1.ConditionUnknown, status.GetCondition(forwardv1.ConditionBucketsReady).Status)
+}
@@ -1,79 +1,142 @@
 package webhookrelayforward
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/webhookrelay/webhookrelay-go"
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
 )
 
-func (r *ReconcileWebhookRelayForward) ensureBucketConfiguration(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
-	var (
-		err    error
-		errors []string
-	)
+// bucketsOwnership records which buckets from the spec the CR is allowed to manage
+// and the reasons for the ones it's not
+type bucketsOwnership struct {
+	// checked is set once existing buckets were listed and ownership
+	// could be verified
+	checked bool
+	managed map[string]bool
+	// problems found while checking ownership, indexed by the decision
+	problems map[ownershipDecision][]string
+}
+
+func newBucketsOwnership() *bucketsOwnership {
+	return &bucketsOwnership{
+		managed:  make(map[string]bool),
+		problems: make(map[ownershipDecision][]string),
+	}
+}
 
-	buckets, err := r.apiClient.client.ListBuckets(&webhookrelay.BucketListOptions{})
+// ensureBucketConfiguration creates or updates buckets from the spec. Ownership, state and errors of
+// each bucket are recorded in the routing result, returned error is only set when buckets
+// couldn't be listed.
+func (r *ReconcileWebhookRelayForward) ensureBucketConfiguration(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward, result *routingResult) error {
+	ownership := result.ownership
+
+	buckets, err := apiClient.listBuckets()
 	if err != nil {
 		return fmt.Errorf("failed to list buckets, error: %w", err)
 	}
-	// Updating buckets cache
-	r.apiClient.bucketsCache.Set(buckets)
+	ownership.checked = true
+
+	crOwner := ownerForCR(instance)
 
 	for i := range instance.Spec.Buckets {
-		if instance.Spec.Buckets[i].Description == "" {
-			instance.Spec.Buckets[i].Description = getBucketDescription(instance)
+		bucketStatus := result.bucketStatus(instance.Spec.Buckets[i].Name)
+
+		// desired bucket spec carries the ownership marker in its description,
+		// the spec itself is never modified
+		desired := instance.Spec.Buckets[i].DeepCopy()
+		if desired.Description == "" {
+			desired.Description = getBucketDescription(instance)
+		}
+		desired.Description = withOwnershipMarker(desired.Description, crOwner)
+
+		// Resolving authentication credentials, if they can't be loaded, bucket is
+		// not touched so we don't end up with an unprotected bucket
+		auth, err := r.desiredBucketAuth(instance, desired)
+		if err != nil {
+			logger.Error(err, "failed to get bucket authentication configuration",
+				"bucket_ref", instance.Spec.Buckets[i].Name,
+			)
+			setBucketFailed(bucketStatus, err)
+			result.errs = append(result.errs, newRoutingError(kindBucket, opConfigure, desired.Name, "", err))
+			continue
 		}
 
 		existingBucket, ok := getBucketByName(instance.Spec.Buckets[i].Name, buckets)
 		if !ok {
 			// Create a new bucket based on the provided BucketSpec
-			// TODO: add authentication settings to CRD (https://github.com/webhookrelay/webhookrelay-operator/issues/2)
-			created, err := r.apiClient.client.CreateBucket(&webhookrelay.BucketCreateOptions{
-				Name:        instance.Spec.Buckets[i].Name,
-				Description: instance.Spec.Buckets[i].Description,
-			})
+			created, err := createBucket(apiClient, desired, auth)
 			if err != nil {
 				logger.Error(err, "failed to create bucket",
 					"bucket_ref", instance.Spec.Buckets[i].Name,
 				)
+				setBucketFailed(bucketStatus, err)
+				result.errs = append(result.errs, newRoutingError(kindBucket, opCreate, desired.Name, "", err))
 			} else {
-				r.apiClient.bucketsCache.Add(created)
+				apiClient.bucketsCache.Add(created)
+				ownership.managed[created.Name] = true
+				setBucketSynced(bucketStatus, created.ID)
 			}
 			continue
 		}
+		bucketStatus.ID = existingBucket.ID
+
+		decision, reason := r.checkBucketOwnership(instance, &instance.Spec.Buckets[i], existingBucket)
+		if decision != ownershipManage {
+			logger.Info("not managing bucket",
+				"bucket_ref", instance.Spec.Buckets[i].Name,
+				"reason", reason,
+			)
+			ownership.problems[decision] = append(ownership.problems[decision], reason)
+			bucketStatus.State = forwardv1.SyncStateUnmanaged
+			bucketStatus.LastError = ""
+			if decision != ownershipSkip {
+				bucketStatus.LastError = reason
+				result.errs = append(result.errs, newRoutingError(kindBucket, opAdopt, desired.Name, "", errors.New(reason)))
+			}
+			continue
+		}
+		ownership.managed[existingBucket.Name] = true
+		desired.Description = withOwnershipMarker(desired.Description, managingOwner(crOwner, existingBucket.Description))
 
 		// Check if equal
-		if bucketEqual(&instance.Spec.Buckets[i], existingBucket) {
+		fields := diffBucket(desired, auth, existingBucket)
+		if len(fields) == 0 {
 			// Bucket is matching the spec, nothing to do
+			setBucketSynced(bucketStatus, existingBucket.ID)
 			continue
 		}
 		// Bucket has changed, requires an update
-		updated, err := r.apiClient.client.UpdateBucket(patchBucketFromSpec(existingBucket, &instance.Spec.Buckets[i]))
+		updated, err := apiClient.client.UpdateBucket(patchBucketFromSpec(existingBucket, desired, auth))
 		if err != nil {
 			logger.Error(err, "failed to update bucket",
 				"bucket_ref", instance.Spec.Buckets[i].Name,
 			)
+			setBucketFailed(bucketStatus, err)
+			result.errs = append(result.errs, newRoutingError(kindBucket, opUpdate, desired.Name, "", err))
 		} else {
-			r.apiClient.bucketsCache.Add(updated)
+			apiClient.bucketsCache.Add(updated)
+			setBucketSynced(bucketStatus, updated.ID)
 			logger.Info("bucket updated to match the spec",
 				"bucket_ref", instance.Spec.Buckets[i].Name,
+				"fields", fields,
 			)
+			result.addDrift(instance, driftChange{kind: kindBucket, bucket: desired.Name, fields: fields})
 		}
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("failed to configure one or more buckets: %s", strings.Join(errors, ", "))
-	}
-
 	return nil
 }
 
 func getBucketDescription(instance *forwardv1.WebhookRelayForward) string {
-	return fmt.Sprintf("Auto-created bucket by the operator for %s/%s", instance.GetNamespace(), instance.GetName())
+	return forwardv1.DefaultBucketDescription(instance.GetNamespace(), instance.GetName())
 }
 
 func getBucketByName(name string, buckets []*webhookrelay.Bucket) (*webhookrelay.Bucket, bool) {
@@ -85,25 +148,124 @@ func getBucketByName(name string, buckets []*webhookrelay.Bucket) (*webhookrelay
 	return nil, false
 }
 
-//nolint
-func bucketEqual(spec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket) bool {
+// createBucket creates a bucket and, since authentication can't be set during the
+// creation, updates it with the desired authentication settings
+func createBucket(apiClient *WebhookRelayClient, spec *forwardv1.BucketSpec, auth *webhookrelay.BucketAuth) (*webhookrelay.Bucket, error) {
+	created, err := apiClient.client.CreateBucket(&webhookrelay.BucketCreateOptions{
+		Name:        spec.Name,
+		Description: spec.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if auth == nil || auth.Type == webhookrelay.AuthTypeNone {
+		return created, nil
+	}
 
-	if spec.Description != bucket.Description {
+	updated, err := apiClient.client.UpdateBucket(patchBucketFromSpec(created, spec, auth))
+	if err != nil {
+		return created, fmt.Errorf("bucket created, but failed to configure authentication: %w", err)
+	}
+	return updated, nil
+}
+
+// desiredBucketAuth builds bucket authentication settings from the spec and referenced secret.
+// Returns nil if authentication is not managed by the operator.
+func (r *ReconcileWebhookRelayForward) desiredBucketAuth(instance *forwardv1.WebhookRelayForward, spec *forwardv1.BucketSpec) (*webhookrelay.BucketAuth, error) {
+	return bucketAuthFromSecret(r.client, instance.GetNamespace(), spec)
+}
+
+// bucketAuthFromSecret builds bucket authentication settings, secret is read from the namespace
+func bucketAuthFromSecret(c client.Client, namespace string, spec *forwardv1.BucketSpec) (*webhookrelay.BucketAuth, error) {
+	if spec.Auth == nil {
+		return nil, nil
+	}
+
+	switch spec.Auth.Type {
+	case forwardv1.BucketAuthTypeNone, "":
+		return &webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeNone}, nil
+	case forwardv1.BucketAuthTypeBasic, forwardv1.BucketAuthTypeToken:
+		// credentials are required
+	default:
+		return nil, fmt.Errorf("bucket '%s' has unknown authentication type '%s'", spec.Name, spec.Auth.Type)
+	}
+
+	if spec.Auth.SecretRefName == "" {
+		return nil, fmt.Errorf("bucket '%s' authentication secret is not specified", spec.Name)
+	}
+
+	secret := &corev1.Secret{}
+	err := c.Get(context.TODO(), types.NamespacedName{
+		Namespace: namespace,
+		Name:      spec.Auth.SecretRefName,
+	}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket '%s' authentication secret: %w", spec.Name, err)
+	}
+
+	if spec.Auth.Type == forwardv1.BucketAuthTypeToken {
+		token := string(secret.Data[forwardv1.BucketAuthTokenName])
+		if token == "" {
+			return nil, fmt.Errorf("bucket '%s' authentication secret '%s' doesn't have '%s' field",
+				spec.Name, spec.Auth.SecretRefName, forwardv1.BucketAuthTokenName)
+		}
+		return &webhookrelay.BucketAuth{
+			Type:  webhookrelay.AuthTypeToken,
+			Token: token,
+		}, nil
+	}
+
+	username := string(secret.Data[forwardv1.BucketAuthUsernameName])
+	password := string(secret.Data[forwardv1.BucketAuthPasswordName])
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("bucket '%s' authentication secret '%s' should have '%s' and '%s' fields",
+			spec.Name, spec.Auth.SecretRefName, forwardv1.BucketAuthUsernameName, forwardv1.BucketAuthPasswordName)
+	}
+	return &webhookrelay.BucketAuth{
+		Type:     webhookrelay.AuthTypeBasic,
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+func bucketEqual(spec *forwardv1.BucketSpec, auth *webhookrelay.BucketAuth, bucket *webhookrelay.Bucket) bool {
+	return len(diffBucket(spec, auth, bucket)) == 0
+}
+
+// bucketAuthEqual compares bucket authentication settings. Password and token are only
+// compared if the server returns them.
+func bucketAuthEqual(current, desired *webhookrelay.BucketAuth) bool {
+	if current.Type != desired.Type {
 		return false
 	}
 
-	// TODO: check auth
+	switch desired.Type {
+	case webhookrelay.AuthTypeBasic:
+		if current.Username != desired.Username {
+			return false
+		}
+		if current.Password != "" && current.Password != desired.Password {
+			return false
+		}
+	case webhookrelay.AuthTypeToken:
+		if current.Token != "" && current.Token != desired.Token {
+			return false
+		}
+	}
 
 	return true
 }
 
-func patchBucketFromSpec(bucket *webhookrelay.Bucket, spec *forwardv1.BucketSpec) *webhookrelay.Bucket {
+func patchBucketFromSpec(bucket *webhookrelay.Bucket, spec *forwardv1.BucketSpec, auth *webhookrelay.BucketAuth) *webhookrelay.Bucket {
 	updated := new(webhookrelay.Bucket)
 	*updated = *bucket
 
 	updated.Description = spec.Description
+	if auth != nil {
+		updated.Auth = *auth
+	}
 	// TODO: update name?
-	// TODO: update auth?
 
 	return updated
 }
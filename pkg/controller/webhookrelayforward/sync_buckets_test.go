@@ -0,0 +1,84 @@
+package webhookrelayforward
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestDesiredBucketAuth(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bucket-auth", Namespace: "default"},
+		Data: map[string][]byte{
+			forwardv1.BucketAuthUsernameName: []byte("user"),
+			forwardv1.BucketAuthPasswordName: []byte("pass"),
+			forwardv1.BucketAuthTokenName:    []byte("tkn"),
+		},
+	}
+
+	r := &ReconcileWebhookRelayForward{
+		client: fake.NewFakeClientWithScheme(s, secret),
+	}
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+	}
+
+	t.Run("TestNotManaged", func(t *testing.T) {
+		auth, err := r.desiredBucketAuth(instance, &forwardv1.BucketSpec{Name: "b"})
+		assert.NilError(t, err)
+		assert.Assert(t, auth == nil)
+	})
+
+	t.Run("TestBasic", func(t *testing.T) {
+		auth, err := r.desiredBucketAuth(instance, &forwardv1.BucketSpec{
+			Name: "b",
+			Auth: &forwardv1.BucketAuth{Type: forwardv1.BucketAuthTypeBasic, SecretRefName: "bucket-auth"},
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, &webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeBasic, Username: "user", Password: "pass"}, auth)
+	})
+
+	t.Run("TestToken", func(t *testing.T) {
+		auth, err := r.desiredBucketAuth(instance, &forwardv1.BucketSpec{
+			Name: "b",
+			Auth: &forwardv1.BucketAuth{Type: forwardv1.BucketAuthTypeToken, SecretRefName: "bucket-auth"},
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, &webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeToken, Token: "tkn"}, auth)
+	})
+
+	t.Run("TestMissingSecret", func(t *testing.T) {
+		_, err := r.desiredBucketAuth(instance, &forwardv1.BucketSpec{
+			Name: "b",
+			Auth: &forwardv1.BucketAuth{Type: forwardv1.BucketAuthTypeToken, SecretRefName: "missing"},
+		})
+		assert.ErrorContains(t, err, "failed to get bucket 'b' authentication secret")
+	})
+}
+
+func TestBucketEqual_Auth(t *testing.T) {
+	spec := &forwardv1.BucketSpec{Name: "b", Description: "desc"}
+	bucket := &webhookrelay.Bucket{
+		Name:        "b",
+		Description: "desc",
+		Auth:        webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeBasic, Username: "user"},
+	}
+
+	// authentication is not managed, any server side settings are fine
+	assert.Assert(t, bucketEqual(spec, nil, bucket))
+	// password is not returned by the server, can't compare it
+	assert.Assert(t, bucketEqual(spec, &webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeBasic, Username: "user", Password: "pass"}, bucket))
+	assert.Assert(t, !bucketEqual(spec, &webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeBasic, Username: "other", Password: "pass"}, bucket))
+	assert.Assert(t, !bucketEqual(spec, &webhookrelay.BucketAuth{Type: webhookrelay.AuthTypeNone}, bucket))
+}
@@ -9,16 +9,38 @@ import (
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
 )
 
-// ensureBucketInputs checks and configures input specific information
-func (r *ReconcileWebhookRelayForward) ensureBucketInputs(logger logr.Logger, bucketSpec *forwardv1.BucketSpec) error {
+// ensureBucketInputs checks and configures input specific information, returns
+// the state of each input from the spec and the inputs that were updated to match it
+func (r *ReconcileWebhookRelayForward) ensureBucketInputs(logger logr.Logger, apiClient *WebhookRelayClient, crOwner owner, bucketSpec *forwardv1.BucketSpec) ([]forwardv1.InputStatus, []driftChange, routingErrors) {
 	// If no inputs are defined, nothing to do
 	if len(bucketSpec.Inputs) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
-	bucket, ok := r.apiClient.bucketsCache.Get(bucketSpec.Name)
+	statuses := make([]forwardv1.InputStatus, len(bucketSpec.Inputs))
+	statusIdx := make(map[string]int)
+	for i := range bucketSpec.Inputs {
+		statuses[i] = forwardv1.InputStatus{
+			Name:  bucketSpec.Inputs[i].Name,
+			State: forwardv1.SyncStatePending,
+		}
+		statusIdx[bucketSpec.Inputs[i].Name] = i
+	}
+
+	bucket, ok := apiClient.bucketsCache.Get(bucketSpec.Name)
 	if !ok {
-		return fmt.Errorf("bucket '%s' not found in the cache, will wait for the next reconcile loop", bucketSpec.Name)
+		return statuses, nil, routingErrors{newRoutingError(kindInput, opSync, bucketSpec.Name, "",
+			fmt.Errorf("bucket not found in the cache, will wait for the next reconcile loop"))}
+	}
+
+	// inputs that already exist are synced unless create or
+	// update below fails
+	for _, input := range bucket.Inputs {
+		if i, ok := statusIdx[input.Name]; ok {
+			statuses[i].ID = input.ID
+			statuses[i].EndpointURL = input.EndpointURL()
+			statuses[i].State = forwardv1.SyncStateSynced
+		}
 	}
 
 	logger = logger.WithValues(
@@ -29,11 +51,17 @@ func (r *ReconcileWebhookRelayForward) ensureBucketInputs(logger logr.Logger, bu
 	// Create a list of desired inputs and then diff existing
 	// ones against them to build a list of what inputs
 	// we should create, update and which ones to delete
-	desired := desiredInputs(bucketSpec, bucket)
+	desired := desiredInputs(bucketSpec, bucket, crOwner)
 
 	diff := getInputsDiff(bucket.Inputs, desired)
 
-	var err error
+	var (
+		err     error
+		errs    routingErrors
+		changes []driftChange
+		created *webhookrelay.Input
+		updated *webhookrelay.Input
+	)
 
 	// Create inputs that need to be created
 	for idx := range diff.create {
@@ -41,23 +69,43 @@ func (r *ReconcileWebhookRelayForward) ensureBucketInputs(logger logr.Logger, bu
 			"input_id", diff.create[idx].ID,
 			"input_name", diff.create[idx].Name,
 		)
-		_, err = r.apiClient.client.CreateInput(diff.create[idx])
+		status := &statuses[statusIdx[diff.create[idx].Name]]
+		created, err = apiClient.client.CreateInput(diff.create[idx])
 		if err != nil {
 			logger.Error(err, "failed to create input")
+			status.State = forwardv1.SyncStateFailed
+			status.LastError = err.Error()
+			errs = append(errs, newRoutingError(kindInput, opCreate, bucketSpec.Name, diff.create[idx].Name, err))
+			continue
 		}
+		status.ID = created.ID
+		status.EndpointURL = created.EndpointURL()
+		status.State = forwardv1.SyncStateSynced
+		apiClient.bucketsCache.AddInput(created)
+		changes = append(changes, driftChange{kind: kindInput, bucket: bucketSpec.Name, name: diff.create[idx].Name, fields: []string{driftFieldDeleted}})
 	}
 
 	for idx := range diff.update {
+		fields := diff.fields[diff.update[idx].Name]
 		logger.Info("updating input",
 			"input_id", diff.update[idx].ID,
 			"input_name", diff.update[idx].Name,
+			"fields", fields,
 		)
-		_, err = r.apiClient.client.UpdateInput(diff.update[idx])
+		status := &statuses[statusIdx[diff.update[idx].Name]]
+		updated, err = apiClient.client.UpdateInput(diff.update[idx])
 		if err != nil {
 			logger.Error(err, "failed to update input",
 				"input_id", diff.update[idx].ID,
 			)
+			status.State = forwardv1.SyncStateFailed
+			status.LastError = err.Error()
+			errs = append(errs, newRoutingError(kindInput, opUpdate, bucketSpec.Name, diff.update[idx].Name, err))
+			continue
 		}
+		status.EndpointURL = updated.EndpointURL()
+		apiClient.bucketsCache.AddInput(updated)
+		changes = append(changes, driftChange{kind: kindInput, bucket: bucketSpec.Name, name: updated.Name, fields: fields})
 	}
 
 	for idx := range diff.delete {
@@ -65,25 +113,28 @@ func (r *ReconcileWebhookRelayForward) ensureBucketInputs(logger logr.Logger, bu
 			"input_id", diff.delete[idx].ID,
 			"input_name", diff.delete[idx].Name,
 		)
-		err = r.apiClient.client.DeleteInput(&webhookrelay.InputDeleteOptions{
+		err = apiClient.client.DeleteInput(&webhookrelay.InputDeleteOptions{
 			Bucket: diff.delete[idx].BucketID,
 			Input:  diff.delete[idx].ID,
 		})
 		if err != nil {
 			logger.Error(err, "failed to delete input",
-				"input_id", diff.update[idx].ID,
+				"input_id", diff.delete[idx].ID,
 			)
+			errs = append(errs, newRoutingError(kindInput, opDelete, bucketSpec.Name, diff.delete[idx].Name, err))
 		}
 	}
 
-	return nil
+	return statuses, changes, errs
 }
 
-func desiredInputs(bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket) []*webhookrelay.Input {
+func desiredInputs(bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket, crOwner owner) []*webhookrelay.Input {
 	var desired []*webhookrelay.Input
 
 	for i := range bucketSpec.Inputs {
-		desired = append(desired, inputSpecToInput(&bucketSpec.Inputs[i], bucket))
+		input := inputSpecToInput(&bucketSpec.Inputs[i], bucket)
+		input.Description = withOwnershipMarker(input.Description, crOwner)
+		desired = append(desired, input)
 	}
 
 	return desired
@@ -92,13 +143,14 @@ func desiredInputs(bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket
 func inputSpecToInput(spec *forwardv1.InputSpec, bucket *webhookrelay.Bucket) *webhookrelay.Input {
 	// Ensuring that ResponseFromOutput is either empty, 'anyOutput' or an actual ID
 	// of the output that is inside this bucket
-	if spec.ResponseFromOutput != "" && spec.ResponseFromOutput != "anyOutput" {
+	responseFromOutput := spec.ResponseFromOutput
+	if responseFromOutput != "" && responseFromOutput != forwardv1.ResponseFromAnyOutput {
 		// checking maybe it's specified by name
 		for idx := range bucket.Outputs {
 			output := bucket.Outputs[idx]
 			if output.Name == spec.ResponseFromOutput || output.ID == spec.ResponseFromOutput {
 				// found it
-				spec.ResponseFromOutput = output.ID
+				responseFromOutput = output.ID
 				break
 			}
 		}
@@ -111,7 +163,7 @@ func inputSpecToInput(spec *forwardv1.InputSpec, bucket *webhookrelay.Bucket) *w
 		Headers:            spec.ResponseHeaders,
 		StatusCode:         spec.ResponseStatusCode,
 		Body:               spec.ResponseBody,
-		ResponseFromOutput: spec.ResponseFromOutput,
+		ResponseFromOutput: responseFromOutput,
 		PathPrefix:         spec.PathPrefix,
 		Description:        spec.Description,
 	}
@@ -140,7 +192,7 @@ func getInputFromBucket(name string, bucket *webhookrelay.Bucket) (*webhookrelay
 }
 
 func getInputsDiff(current, desired []*webhookrelay.Input) *inputsDiff {
-	diff := &inputsDiff{}
+	diff := &inputsDiff{fields: make(map[string][]string)}
 
 	currentMap := make(map[string]*webhookrelay.Input)
 
@@ -154,12 +206,14 @@ func getInputsDiff(current, desired []*webhookrelay.Input) *inputsDiff {
 			diff.create = append(diff.create, desired[i])
 			continue
 		}
-		if inputEqual(currentInput, desired[i]) {
+		fields := diffInput(currentInput, desired[i])
+		if len(fields) == 0 {
 			// Nothing to do
 			continue
 		}
 		// Setting ID and adding to the update list
 		desired[i].ID = currentInput.ID
+		diff.fields[desired[i].Name] = fields
 		diff.update = append(diff.update, desired[i])
 	}
 
@@ -171,48 +225,12 @@ func getInputsDiff(current, desired []*webhookrelay.Input) *inputsDiff {
 	return diff
 }
 
-func inputEqual(current, desired *webhookrelay.Input) bool {
-	if current.FunctionID != desired.FunctionID {
-		return false
-	}
-	if current.StatusCode != desired.StatusCode {
-		return false
-	}
-	if current.Body != desired.Body {
-		return false
-	}
-
-	if len(current.Headers) != len(desired.Headers) {
-		for k := range current.Headers {
-			if !sliceEqual(current.Headers[k], desired.Headers[k]) {
-				return false
-			}
-		}
-	}
-
-	if current.ResponseFromOutput != desired.ResponseFromOutput {
-		return false
-	}
-
-	if current.CustomDomain != desired.CustomDomain {
-		return false
-	}
-
-	if current.PathPrefix != desired.PathPrefix {
-		return false
-	}
-
-	if current.Description != desired.Description {
-		return false
-	}
-
-	return true
-}
-
 type inputsDiff struct {
 	create []*webhookrelay.Input
 	update []*webhookrelay.Input
 	delete []*webhookrelay.Input
+	// fields that don't match the spec, indexed by input name
+	fields map[string][]string
 }
 
 func sliceEqual(a, b []string) bool {
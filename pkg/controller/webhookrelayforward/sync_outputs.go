@@ -9,15 +9,38 @@ import (
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
 )
 
-func (r *ReconcileWebhookRelayForward) ensureBucketOutputs(logger logr.Logger, bucketSpec *forwardv1.BucketSpec) error {
+// ensureBucketOutputs configures bucket outputs and returns the state of each
+// output from the spec and the outputs that were updated to match it
+func (r *ReconcileWebhookRelayForward) ensureBucketOutputs(logger logr.Logger, apiClient *WebhookRelayClient, crOwner owner, bucketSpec *forwardv1.BucketSpec) ([]forwardv1.OutputStatus, []driftChange, routingErrors) {
 	// If no outputs are defined, nothing to do
 	if len(bucketSpec.Outputs) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
-	bucket, ok := r.apiClient.bucketsCache.Get(bucketSpec.Name)
+	statuses := make([]forwardv1.OutputStatus, len(bucketSpec.Outputs))
+	statusIdx := make(map[string]int)
+	for i := range bucketSpec.Outputs {
+		statuses[i] = forwardv1.OutputStatus{
+			Name:        bucketSpec.Outputs[i].Name,
+			Destination: bucketSpec.Outputs[i].Destination,
+			State:       forwardv1.SyncStatePending,
+		}
+		statusIdx[bucketSpec.Outputs[i].Name] = i
+	}
+
+	bucket, ok := apiClient.bucketsCache.Get(bucketSpec.Name)
 	if !ok {
-		return fmt.Errorf("bucket '%s' not found in the cache, will wait for the next reconcile loop", bucketSpec.Name)
+		return statuses, nil, routingErrors{newRoutingError(kindOutput, opSync, bucketSpec.Name, "",
+			fmt.Errorf("bucket not found in the cache, will wait for the next reconcile loop"))}
+	}
+
+	// outputs that already exist are synced unless create or
+	// update below fails
+	for _, output := range bucket.Outputs {
+		if i, ok := statusIdx[output.Name]; ok {
+			statuses[i].ID = output.ID
+			statuses[i].State = forwardv1.SyncStateSynced
+		}
 	}
 
 	logger = logger.WithValues(
@@ -28,42 +51,58 @@ func (r *ReconcileWebhookRelayForward) ensureBucketOutputs(logger logr.Logger, b
 	// Create a list of desired outputs and then diff existing
 	// ones against them to build a list of what outputs
 	// we should create, update and which ones to delete
-	desired := desiredOutputs(bucketSpec, bucket)
-	diff := getOutputsDiff(bucket.Outputs, desired)
+	desired := desiredOutputs(bucketSpec, bucket, crOwner)
+	diff := getOutputsDiff(bucket.Outputs, desired, crOwner)
 
 	var (
 		err     error
+		errs    routingErrors
+		changes []driftChange
 		created *webhookrelay.Output
 		updated *webhookrelay.Output
 	)
-	// Create inputs that need to be created
+	// Create outputs that need to be created
 	for idx := range diff.create {
 		logger.Info("creating output",
 			"output_id", diff.create[idx].ID,
 			"output_name", diff.create[idx].Name,
 		)
-		created, err = r.apiClient.client.CreateOutput(diff.create[idx])
+		status := &statuses[statusIdx[diff.create[idx].Name]]
+		created, err = apiClient.client.CreateOutput(diff.create[idx])
 		if err != nil {
 			logger.Error(err, "failed to create output")
+			status.State = forwardv1.SyncStateFailed
+			status.LastError = err.Error()
+			errs = append(errs, newRoutingError(kindOutput, opCreate, bucketSpec.Name, diff.create[idx].Name, err))
 			continue
 		}
+		status.ID = created.ID
+		status.State = forwardv1.SyncStateSynced
 		// updating cache
-		r.apiClient.bucketsCache.AddOutput(created)
+		apiClient.bucketsCache.AddOutput(created)
+		changes = append(changes, driftChange{kind: kindOutput, bucket: bucketSpec.Name, name: diff.create[idx].Name, fields: []string{driftFieldDeleted}})
 	}
 
 	for idx := range diff.update {
+		fields := diff.fields[diff.update[idx].Name]
 		logger.Info("updating output",
 			"output_id", diff.update[idx].ID,
 			"output_name", diff.update[idx].Name,
+			"fields", fields,
 		)
-		updated, err = r.apiClient.client.UpdateOutput(diff.update[idx])
+		status := &statuses[statusIdx[diff.update[idx].Name]]
+		updated, err = apiClient.client.UpdateOutput(diff.update[idx])
 		if err != nil {
-			logger.Error(err, "failed to update input",
-				"input_id", diff.update[idx].ID,
+			logger.Error(err, "failed to update output",
+				"output_id", diff.update[idx].ID,
 			)
+			status.State = forwardv1.SyncStateFailed
+			status.LastError = err.Error()
+			errs = append(errs, newRoutingError(kindOutput, opUpdate, bucketSpec.Name, diff.update[idx].Name, err))
 			continue
 		}
-		r.apiClient.bucketsCache.AddOutput(updated)
+		apiClient.bucketsCache.AddOutput(updated)
+		changes = append(changes, driftChange{kind: kindOutput, bucket: bucketSpec.Name, name: updated.Name, fields: fields})
 	}
 
 	for idx := range diff.delete {
@@ -71,28 +110,34 @@ func (r *ReconcileWebhookRelayForward) ensureBucketOutputs(logger logr.Logger, b
 			"output_id", diff.delete[idx].ID,
 			"output_name", diff.delete[idx].Name,
 		)
-		err = r.apiClient.client.DeleteOutput(&webhookrelay.OutputDeleteOptions{
+		err = apiClient.client.DeleteOutput(&webhookrelay.OutputDeleteOptions{
 			Bucket: diff.delete[idx].BucketID,
 			Output: diff.delete[idx].ID,
 		})
 		if err != nil {
 			logger.Error(err, "failed to delete output",
-				"output_id", diff.update[idx].ID,
+				"output_id", diff.delete[idx].ID,
 			)
+			errs = append(errs, newRoutingError(kindOutput, opDelete, bucketSpec.Name, diff.delete[idx].Name, err))
 		}
 	}
 
-	return nil
+	return statuses, changes, errs
 }
 
 type outputsDiff struct {
 	create []*webhookrelay.Output
 	update []*webhookrelay.Output
 	delete []*webhookrelay.Output
+	// fields that don't match the spec, indexed by output name
+	fields map[string][]string
 }
 
-func getOutputsDiff(current, desired []*webhookrelay.Output) *outputsDiff {
-	diff := &outputsDiff{}
+// getOutputsDiff compares current and desired outputs. Outputs that are not in the
+// desired list are only deleted if they were created by the same CR, hand-made
+// outputs are left untouched
+func getOutputsDiff(current, desired []*webhookrelay.Output, crOwner owner) *outputsDiff {
+	diff := &outputsDiff{fields: make(map[string][]string)}
 
 	currentMap := make(map[string]*webhookrelay.Output)
 
@@ -106,7 +151,8 @@ func getOutputsDiff(current, desired []*webhookrelay.Output) *outputsDiff {
 			diff.create = append(diff.create, desired[i])
 			continue
 		}
-		if outputsEqual(currentOutput, desired[i]) {
+		fields := diffOutput(currentOutput, desired[i])
+		if len(fields) == 0 {
 			// Nothing to do
 
 			// Deleting entry from the map, what's left in the map
@@ -117,6 +163,7 @@ func getOutputsDiff(current, desired []*webhookrelay.Output) *outputsDiff {
 		}
 		// Setting ID and adding to the update list
 		desired[i].ID = currentOutput.ID
+		diff.fields[desired[i].Name] = fields
 		diff.update = append(diff.update, desired[i])
 
 		// Deleting entry from the map, what's left in the map
@@ -126,16 +173,21 @@ func getOutputsDiff(current, desired []*webhookrelay.Output) *outputsDiff {
 	}
 	// Collecting leftovers for deletion
 	for _, v := range currentMap {
+		if !ownedBy(v.Description, crOwner) {
+			continue
+		}
 		diff.delete = append(diff.delete, v)
 	}
 	return diff
 }
 
-func desiredOutputs(bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket) []*webhookrelay.Output {
+func desiredOutputs(bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucket, crOwner owner) []*webhookrelay.Output {
 	var desired []*webhookrelay.Output
 
 	for i := range bucketSpec.Outputs {
-		desired = append(desired, inputSpecToOutput(&bucketSpec.Outputs[i], bucket))
+		output := inputSpecToOutput(&bucketSpec.Outputs[i], bucket)
+		output.Description = withOwnershipMarker(output.Description, crOwner)
+		desired = append(desired, output)
 	}
 
 	return desired
@@ -144,13 +196,6 @@ func desiredOutputs(bucketSpec *forwardv1.BucketSpec, bucket *webhookrelay.Bucke
 func inputSpecToOutput(spec *forwardv1.OutputSpec, bucket *webhookrelay.Bucket) *webhookrelay.Output {
 	header := make(map[string][]string)
 
-	internal := true
-
-	if spec.Internal != nil {
-		// set, checking val
-		internal = *spec.Internal
-	}
-
 	if spec.OverrideHeaders != nil {
 		for k, v := range spec.OverrideHeaders {
 			header[k] = []string{v}
@@ -164,41 +209,7 @@ func inputSpecToOutput(spec *forwardv1.OutputSpec, bucket *webhookrelay.Bucket)
 		Headers:     header,
 		Destination: spec.Destination,
 		Timeout:     spec.Timeout,
-		Internal:    internal,
+		Internal:    spec.OutputInternal(),
 		Description: spec.Description,
 	}
 }
-
-func outputsEqual(current, desired *webhookrelay.Output) bool {
-	if current.Name != desired.Name {
-		return false
-	}
-	if current.FunctionID != desired.FunctionID {
-		return false
-	}
-	if current.Destination != desired.Destination {
-		return false
-	}
-
-	if len(current.Headers) != len(desired.Headers) {
-		for k := range current.Headers {
-			if !sliceEqual(current.Headers[k], desired.Headers[k]) {
-				return false
-			}
-		}
-	}
-
-	if current.Internal != desired.Internal {
-		return false
-	}
-
-	if current.Timeout != desired.Timeout {
-		return false
-	}
-
-	if current.Description != desired.Description {
-		return false
-	}
-
-	return true
-}
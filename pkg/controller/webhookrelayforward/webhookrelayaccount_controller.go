@@ -0,0 +1,233 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+const (
+	// accountRefIndexKey indexes WebhookRelayForward CRs by the account they use
+	accountRefIndexKey = "spec.accountRef.name"
+	// accountSecretIndexKey indexes accounts by their secret
+	accountSecretIndexKey = "spec.secretRef"
+)
+
+// addAccountController adds WebhookRelayAccount controller to mgr
+func addAccountController(mgr manager.Manager, r *ReconcileWebhookRelayAccount) error {
+	c, err := controller.New("webhookrelayaccount-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: r.config.MaxConcurrentReconciles,
+		RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(r.config.BackoffBase, r.config.BackoffMax),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayAccount{}}, &handler.EnqueueRequestForObject{}, specChangedPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Checking the token again once the secret changes
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &forwardv1.WebhookRelayAccount{}, accountSecretIndexKey, indexAccountSecret)
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			accounts, err := accountsForSecret(r.client, obj.Meta)
+			if err != nil {
+				log.Error(err, "failed to list accounts referencing the secret", "secret", obj.Meta.GetName())
+				return nil
+			}
+			var requests []reconcile.Request
+			for i := range accounts {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: accounts[i].GetName()}})
+			}
+			return requests
+		}),
+	})
+}
+
+// blank assignment to verify that ReconcileWebhookRelayAccount implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileWebhookRelayAccount{}
+
+// ReconcileWebhookRelayAccount checks WebhookRelayAccount credentials and reports the account usage
+type ReconcileWebhookRelayAccount struct {
+	client   client.Client
+	recorder record.EventRecorder
+	// apiReader reads account secrets, they can be in any namespace
+	// so they are not necessarily cached
+	apiReader client.Reader
+	// clients are shared with the other controllers so the buckets
+	// listed during the check are reused
+	clients *clientPool
+	config  *config.Config
+}
+
+// Reconcile checks the account token, accounts are checked again every resync period
+func (r *ReconcileWebhookRelayAccount) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	logger := log.WithValues("Request.Name", request.Name, "Kind", "WebhookRelayAccount")
+
+	reconcileResult := reconcile.Result{RequeueAfter: r.config.ResyncPeriod}
+
+	instance := &forwardv1.WebhookRelayAccount{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcileResult, err
+	}
+
+	status := instance.Status.DeepCopy()
+	r.checkAccount(logger, instance, status)
+
+	if status.TokenStatus != instance.Status.TokenStatus && status.TokenStatus == forwardv1.TokenStatusInvalid {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "InvalidToken", status.Message)
+	}
+
+	if err := r.updateStatus(logger, instance, status); err != nil {
+		logger.Error(err, "Failed to update account status")
+		return reconcileResult, err
+	}
+
+	return reconcileResult, nil
+}
+
+// checkAccount lists buckets with the account credentials to check the token and count
+// buckets, inputs and outputs
+func (r *ReconcileWebhookRelayAccount) checkAccount(logger logr.Logger, instance *forwardv1.WebhookRelayAccount, status *forwardv1.WebhookRelayAccountStatus) {
+	now := metav1.Now()
+	status.ObservedGeneration = instance.GetGeneration()
+
+	apiClient, err := clientForSecret(r.apiReader, r.clients, r.config, accountSecretRef(instance))
+	if err != nil {
+		status.LastCheckedTime = &now
+		status.TokenStatus = forwardv1.TokenStatusInvalid
+		status.Message = err.Error()
+		return
+	}
+
+	if setRateLimitedUntil(apiClient, status, now) {
+		// token can't be checked until the API accepts requests again
+		return
+	}
+	status.LastCheckedTime = &now
+
+	buckets, err := apiClient.client.ListBuckets(&webhookrelay.BucketListOptions{})
+	if err != nil {
+		logger.Info("account check failed", "error", err.Error())
+		if setRateLimitedUntil(apiClient, status, now) {
+			return
+		}
+		status.TokenStatus = forwardv1.TokenStatusUnknown
+		if isInvalidCredentialsError(err) {
+			status.TokenStatus = forwardv1.TokenStatusInvalid
+		}
+		status.Message = fmt.Sprintf("failed to list buckets, error: %s", err)
+		return
+	}
+	apiClient.bucketsCache.Set(buckets)
+
+	status.TokenStatus = forwardv1.TokenStatusValid
+	status.Message = ""
+	status.Usage = accountUsage(buckets)
+}
+
+// setRateLimitedUntil records until when Webhook Relay API is rejecting requests,
+// returns true if the account is rate limited
+func setRateLimitedUntil(apiClient *WebhookRelayClient, status *forwardv1.WebhookRelayAccountStatus, now metav1.Time) bool {
+	wait := apiClient.retryAfter()
+	if wait <= 0 {
+		status.RateLimitedUntil = nil
+		return false
+	}
+	until := metav1.NewTime(now.Add(wait).Truncate(time.Second))
+	status.RateLimitedUntil = &until
+	return true
+}
+
+// updateStatus patches account status if it has changed
+func (r *ReconcileWebhookRelayAccount) updateStatus(logger logr.Logger, instance *forwardv1.WebhookRelayAccount, status *forwardv1.WebhookRelayAccountStatus) error {
+	if apiequality.Semantic.DeepEqual(&instance.Status, status) {
+		return nil
+	}
+
+	patch := instance.DeepCopy()
+	patch.Status = *status
+
+	logger.Info("Updating status", "tokenStatus", status.TokenStatus)
+
+	return r.client.Status().Patch(context.TODO(), patch, client.MergeFrom(instance))
+}
+
+func accountUsage(buckets []*webhookrelay.Bucket) *forwardv1.AccountUsage {
+	usage := &forwardv1.AccountUsage{Buckets: len(buckets)}
+	for _, bucket := range buckets {
+		usage.Inputs += len(bucket.Inputs)
+		usage.Outputs += len(bucket.Outputs)
+	}
+	return usage
+}
+
+func accountSecretRef(instance *forwardv1.WebhookRelayAccount) *types.NamespacedName {
+	return &types.NamespacedName{
+		Namespace: instance.Spec.SecretRef.Namespace,
+		Name:      instance.Spec.SecretRef.Name,
+	}
+}
+
+// getAccount returns the account if CRs from the namespace are allowed to use it
+func getAccount(c client.Client, name, namespace string) (*forwardv1.WebhookRelayAccount, error) {
+	account := &forwardv1.WebhookRelayAccount{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name}, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WebhookRelayAccount '%s': %w", name, err)
+	}
+	if !account.AllowsNamespace(namespace) {
+		return nil, fmt.Errorf("WebhookRelayAccount '%s' can't be used from namespace '%s'", name, namespace)
+	}
+	return account, nil
+}
+
+func indexAccountSecret(obj runtime.Object) []string {
+	instance, ok := obj.(*forwardv1.WebhookRelayAccount)
+	if !ok {
+		return nil
+	}
+	return []string{accountSecretRef(instance).String()}
+}
+
+// accountsForSecret returns accounts that use the secret
+func accountsForSecret(c client.Client, secret metav1.Object) ([]forwardv1.WebhookRelayAccount, error) {
+	ref := types.NamespacedName{Namespace: secret.GetNamespace(), Name: secret.GetName()}.String()
+
+	accounts := &forwardv1.WebhookRelayAccountList{}
+	err := c.List(context.TODO(), accounts, client.MatchingFields{accountSecretIndexKey: ref})
+	if err != nil {
+		return nil, err
+	}
+	return accounts.Items, nil
+}
@@ -0,0 +1,144 @@
+package webhookrelayforward
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func newTestAccount() (*forwardv1.WebhookRelayAccount, *corev1.Secret) {
+	account := &forwardv1.WebhookRelayAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Generation: 1},
+		Spec: forwardv1.WebhookRelayAccountSpec{
+			SecretRef:         forwardv1.SecretReference{Name: "team-a-token", Namespace: "operator"},
+			AllowedNamespaces: []string{"team-a", "team-a-staging"},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-token", Namespace: "operator"},
+		Data: map[string][]byte{
+			forwardv1.AccessTokenKeyName:    []byte("key"),
+			forwardv1.AccessTokenSecretName: []byte("secret"),
+		},
+	}
+	return account, secret
+}
+
+func newTestAccountReconciler(t *testing.T, srv *httptest.Server, objs ...runtime.Object) *ReconcileWebhookRelayAccount {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	clients := newClientPool(time.Hour)
+	clients.clients[credentialsID("key", "secret")] = &pooledClient{client: newTestAPIClient(t, srv), lastUsed: time.Now()}
+
+	c := fake.NewFakeClientWithScheme(s, objs...)
+	return &ReconcileWebhookRelayAccount{
+		client:    c,
+		recorder:  record.NewFakeRecorder(10),
+		apiReader: c,
+		clients:   clients,
+		config:    &config.Config{},
+	}
+}
+
+func TestCheckAccount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `[
+			{"id": "b-1", "name": "one", "inputs": [{"id": "i-1"}], "outputs": [{"id": "o-1"}, {"id": "o-2"}]},
+			{"id": "b-2", "name": "two"}
+		]`)
+	}))
+	defer srv.Close()
+
+	account, secret := newTestAccount()
+	r := newTestAccountReconciler(t, srv, account, secret)
+
+	status := account.Status.DeepCopy()
+	r.checkAccount(log, account, status)
+
+	assert.Equal(t, forwardv1.TokenStatusValid, status.TokenStatus)
+	assert.Equal(t, "", status.Message)
+	assert.Equal(t, int64(1), status.ObservedGeneration)
+	assert.Assert(t, status.LastCheckedTime != nil)
+	assert.DeepEqual(t, &forwardv1.AccountUsage{Buckets: 2, Inputs: 1, Outputs: 2}, status.Usage)
+}
+
+func TestCheckAccount_InvalidToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	account, secret := newTestAccount()
+	r := newTestAccountReconciler(t, srv, account, secret)
+
+	status := account.Status.DeepCopy()
+	r.checkAccount(log, account, status)
+	assert.Equal(t, forwardv1.TokenStatusInvalid, status.TokenStatus)
+	assert.Equal(t, "failed to list buckets, error: error from makeRequest: HTTP status 401: invalid credentials", status.Message)
+
+	// missing secret
+	r = newTestAccountReconciler(t, srv, account)
+	status = account.Status.DeepCopy()
+	r.checkAccount(log, account, status)
+	assert.Equal(t, forwardv1.TokenStatusInvalid, status.TokenStatus)
+	assert.Equal(t, "failed to get access token secret 'operator/team-a-token': secrets \"team-a-token\" not found", status.Message)
+}
+
+func TestGetAccount(t *testing.T) {
+	account, _ := newTestAccount()
+	s := runtime.NewScheme()
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+	c := fake.NewFakeClientWithScheme(s, account)
+
+	got, err := getAccount(c, "team-a", "team-a-staging")
+	assert.NilError(t, err)
+	assert.Equal(t, "team-a", got.GetName())
+
+	_, err = getAccount(c, "team-a", "team-b")
+	assert.Error(t, err, "WebhookRelayAccount 'team-a' can't be used from namespace 'team-b'")
+
+	_, err = getAccount(c, "missing", "team-a")
+	assert.ErrorContains(t, err, "failed to get WebhookRelayAccount 'missing'")
+
+	// empty allow-list denies all namespaces
+	account.Spec.AllowedNamespaces = nil
+	assert.Assert(t, !account.AllowsNamespace("team-a"))
+
+	account.Spec.AllowedNamespaces = []string{forwardv1.AllAccountNamespaces}
+	assert.Assert(t, account.AllowsNamespace("team-b"))
+}
+
+func TestCheckAccount_RateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	account, secret := newTestAccount()
+	account.Status.TokenStatus = forwardv1.TokenStatusValid
+	r := newTestAccountReconciler(t, srv, account, secret)
+
+	status := account.Status.DeepCopy()
+	r.checkAccount(log, account, status)
+
+	// token status is kept as it couldn't be checked
+	assert.Equal(t, forwardv1.TokenStatusValid, status.TokenStatus)
+	assert.Assert(t, status.RateLimitedUntil != nil)
+	assert.Assert(t, status.RateLimitedUntil.After(time.Now()))
+}
@@ -0,0 +1,345 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// bucketSecretRefsIndexKey indexes bucket CRs by the secrets they reference
+const bucketSecretRefsIndexKey = "spec.bucketSecretRefs"
+
+// addBucketController adds WebhookRelayBucket controller to mgr
+func addBucketController(mgr manager.Manager, r *ReconcileWebhookRelayBucket) error {
+	c, err := controller.New("webhookrelaybucket-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: r.config.MaxConcurrentReconciles,
+		RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(r.config.BackoffBase, r.config.BackoffMax),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayBucket{}}, &handler.EnqueueRequestForObject{}, specChangedPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Reconciling bucket CRs when the access token or bucket
+	// authentication secrets change
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &forwardv1.WebhookRelayBucket{}, bucketSecretRefsIndexKey, indexBucketSecretRefs)
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestsForSecret),
+	})
+}
+
+// blank assignment to verify that ReconcileWebhookRelayBucket implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileWebhookRelayBucket{}
+
+// ReconcileWebhookRelayBucket reconciles a WebhookRelayBucket object
+type ReconcileWebhookRelayBucket struct {
+	routingObjectReconciler
+}
+
+// Reconcile creates or updates the bucket so it matches the WebhookRelayBucket spec
+func (r *ReconcileWebhookRelayBucket) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name, "Kind", kindBucketCR)
+
+	reconcileResult := reconcile.Result{RequeueAfter: r.config.ResyncPeriod}
+
+	instance := &forwardv1.WebhookRelayBucket{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcileResult, err
+	}
+
+	if instance.GetDeletionTimestamp() != nil {
+		if err := r.reconcileDelete(logger, instance); err != nil {
+			logger.Error(err, "Failed to finalize CR")
+			return reconcileResult, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	updated, err := r.ensureObjectFinalizer(logger, instance, instance.Spec.DeletionPolicy)
+	if err != nil {
+		logger.Error(err, "Failed to update finalizer")
+		return reconcileResult, err
+	}
+	if updated {
+		return reconcile.Result{RequeueAfter: time.Second}, nil
+	}
+
+	status := instance.Status.DeepCopy()
+	syncErr := r.syncBucket(logger, instance, status)
+	if syncErr != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedSync", syncErr.Error())
+	}
+
+	if err := r.updateStatus(logger, instance, status); err != nil {
+		logger.Error(err, "Failed to update CR status")
+		return reconcileResult, err
+	}
+
+	return reconcileResult, syncErr
+}
+
+// syncBucket creates or updates the bucket and records its state in the status
+func (r *ReconcileWebhookRelayBucket) syncBucket(logger logr.Logger, instance *forwardv1.WebhookRelayBucket, status *forwardv1.WebhookRelayBucketStatus) error {
+	generation := instance.GetGeneration()
+
+	apiClient, err := r.clientForBucket(instance)
+	if err != nil {
+		setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateFailed, err.Error())
+		return err
+	}
+
+	crOwner := ownerForObject(kindBucketCR, instance)
+	desired := bucketSpecForCR(instance, crOwner)
+
+	// bucket is not touched if authentication credentials can't be
+	// loaded so we don't end up with an unprotected bucket
+	auth, err := bucketAuthFromSecret(r.client, instance.GetNamespace(), desired)
+	if err != nil {
+		setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateFailed, err.Error())
+		return err
+	}
+
+	buckets, err := apiClient.listBuckets()
+	if err != nil {
+		err = fmt.Errorf("failed to list buckets, error: %w", err)
+		setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateFailed, err.Error())
+		return err
+	}
+
+	existing, ok := getBucketByName(desired.Name, buckets)
+	if !ok {
+		logger.Info("creating bucket", "bucket_name", desired.Name)
+		created, err := createBucket(apiClient, desired, auth)
+		if created != nil {
+			apiClient.bucketsCache.Add(created)
+			status.ID = created.ID
+		}
+		if err != nil {
+			setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateFailed, err.Error())
+			return err
+		}
+		setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateSynced, "")
+		return nil
+	}
+	status.ID = existing.ID
+
+	decision, reason := checkBucketOwnership(r.client, crOwner, desired.AdoptionPolicy, existing)
+	switch decision {
+	case ownershipManage:
+	case ownershipSkip:
+		// bucket can still be used by the inputs and outputs
+		logger.Info("not managing bucket", "bucket_name", desired.Name, "reason", reason)
+		setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateUnmanaged, reason)
+		return nil
+	default:
+		// bucket belongs to another CR or adoption is refused, retrying
+		// won't help until that changes
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedAdoption", reason)
+		setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateFailed, reason)
+		return nil
+	}
+	desired.Description = withOwnershipMarker(desired.Description, managingOwner(crOwner, existing.Description))
+
+	fields := diffBucket(desired, auth, existing)
+	if len(fields) > 0 {
+		updated, err := apiClient.client.UpdateBucket(patchBucketFromSpec(existing, desired, auth))
+		if err != nil {
+			setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateFailed, err.Error())
+			return err
+		}
+		apiClient.bucketsCache.Add(updated)
+		logger.Info("bucket updated to match the spec",
+			"bucket_name", desired.Name,
+			"fields", fields,
+		)
+		r.recordObjectDrift(instance, &status.RoutingObjectStatus, driftChange{kind: kindBucket, bucket: desired.Name, fields: fields})
+	}
+
+	setObjectState(&status.RoutingObjectStatus, generation, forwardv1.SyncStateSynced, "")
+	return nil
+}
+
+// reconcileDelete removes the bucket with "Delete" deletion policy if it was created by
+// this CR and doesn't have any inputs or outputs left. Input and output CRs that reference
+// the bucket are cleaned up first, the bucket is kept only because of inputs and outputs
+// that are not managed by the operator.
+func (r *ReconcileWebhookRelayBucket) reconcileDelete(logger logr.Logger, instance *forwardv1.WebhookRelayBucket) error {
+	if !hasObjectFinalizer(instance) {
+		return nil
+	}
+
+	refs, err := r.bucketRefs(instance)
+	if err != nil {
+		return fmt.Errorf("failed to list CRs referencing the bucket: %w", err)
+	}
+	if len(refs) > 0 {
+		// input and output CRs need the bucket CR for their own cleanup
+		return fmt.Errorf("waiting for %s to be deleted", strings.Join(refs, ", "))
+	}
+
+	apiClient, err := r.clientForBucket(instance)
+	if err != nil {
+		if !isCredentialsNotFound(err) {
+			return fmt.Errorf("failed to configure Webhook Relay API client for cleanup: %w", err)
+		}
+		// credentials are gone, retrying won't help
+		r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupSkipped",
+			fmt.Sprintf("Bucket was not cleaned up: %s", err))
+		return r.removeObjectFinalizer(logger, instance)
+	}
+
+	buckets, err := apiClient.client.ListBuckets(&webhookrelay.BucketListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list buckets, error: %w", err)
+	}
+
+	bucket, ok := getBucketByName(instance.BucketName(), buckets)
+	switch {
+	case !ok:
+		// nothing to clean up
+	case !ownedBy(bucket.Description, ownerForObject(kindBucketCR, instance)):
+		logger.Info("bucket is not managed by this CR, not deleting it")
+	case adopted(bucket.Description):
+		logger.Info("bucket existed before the CR adopted it, not deleting it")
+	case len(bucket.Inputs) > 0 || len(bucket.Outputs) > 0:
+		r.recorder.Event(instance, corev1.EventTypeWarning, "CleanupSkipped",
+			fmt.Sprintf("Bucket '%s' still has inputs or outputs that are not managed by the operator, not deleting it", bucket.Name))
+	default:
+		logger.Info("deleting bucket", "bucket_name", bucket.Name, "bucket_id", bucket.ID)
+		err = apiClient.client.DeleteBucket(&webhookrelay.BucketDeleteOptions{Ref: bucket.ID})
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket '%s': %w", bucket.Name, err)
+		}
+		apiClient.bucketsCache.Delete(bucket.Name)
+	}
+
+	return r.removeObjectFinalizer(logger, instance)
+}
+
+// bucketRefs returns input and output CRs that still reference the bucket CR
+func (r *ReconcileWebhookRelayBucket) bucketRefs(instance *forwardv1.WebhookRelayBucket) ([]string, error) {
+	opts := []client.ListOption{
+		client.InNamespace(instance.GetNamespace()),
+		client.MatchingFields{bucketRefIndexKey: instance.GetName()},
+	}
+
+	var refs []string
+	inputs := &forwardv1.WebhookRelayInputList{}
+	if err := r.client.List(context.TODO(), inputs, opts...); err != nil {
+		return nil, err
+	}
+	for i := range inputs.Items {
+		if inputs.Items[i].Spec.BucketRef.Name == instance.GetName() {
+			refs = append(refs, fmt.Sprintf("%s '%s'", kindInputCR, inputs.Items[i].GetName()))
+		}
+	}
+
+	outputs := &forwardv1.WebhookRelayOutputList{}
+	if err := r.client.List(context.TODO(), outputs, opts...); err != nil {
+		return nil, err
+	}
+	for i := range outputs.Items {
+		if outputs.Items[i].Spec.BucketRef.Name == instance.GetName() {
+			refs = append(refs, fmt.Sprintf("%s '%s'", kindOutputCR, outputs.Items[i].GetName()))
+		}
+	}
+	return refs, nil
+}
+
+// updateStatus patches CR status if it has changed
+func (r *ReconcileWebhookRelayBucket) updateStatus(logger logr.Logger, instance *forwardv1.WebhookRelayBucket, status *forwardv1.WebhookRelayBucketStatus) error {
+	if apiequality.Semantic.DeepEqual(&instance.Status, status) {
+		return nil
+	}
+
+	patch := instance.DeepCopy()
+	patch.Status = *status
+
+	logger.Info("Updating status", "state", status.State)
+
+	return r.client.Status().Patch(context.TODO(), patch, client.MergeFrom(instance))
+}
+
+// bucketSpecForCR builds the bucket spec, description carries the ownership marker
+func bucketSpecForCR(instance *forwardv1.WebhookRelayBucket, crOwner owner) *forwardv1.BucketSpec {
+	description := instance.Spec.Description
+	if description == "" {
+		description = forwardv1.DefaultBucketDescription(instance.GetNamespace(), instance.GetName())
+	}
+	return &forwardv1.BucketSpec{
+		Name:           instance.BucketName(),
+		Description:    withOwnershipMarker(description, crOwner),
+		AdoptionPolicy: instance.Spec.AdoptionPolicy,
+		Auth:           instance.Spec.Auth,
+	}
+}
+
+func indexBucketSecretRefs(obj runtime.Object) []string {
+	instance, ok := obj.(*forwardv1.WebhookRelayBucket)
+	if !ok {
+		return nil
+	}
+
+	var refs []string
+	if instance.Spec.SecretRefName != "" {
+		refs = append(refs, instance.Spec.SecretRefName)
+	}
+	if instance.Spec.Auth != nil && instance.Spec.Auth.SecretRefName != "" {
+		refs = append(refs, instance.Spec.Auth.SecretRefName)
+	}
+	return refs
+}
+
+// requestsForSecret maps a secret to the bucket CRs in its namespace that reference it
+func (r *ReconcileWebhookRelayBucket) requestsForSecret(obj handler.MapObject) []reconcile.Request {
+	instances := &forwardv1.WebhookRelayBucketList{}
+	err := r.client.List(context.TODO(), instances,
+		client.InNamespace(obj.Meta.GetNamespace()),
+		client.MatchingFields{bucketSecretRefsIndexKey: obj.Meta.GetName()},
+	)
+	if err != nil {
+		log.Error(err, "failed to list bucket CRs referencing the secret", "secret", obj.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range instances.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: instances.Items[i].GetNamespace(),
+				Name:      instances.Items[i].GetName(),
+			},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,103 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestBucketReconcileDelete(t *testing.T) {
+	now := metav1.Now()
+	instance := &forwardv1.WebhookRelayBucket{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "shared",
+			Namespace:         "platform",
+			UID:               "1234",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{webhookRelayForwardFinalizer},
+		},
+		Spec: forwardv1.WebhookRelayBucketSpec{DeletionPolicy: forwardv1.RoutingObjectDeletionPolicyDelete},
+	}
+	output := &forwardv1.WebhookRelayOutput{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "platform", UID: "5678"},
+		Spec:       forwardv1.WebhookRelayOutputSpec{BucketRef: corev1.LocalObjectReference{Name: "shared"}},
+	}
+	buckets := []*webhookrelay.Bucket{{
+		ID:          testBucketID,
+		Name:        "shared",
+		Description: withOwnershipMarker("", ownerForObject(kindBucketCR, instance)),
+		Outputs:     []*webhookrelay.Output{{ID: testOutputID, Name: "team-a", Description: withOwnershipMarker("", ownerForObject(kindOutputCR, output))}},
+	}}
+
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Method == http.MethodDelete {
+			deleted = append(deleted, req.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		assert.NilError(t, json.NewEncoder(w).Encode(buckets))
+	}))
+	defer srv.Close()
+
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	cfg := &config.Config{}
+	cfg.Relay.Key = "key"
+	cfg.Relay.Secret = "secret"
+	clients := newClientPool(time.Hour)
+	clients.clients[credentialsID("key", "secret")] = &pooledClient{client: newTestAPIClient(t, srv), lastUsed: time.Now()}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileWebhookRelayBucket{routingObjectReconciler{
+		client:   fake.NewFakeClientWithScheme(s, instance, output),
+		recorder: recorder,
+		clients:  clients,
+		config:   cfg,
+	}}
+
+	// output CR still needs the bucket for its own cleanup
+	assert.Error(t, r.reconcileDelete(log, instance), "waiting for WebhookRelayOutput 'team-a' to be deleted")
+	assert.Equal(t, 0, len(deleted))
+
+	// output was removed by its CR, only an output created outside of the operator is left
+	assert.NilError(t, r.client.Delete(context.TODO(), output))
+	buckets[0].Outputs = []*webhookrelay.Output{{ID: testOutputID, Name: "manual"}}
+
+	assert.NilError(t, r.reconcileDelete(log, instance))
+	assert.Equal(t, 0, len(deleted))
+	assert.Equal(t, "Warning CleanupSkipped Bucket 'shared' still has inputs or outputs that are not managed by the operator, not deleting it", <-recorder.Events)
+
+	updated := &forwardv1.WebhookRelayBucket{}
+	assert.NilError(t, r.client.Get(context.TODO(), types.NamespacedName{Namespace: "platform", Name: "shared"}, updated))
+	assert.Assert(t, !hasObjectFinalizer(updated))
+
+	// bucket without inputs or outputs is deleted
+	buckets[0].Outputs = nil
+	assert.NilError(t, r.reconcileDelete(log, instance))
+	assert.DeepEqual(t, []string{"/buckets/" + testBucketID}, deleted)
+}
@@ -3,13 +3,20 @@ package webhookrelayforward
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/webhookrelay/webhookrelay-go"
 
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
 )
 
 // Errors
@@ -17,75 +24,142 @@ var (
 	ErrCredentialsNotProvided = errors.New("access token key and secret not provided")
 )
 
-// WebhookRelayClient is a wrapper for the Webhook Relay API client
+// WebhookRelayClient is a wrapper for the Webhook Relay API client, shared
+// between all CRs that use the same credentials
 type WebhookRelayClient struct {
 	// client is Webhook Relay API client.
-	client             *webhookrelay.API
-	instanceName       string
-	instanceGeneration int64
-	// instanceUID is the UID of the NodeForwarder the client belongs to.
-	instanceUID types.UID
+	client *webhookrelay.API
 
 	// Preserving access token as we will need them for the
 	// webhookrelayd deployments.
-	// TODO: provision new access token key & secret pair with limited
-	// API access
 	accessTokenKey    string
 	accessTokenSecret string
 
 	bucketsCache *bucketsCache
+	// refreshInterval - how long cached buckets are used before
+	// listing them again
+	refreshInterval time.Duration
+
+	// rateLimit records when Webhook Relay API asked us to
+	// slow down
+	rateLimit *rateLimitTransport
+}
+
+// apiRequestTimeout limits a single Webhook Relay API request
+const apiRequestTimeout = 30 * time.Second
+
+// retryAfter returns how long to wait before Webhook Relay API can be
+// called again, zero if the API isn't rate limiting us
+func (c *WebhookRelayClient) retryAfter() time.Duration {
+	if c.rateLimit == nil {
+		return 0
+	}
+	return c.rateLimit.retryAfter()
+}
+
+// listBuckets returns cached buckets if they were listed recently, otherwise
+// lists them through the API and updates the cache
+func (c *WebhookRelayClient) listBuckets() ([]*webhookrelay.Bucket, error) {
+	if !c.bucketsCache.Stale(c.refreshInterval) {
+		return c.bucketsCache.List(), nil
+	}
+
+	buckets, err := c.client.ListBuckets(&webhookrelay.BucketListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c.bucketsCache.Set(buckets)
+	// cached buckets are shared between reconciles, callers get copies
+	return c.bucketsCache.List(), nil
+}
+
+// newAPIClient creates Webhook Relay API client. Client doesn't retry failed requests itself
+// as that would block the reconcile loop, failed reconciles are retried with a backoff instead.
+func newAPIClient(key, secret string) (*webhookrelay.API, *rateLimitTransport, error) {
+	transport := newRateLimitTransport(http.DefaultTransport)
+	apiClient, err := webhookrelay.New(key, secret,
+		webhookrelay.WithHTTPClient(&http.Client{
+			Transport: transport,
+			Timeout:   apiRequestTimeout,
+		}),
+		webhookrelay.WithRetryPolicy(0, 1, 1),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return apiClient, transport, nil
 }
 
-func (r *ReconcileWebhookRelayForward) setClientForCluster(instance *forwardv1.WebhookRelayForward) error {
+// clientForCR returns a shared Webhook Relay API client for the credentials
+// configured on the CR, its account or on the operator
+func (r *ReconcileWebhookRelayForward) clientForCR(instance *forwardv1.WebhookRelayForward) (*WebhookRelayClient, error) {
+	if instance.Spec.AccountRef != nil {
+		account, err := getAccount(r.client, instance.Spec.AccountRef.Name, instance.GetNamespace())
+		if err != nil {
+			return nil, err
+		}
+		// account secrets can be in any namespace
+		return clientForSecret(r.apiReader, r.clients, r.config, accountSecretRef(account))
+	}
+
+	var (
+		secretRef *types.NamespacedName
+		reader    client.Reader = r.client
+	)
+	if instance.Spec.SecretRefName != "" {
+		secretRef = &types.NamespacedName{
+			Namespace: credentialsSecretNamespace(instance),
+			Name:      instance.Spec.SecretRefName,
+		}
+		if secretRef.Namespace != instance.GetNamespace() {
+			// cache only holds the watched namespaces, secret from another
+			// namespace is read directly from the API server
+			reader = r.apiReader
+		}
+	}
+	return clientForSecret(reader, r.clients, r.config, secretRef)
+}
+
+// clientForSecret returns a shared Webhook Relay API client for the credentials from
+// the secret, operator credentials are used if the secret is not set
+func clientForSecret(c client.Reader, clients *clientPool, cfg *config.Config, secretRef *types.NamespacedName) (*WebhookRelayClient, error) {
 	// credentials to use
 	var (
 		relayKey    string
 		relaySecret string
 	)
 
-	if instance.Spec.SecretRefName != "" {
-		namespace := instance.Spec.SecretRefNamespace
-		if namespace == "" {
-			// defaulting to CR namespace
-			namespace = instance.GetNamespace()
-		}
-
+	if secretRef != nil {
 		// Obtain the Webhook Relay API access token key and secret to be used in the client.
-		secretNamespacedName := types.NamespacedName{
-			Namespace: namespace,
-			Name:      instance.Spec.SecretRefName,
-		}
 		secretInstance := &corev1.Secret{}
-		err := r.client.Get(context.TODO(), secretNamespacedName, secretInstance)
+		err := c.Get(context.TODO(), *secretRef, secretInstance)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to get access token secret '%s': %w", secretRef, err)
 		}
 
 		relayKey = string(secretInstance.Data[forwardv1.AccessTokenKeyName])
 		relaySecret = string(secretInstance.Data[forwardv1.AccessTokenSecretName])
-	} else if r.config.Relay.Key != "" && r.config.Relay.Secret != "" {
+		if relayKey == "" || relaySecret == "" {
+			return nil, fmt.Errorf("access token secret '%s' should have '%s' and '%s' fields",
+				secretRef, forwardv1.AccessTokenKeyName, forwardv1.AccessTokenSecretName)
+		}
+	} else if cfg.Relay.Key != "" && cfg.Relay.Secret != "" {
 		// using operator config
-		relayKey = r.config.Relay.Key
-		relaySecret = r.config.Relay.Secret
+		relayKey = cfg.Relay.Key
+		relaySecret = cfg.Relay.Secret
 	} else {
-		return ErrCredentialsNotProvided
+		return nil, ErrCredentialsNotProvided
 	}
 
-	apiClient, err := webhookrelay.New(relayKey, relaySecret)
-	if err != nil {
-		return err
-	}
+	return clients.get(relayKey, relaySecret)
+}
 
-	r.apiClient = &WebhookRelayClient{
-		client:             apiClient,
-		instanceName:       instance.GetName(),
-		instanceGeneration: instance.GetGeneration(),
-		instanceUID:        instance.GetUID(),
-		// setting credentials that can be reused for deployments
-		accessTokenKey:    relayKey,
-		accessTokenSecret: relaySecret,
-		bucketsCache:      newBucketsCache(),
+// isCredentialsNotFound checks whether the API client couldn't be configured because
+// the credentials secret, the account or the operator credentials don't exist
+func isCredentialsNotFound(err error) bool {
+	if errors.Is(err, ErrCredentialsNotProvided) {
+		return true
 	}
-
-	return nil
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Reason == metav1.StatusReasonNotFound
 }
@@ -3,18 +3,20 @@ package webhookrelayforward
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -29,8 +31,6 @@ import (
 var log = logf.Log.WithName("controller_webhookrelayforward")
 
 const (
-	reconcilePeriodSeconds = 5
-
 	// containerTokenKeyEnvName and containerTokenSecretEnvName used
 	// to specify authentication details for the container
 	containerTokenKeyEnvName    = "KEY"
@@ -46,36 +46,127 @@ const (
  */
 
 // Add creates a new WebhookRelayForward Controller and adds it to the Manager. The Manager will set fields on the Controller
-// and Start it when the Manager is Started.
+// and Start it when the Manager is Started. WebhookRelayAccount, WebhookRelayBucket, WebhookRelayInput and
+// WebhookRelayOutput controllers are added together with it as they share the Webhook Relay API clients.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	r := newReconciler(mgr)
+	if err := add(mgr, r); err != nil {
+		return err
+	}
+
+	base := routingObjectReconciler{
+		client:   mgr.GetClient(),
+		recorder: mgr.GetEventRecorderFor("webhookrelay-forwarder"),
+		clients:  r.clients,
+		config:   r.config,
+	}
+	err := addAccountController(mgr, &ReconcileWebhookRelayAccount{
+		client:    base.client,
+		recorder:  base.recorder,
+		apiReader: r.apiReader,
+		clients:   base.clients,
+		config:    base.config,
+	})
+	if err != nil {
+		return err
+	}
+	if err := addBucketController(mgr, &ReconcileWebhookRelayBucket{routingObjectReconciler: base}); err != nil {
+		return err
+	}
+	if err := addInputController(mgr, &ReconcileWebhookRelayInput{routingObjectReconciler: base}); err != nil {
+		return err
+	}
+	return addOutputController(mgr, &ReconcileWebhookRelayOutput{routingObjectReconciler: base})
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+func newReconciler(mgr manager.Manager) *ReconcileWebhookRelayForward {
 	cfg := config.MustLoad()
 	return &ReconcileWebhookRelayForward{
-		client:   mgr.GetClient(),
-		scheme:   mgr.GetScheme(),
-		recorder: mgr.GetEventRecorderFor("webhookrelay-forwarder"),
-		config:   &cfg,
+		client:    mgr.GetClient(),
+		scheme:    mgr.GetScheme(),
+		recorder:  mgr.GetEventRecorderFor("webhookrelay-forwarder"),
+		apiReader: mgr.GetAPIReader(),
+		clients:   newClientPool(cfg.BucketsRefreshInterval),
+		config:    &cfg,
 	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
-	// Create a new controller
-	c, err := controller.New("webhookrelayforward-controller", mgr, controller.Options{Reconciler: r})
+func add(mgr manager.Manager, r *ReconcileWebhookRelayForward) error {
+	// Create a new controller. Failed reconciles are retried with per CR
+	// exponential backoff
+	c, err := controller.New("webhookrelayforward-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: r.config.MaxConcurrentReconciles,
+		RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(r.config.BackoffBase, r.config.BackoffMax),
+	})
 	if err != nil {
 		return err
 	}
 
-	// Watch for changes to primary resource WebhookRelayForward
-	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayForward{}}, &handler.EnqueueRequestForObject{})
+	// Watch for changes to primary resource WebhookRelayForward, status updates
+	// are ignored
+	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayForward{}}, &handler.EnqueueRequestForObject{}, specChangedPredicate)
 	if err != nil {
 		return err
 	}
 
+	// Indexing CRs by referenced secrets and reconciling them when
+	// the secrets change, i.e. credentials are rotated
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &forwardv1.WebhookRelayForward{}, secretRefsIndexKey, indexSecretRefs)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestsForSecret),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reconciling CRs when their account changes, i.e. namespace is
+	// removed from the allow-list
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &forwardv1.WebhookRelayForward{}, accountRefIndexKey, indexAccountRef)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayAccount{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.requestsForAccount),
+	}, specChangedPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to mirrored credentials secrets
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &forwardv1.WebhookRelayForward{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to agent services
+	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &forwardv1.WebhookRelayForward{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to agent autoscalers and disruption budgets
+	for _, obj := range []runtime.Object{&autoscalingv2beta2.HorizontalPodAutoscaler{}, &policyv1beta1.PodDisruptionBudget{}} {
+		err = c.Watch(&source.Kind{Type: obj}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &forwardv1.WebhookRelayForward{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// Watch for changes to secondary resource Deployments and requeue the owner WebhookRelayForward
 	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
@@ -98,9 +189,19 @@ type ReconcileWebhookRelayForward struct {
 	client   client.Client
 	scheme   *runtime.Scheme
 	recorder record.EventRecorder
-
-	apiClient *WebhookRelayClient
-	config    *config.Config
+	// apiReader reads objects directly from the API server, used for objects
+	// that are not cached (agent pods, secrets from other namespaces and
+	// account secrets)
+	apiReader client.Reader
+
+	// clients are Webhook Relay API clients, shared between CRs
+	// with the same credentials
+	clients *clientPool
+	config  *config.Config
+
+	// topologySpreadUnsupported is set once the API server drops topology
+	// spread constraints from the agent deployment, accessed atomically
+	topologySpreadUnsupported int32
 }
 
 // Reconcile reads that state of the cluster for a WebhookRelayForward object and makes changes based on the state read
@@ -113,8 +214,7 @@ type ReconcileWebhookRelayForward struct {
 func (r *ReconcileWebhookRelayForward) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
 
-	reconcilePeriod := reconcilePeriodSeconds * time.Second
-	reconcileResult := reconcile.Result{RequeueAfter: reconcilePeriod}
+	reconcileResult := reconcile.Result{RequeueAfter: r.config.ResyncPeriod}
 	reconcileImmediately := reconcile.Result{RequeueAfter: time.Second}
 
 	// Fetch the WebhookRelayForward instance
@@ -131,206 +231,253 @@ func (r *ReconcileWebhookRelayForward) Reconcile(request reconcile.Request) (rec
 		return reconcileResult, err
 	}
 
-	// Compare the instance names, generations and UIDs to check if it's
-	// the same instance. Update the client if client instance name,
-	// generation or UID are different from current instance. In theory,
-	// CRs can be used by different Webhook Relay accounts so we shouldn't
-	// reuse the same client
-	if r.apiClient == nil ||
-		r.apiClient.instanceName != instance.GetName() ||
-		r.apiClient.instanceGeneration != instance.GetGeneration() ||
-		r.apiClient.instanceUID != instance.GetUID() {
-		if err := r.setClientForCluster(instance); err != nil {
-			logger.Error(err, "Failed to configure Webhook Relay API client, cannot continue")
+	// CR is being deleted, cleaning up Webhook Relay configuration
+	// based on the deletion policy
+	if instance.GetDeletionTimestamp() != nil {
+		if err := r.reconcileDelete(logger, instance); err != nil {
+			logger.Error(err, "Failed to finalize CR")
 			return reconcileResult, err
 		}
-		logger.Info("API client initialized")
+		return reconcile.Result{}, nil
 	}
 
-	if err := r.ensureRoutingConfiguration(logger, instance); err != nil {
-		logger.Error(err, "encountered errors while ensuring routing configuration, check your CR spec")
-		// If configuration fails, we still need to ensure deployment is running, however
-		// we still need to report it
-		requeue, updateErr := r.updateRoutingStatus(
-			logger,
-			forwardv1.RoutingStatusFailed,
-			fmt.Sprintf("encountered errors (%s) while ensuring routing configuration, check your CR spec", err),
-			instance,
-		)
-		if updateErr != nil {
-			if !strings.Contains(updateErr.Error(), "Operation cannot be fulfille") {
-				logger.Error(updateErr, "Failed to update CR routing configuration status",
-					"status", forwardv1.AgentStatusCreating,
-				)
-			}
-		}
-		if requeue {
-			logger.Info("routing status updated, requeuing")
-			return reconcileImmediately, updateErr
-		}
-	} else {
-		// Setting status to Configured
-		requeue, updateErr := r.updateRoutingStatus(
-			logger,
-			forwardv1.RoutingStatusConfigured,
-			"",
-			instance,
-		)
-		if updateErr != nil {
+	updated, err := r.ensureFinalizer(logger, instance)
+	if err != nil {
+		logger.Error(err, "Failed to add finalizer")
+		return reconcileResult, err
+	}
+	if updated {
+		return reconcileImmediately, nil
+	}
+
+	// Desired status is computed during the reconcile and then written
+	// in a single patch
+	status := instance.Status.DeepCopy()
+	status.ObservedGeneration = instance.GetGeneration()
+
+	// Clients are shared between CRs that use the same credentials
+	apiClient, err := r.clientForCR(instance)
+	if err != nil {
+		logger.Error(err, "Failed to configure Webhook Relay API client, cannot continue")
+		setCredentialsNotFound(status, instance.GetGeneration(), err)
+		setReadyCondition(status, instance.GetGeneration())
+		if updateErr := r.updateStatus(logger, instance, status); updateErr != nil {
 			logger.Error(updateErr, "Failed to update CR status")
 		}
-		if requeue {
-			logger.Info("routing status updated, requeuing")
-			return reconcileImmediately, updateErr
-		}
+		return reconcileResult, err
 	}
 
-	if err := r.reconcile(logger, instance); err != nil {
-		logger.Info("Reconcile failed", "error", err)
+	if wait := apiClient.retryAfter(); wait > 0 {
+		logger.Info("Webhook Relay API rate limit reached, postponing reconcile", "retry_after", wait.String())
+		return reconcile.Result{RequeueAfter: wait}, nil
 	}
 
-	return reconcileResult, nil
-}
+	// In Plan mode, changes are only reported, neither the routing
+	// configuration nor the agent deployment are updated
+	if planMode(instance) {
+		result := r.planRoutingConfiguration(logger, apiClient, instance)
+		setPlanStatus(status, instance, result)
+		r.recordPlanEvents(instance, status)
+		setReadyCondition(status, instance.GetGeneration())
 
-func (r *ReconcileWebhookRelayForward) updateRoutingStatus(
-	logger logr.Logger,
-	status forwardv1.RoutingStatus,
-	message string,
-	instance *forwardv1.WebhookRelayForward) (bool, error) {
-	// check whether status has changed
-	if instance.Status.RoutingStatus == status && instance.Status.Message == message {
-		return false, nil
+		if err := r.updateStatus(logger, instance, status); err != nil {
+			logger.Error(err, "Failed to update CR status")
+			return reconcileResult, err
+		}
+		return reconcileResult, result.listErr
 	}
 
-	patch := instance.DeepCopy()
+	result := r.ensureRoutingConfiguration(logger, apiClient, instance)
+	routingErr := result.err()
+	if routingErr != nil {
+		// If configuration fails, we still need to ensure deployment is running, however
+		// we still need to report it
+		logger.Error(routingErr, "encountered errors while ensuring routing configuration, check your CR spec")
+		r.recordRoutingEvents(instance, result)
+	}
+	r.recordDriftEvents(instance, result)
+	r.setRoutingStatus(status, instance, result)
 
-	patch.Status.RoutingStatus = status
-	patch.Status.Message = message
+	if err := r.reconcile(logger, apiClient, instance, status); err != nil {
+		logger.Info("Reconcile failed", "error", err)
+	}
 
-	logger.Info("Updating routing status",
-		"phase", status,
-		"message", message,
-	)
+	setReadyCondition(status, instance.GetGeneration())
+
+	if err := r.updateStatus(logger, instance, status); err != nil {
+		logger.Error(err, "Failed to update CR status")
+		return reconcileResult, err
+	}
+
+	if routingErr != nil {
+		if wait := apiClient.retryAfter(); wait > 0 {
+			// API asked us to slow down, retrying only when it
+			// accepts requests again
+			logger.Info("Webhook Relay API rate limit reached", "retry_after", wait.String())
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+		// returning the error so the request is requeued with
+		// an exponential backoff
+		return reconcileResult, routingErr
+	}
 
-	err := r.client.Status().Patch(context.TODO(), patch, client.MergeFrom(instance))
-	return true, err
+	return reconcileResult, nil
 }
 
-func (r *ReconcileWebhookRelayForward) updateDeploymentStatus(logger logr.Logger, status forwardv1.AgentStatus, ready bool, instance *forwardv1.WebhookRelayForward) (bool, error) {
-	if instance.Status.AgentStatus == status && instance.Status.Ready == ready {
-		return false, nil
+// updateStatus writes the desired status to the CR if it has changed
+func (r *ReconcileWebhookRelayForward) updateStatus(logger logr.Logger, instance *forwardv1.WebhookRelayForward, status *forwardv1.WebhookRelayForwardStatus) error {
+	if apiequality.Semantic.DeepEqual(&instance.Status, status) {
+		return nil
 	}
 
 	patch := instance.DeepCopy()
+	patch.Status = *status
 
-	patch.Status.AgentStatus = status
-	patch.Status.Ready = ready
-
-	logger.Info("Updating deployment status",
-		"status", status,
-		"ready", ready,
+	logger.Info("Updating status",
+		"agentStatus", status.AgentStatus,
+		"routingStatus", status.RoutingStatus,
+		"ready", status.IsConditionTrue(forwardv1.ConditionReady),
 	)
 
-	err := r.client.Status().Patch(context.TODO(), patch, client.MergeFrom(instance))
-	return true, err
+	return r.client.Status().Patch(context.TODO(), patch, client.MergeFrom(instance))
 }
 
-func (r *ReconcileWebhookRelayForward) updatePublicEndpoints(logger logr.Logger, instance *forwardv1.WebhookRelayForward) (bool, error) {
+// reconcile ensures that the agent deployment matches the spec and records
+// deployment state in the provided status
+func (r *ReconcileWebhookRelayForward) reconcile(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward, status *forwardv1.WebhookRelayForwardStatus) error {
 
-	patch, update := r.shouldUpdatePublicEndpoints(instance)
-	if !update {
-		return false, nil
+	// Secret from another namespace has to be copied into the CR namespace
+	// before the agent can use it
+	if err := r.ensureCredentialsMirror(logger, apiClient, instance); err != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedCredentialsMirror", err.Error())
+		setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+			forwardv1.ReasonDeploymentFailed, fmt.Sprintf("failed to mirror credentials secret: %s", err))
+		return err
 	}
 
-	logger.Info("Updating public endpoints list",
-		"endpoints", patch.Status.PublicEndpoints,
-	)
-
-	err := r.client.Status().Patch(context.TODO(), patch, client.MergeFrom(instance))
-	return true, err
-}
-
-func (r *ReconcileWebhookRelayForward) reconcile(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+	creds, err := r.ensureAgentCredentials(logger, apiClient, instance)
+	if err != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedAgentToken", err.Error())
+		setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+			forwardv1.ReasonDeploymentFailed, err.Error())
+		return err
+	}
 
-	// Define a new Deployment object
-	deployment := r.newDeploymentForCR(instance)
+	// Service exposes agent health and metrics endpoint
+	if err := r.ensureAgentService(logger, instance); err != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedService", err.Error())
+		setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+			forwardv1.ReasonDeploymentFailed, fmt.Sprintf("failed to configure agent service: %s", err))
+		return err
+	}
 
-	// Set WebhookRelayForward instance as the owner and controller
-	if err := controllerutil.SetControllerReference(instance, deployment, r.scheme); err != nil {
+	// Autoscaler and disruption budget keep enough agents running
+	if err := r.ensureAgentAutoscaler(logger, instance); err != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedAutoscaler", err.Error())
+		setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+			forwardv1.ReasonDeploymentFailed, fmt.Sprintf("failed to configure agent autoscaler: %s", err))
 		return err
 	}
+	if err := r.ensureAgentPodDisruptionBudget(logger, instance); err != nil {
+		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedPodDisruptionBudget", err.Error())
+		setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+			forwardv1.ReasonDeploymentFailed, fmt.Sprintf("failed to configure agent disruption budget: %s", err))
+		return err
+	}
+
+	// Define a new Deployment object
+	deployment := r.newDeploymentForCR(creds, instance)
 
 	// Check if this Deployment already exists
 	found := &appsv1.Deployment{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, found)
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
-		err = r.client.Create(context.TODO(), deployment)
+		err = r.applyDeployment(logger, instance, deployment)
 		if err != nil {
 			r.recorder.Event(instance, corev1.EventTypeWarning, "FailedCreation", err.Error())
-
-			_, updateErr := r.updateDeploymentStatus(logger, forwardv1.AgentStatusCreating, false, instance)
-			if updateErr != nil {
-				if !strings.Contains(updateErr.Error(), "Operation cannot be fulfille") {
-					logger.Error(updateErr, "Failed to update CR status",
-						"status", forwardv1.AgentStatusCreating,
-					)
-				}
-			}
+			setAgentStatus(status, instance.GetGeneration(), forwardv1.AgentStatusCreating, false,
+				forwardv1.ReasonDeploymentFailed, err.Error())
 			return err
 		}
 
-		_, updateErr := r.updateDeploymentStatus(logger, forwardv1.AgentStatusRunning, true, instance)
-		if updateErr != nil {
-			if !strings.Contains(updateErr.Error(), "Operation cannot be fulfille") {
-				logger.Error(updateErr, "Failed to update CR status",
-					"status", forwardv1.AgentStatusRunning,
-				)
-			}
-		}
+		setAgentStatus(status, instance.GetGeneration(), forwardv1.AgentStatusCreating, false,
+			forwardv1.ReasonDeploymentProgressing, "waiting for agent pods")
 
-		// Deployment created successfully - don't requeue
+		// Deployment created successfully - don't requeue, deployment
+		// status updates will trigger reconcile
 		return nil
 	} else if err != nil {
 		return err
 	}
 
-	// compare image, buckets
-	patched, equals := r.checkDeployment(instance, found)
+	// selectors can't be updated, deployment is recreated
+	if selectorChanged(found, deployment) {
+		err = r.replaceDeployment(logger, instance, found)
+		if err != nil {
+			r.recorder.Event(instance, corev1.EventTypeWarning, "FailedUpdate", err.Error())
+			setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+				forwardv1.ReasonDeploymentFailed, err.Error())
+			return err
+		}
+		setAgentStatus(status, instance.GetGeneration(), forwardv1.AgentStatusCreating, false,
+			forwardv1.ReasonDeploymentUpdate, "recreating deployment with a new selector")
+		// deployment deletion triggers another reconcile
+		return nil
+	}
+
+	// compare operator managed fields: image, buckets, pod template
+	desired, equals := r.checkDeployment(creds, instance, found)
 	if equals {
-		// TODO: check replicas 1/1 for Ready status
-		updated, updateErr := r.updateDeploymentStatus(logger, forwardv1.AgentStatusRunning, true, instance)
-		if updateErr != nil {
-			if !strings.Contains(updateErr.Error(), "Operation cannot be fulfille") {
-				logger.Error(updateErr, "Failed to update CR status",
-					"status", forwardv1.AgentStatusRunning,
-				)
-			}
+		// new deployment is running, agents from the replaced one can be removed
+		if err := r.cleanupLegacyAgents(logger, instance, found); err != nil {
+			logger.Error(err, "failed to remove replaced agents")
 		}
-		if updated {
-			return nil
+
+		// agent runs with the current token, rotated one can be revoked
+		if err := r.revokePreviousAgentToken(logger, apiClient, instance, found); err != nil {
+			logger.Error(err, "failed to revoke previous agent token")
 		}
 
-		_, updateErr = r.updatePublicEndpoints(logger, instance)
-		if updateErr != nil {
-			if !strings.Contains(updateErr.Error(), "Operation cannot be fulfill") {
-				logger.Error(updateErr, "Failed to update CR status public endpoint list",
-					"status", forwardv1.AgentStatusRunning,
-				)
-			}
+		state, err := r.agentStateForDeployment(found)
+		if err != nil {
+			return err
 		}
+		r.setAgentState(instance, status, state)
 
 		// Deployment already exists - don't requeue
 		return nil
 	}
 
-	err = r.client.Update(context.TODO(), patched)
+	if deploymentHasInlinedCredentials(found) {
+		logger.Info("Replacing inlined credentials in the Deployment with a secret reference",
+			"Deployment.Name", found.Name, "Secret.Name", creds.secretName)
+		r.recorder.Event(instance, corev1.EventTypeNormal, "CredentialsMigrated",
+			fmt.Sprintf("Deployment credentials are now referenced from secret '%s'", creds.secretName))
+
+		// inlined values were set by older operator versions without server-side apply,
+		// applying a secret reference would leave both the value and the reference in
+		// the env var so the template is replaced once
+		updated := found.DeepCopy()
+		updated.Spec.Template = desired.Spec.Template
+		if desired.Spec.Replicas != nil {
+			updated.Spec.Replicas = desired.Spec.Replicas
+		}
+		err = r.client.Update(context.TODO(), updated)
+	} else {
+		err = r.applyDeployment(logger, instance, desired)
+	}
 	if err != nil {
 		r.recorder.Event(instance, corev1.EventTypeWarning, "FailedUpdate", err.Error())
+		setAgentStatus(status, instance.GetGeneration(), status.AgentStatus, false,
+			forwardv1.ReasonDeploymentFailed, err.Error())
 		return fmt.Errorf("failed to update Deployment: %s", err)
 	}
 
 	logger.Info("Deployment updated")
+	// previous agents keep running until the new ones are available
+	setAgentStatus(status, instance.GetGeneration(), forwardv1.AgentStatusProgressing, found.Status.AvailableReplicas > 0,
+		forwardv1.ReasonDeploymentUpdate, "Deployment updated to match the spec")
 
 	return nil
 }
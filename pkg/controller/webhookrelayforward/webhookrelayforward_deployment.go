@@ -7,44 +7,163 @@ import (
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-// checkDeployment - checks whether deployment is equal, otherwise patches it
-func (r *ReconcileWebhookRelayForward) checkDeployment(cr *forwardv1.WebhookRelayForward, current *appsv1.Deployment) (patched *appsv1.Deployment, equal bool) {
+// Recommended labels set on the agent deployment and pods
+const (
+	nameLabel      = "app.kubernetes.io/name"
+	instanceLabel  = "app.kubernetes.io/instance"
+	componentLabel = "app.kubernetes.io/component"
+	managedByLabel = "app.kubernetes.io/managed-by"
+)
+
+// selectorLabelsForCR returns labels that select agent pods of the CR, they must be
+// unique per CR so agents of different CRs in the same namespace don't select each other
+func selectorLabelsForCR(cr *forwardv1.WebhookRelayForward) map[string]string {
+	return map[string]string{
+		nameLabel:     "webhookrelay-forwarder",
+		instanceLabel: cr.Name,
+	}
+}
+
+// labelsForCR returns recommended labels of the agent deployment and pods
+func labelsForCR(cr *forwardv1.WebhookRelayForward) map[string]string {
+	labels := selectorLabelsForCR(cr)
+	labels[componentLabel] = "agent"
+	labels[managedByLabel] = "webhookrelay-operator"
+	return labels
+}
+
+// Agent health endpoint defaults
+const (
+	agentHealthPortName    = "health"
+	defaultAgentHealthPort = 8080
+	defaultAgentHealthPath = "/health"
+)
+
+// checkDeployment - checks whether the operator managed fields of the deployment match the
+// spec, returns the desired deployment that should be applied otherwise. Fields added by other
+// controllers or admission webhooks (i.e. sidecar containers) are ignored.
+func (r *ReconcileWebhookRelayForward) checkDeployment(creds *agentCredentials, cr *forwardv1.WebhookRelayForward, current *appsv1.Deployment) (desired *appsv1.Deployment, equal bool) {
 	// Assume deployment matches the spec
 	equal = true
-	// Creating a deep copy of the existing deployment
-	patched = current.DeepCopy()
 	// Getting a desired deployment and validating:
-	// 1. Image
-	// 2. Environment configuration (secrets, buckets)
-	// 3. TODO: check resource limits
-	desiredDeployment := r.newDeploymentForCR(cr)
+	// 1. Replicas
+	// 2. Pod labels and annotations (including credentials hash so
+	//    pods are restarted when credentials are rotated)
+	// 3. Pod spec (scheduling, security context, volumes)
+	// 4. Containers (image, resources, environment configuration)
+	desired = r.newDeploymentForCR(creds, cr)
 
-	if len(current.Spec.Template.Spec.Containers) != len(desiredDeployment.Spec.Template.Spec.Containers) {
+	if agentAutoscaling(cr) != nil {
+		// replicas are managed by the autoscaler. Current count is applied as the
+		// operator might own the field since the deployment was created, applying
+		// without it would reset the deployment to a single replica.
+		desired.Spec.Replicas = current.Spec.Replicas
+	} else if current.Spec.Replicas == nil || *current.Spec.Replicas != *desired.Spec.Replicas {
 		equal = false
-		patched.Spec.Template.Spec.Containers = desiredDeployment.Spec.Template.Spec.Containers
 	}
 
-	for i := range desiredDeployment.Spec.Template.Spec.Containers {
+	if !podTemplatesEqual(&current.Spec.Template, &desired.Spec.Template) {
+		equal = false
+	}
 
-		if !containersEqual(&current.Spec.Template.Spec.Containers[i], &desiredDeployment.Spec.Template.Spec.Containers[i]) {
+	// labels and annotations that were set by the operator but are no
+	// longer in the spec
+	template := []string{"f:spec", "f:template", "f:metadata"}
+	for _, label := range managedFields(current, append(template, "f:labels")...) {
+		if _, ok := desired.Spec.Template.Labels[label]; !ok {
+			equal = false
+		}
+	}
+	for _, annotation := range managedFields(current, append(template, "f:annotations")...) {
+		if _, ok := desired.Spec.Template.Annotations[annotation]; !ok {
 			equal = false
 		}
+	}
+
+	return
+}
 
+// podTemplatesEqual compares the fields of the pod template that are set by the operator
+func podTemplatesEqual(current, desired *corev1.PodTemplateSpec) bool {
+	if !specEqual(desired.Labels, current.Labels) ||
+		!specEqual(desired.Annotations, current.Annotations) {
+		return false
 	}
 
-	// patching containers
-	if !equal {
-		patched.Spec.Template.Spec = desiredDeployment.Spec.Template.Spec
+	c, d := &current.Spec, &desired.Spec
+	if c.ServiceAccountName != d.ServiceAccountName ||
+		c.PriorityClassName != d.PriorityClassName ||
+		!specEqual(d.ImagePullSecrets, c.ImagePullSecrets) ||
+		!specEqual(d.NodeSelector, c.NodeSelector) ||
+		!specEqual(d.Tolerations, c.Tolerations) ||
+		!specEqual(d.Affinity, c.Affinity) ||
+		!specEqual(d.SecurityContext, c.SecurityContext) ||
+		!specEqual(d.Volumes, c.Volumes) ||
+		!specEqual(d.TopologySpreadConstraints, c.TopologySpreadConstraints) {
+		return false
 	}
 
-	return
+	// containers injected by admission webhooks are ignored
+	for i := range d.Containers {
+		container := findContainer(c.Containers, d.Containers[i].Name)
+		if container == nil || !containersEqual(container, &d.Containers[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+// specEqual checks whether the current value matches the desired one. Fields that are
+// not set in the desired value but were defaulted by the API server are ignored, while
+// values removed from the desired spec are still detected.
+func specEqual(desired, current interface{}) bool {
+	if isEmpty(desired) {
+		return isEmpty(current)
+	}
+	return apiequality.Semantic.DeepDerivative(desired, current)
+}
+
+func isEmpty(val interface{}) bool {
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Ptr:
+		return v.IsNil() || v.Elem().IsZero()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
 }
 
 func containersEqual(r, l *corev1.Container) bool {
-	if r.Image != l.Image {
+	if r.Name != l.Name || r.Image != l.Image || r.ImagePullPolicy != l.ImagePullPolicy {
+		return false
+	}
+	// deployments created by older operator versions or edited by hand
+	// might have credentials set as plain values
+	if hasInlinedCredentials(r) || hasInlinedCredentials(l) {
+		return false
+	}
+	if !specEqual(l.Resources, r.Resources) ||
+		!specEqual(l.SecurityContext, r.SecurityContext) ||
+		!specEqual(l.VolumeMounts, r.VolumeMounts) ||
+		!specEqual(l.Ports, r.Ports) ||
+		!specEqual(l.LivenessProbe, r.LivenessProbe) ||
+		!specEqual(l.ReadinessProbe, r.ReadinessProbe) {
 		return false
 	}
 	if len(r.Env) != len(l.Env) {
@@ -68,6 +187,31 @@ func containersEqual(r, l *corev1.Container) bool {
 	return true
 }
 
+// hasInlinedCredentials checks whether access token key or secret is set directly
+// in the container env instead of being referenced from a secret
+func hasInlinedCredentials(container *corev1.Container) bool {
+	for i := range container.Env {
+		switch container.Env[i].Name {
+		case containerTokenKeyEnvName, containerTokenSecretEnvName:
+			if container.Env[i].Value != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deploymentHasInlinedCredentials checks whether any of the deployment containers
+// has credentials set as plain values
+func deploymentHasInlinedCredentials(deployment *appsv1.Deployment) bool {
+	for i := range deployment.Spec.Template.Spec.Containers {
+		if hasInlinedCredentials(&deployment.Spec.Template.Spec.Containers[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 func envVarSourceEqual(current, desired *corev1.EnvVarSource) bool {
 	if current == nil && desired == nil {
 		// if not set, nothing to do
@@ -78,15 +222,12 @@ func envVarSourceEqual(current, desired *corev1.EnvVarSource) bool {
 		return false
 	}
 
-	if !reflect.DeepEqual(current, desired) {
-		return false
-	}
-
-	return true
+	// field refs get the API version defaulted
+	return apiequality.Semantic.DeepDerivative(desired, current)
 }
 
 // envForDeployment generates env configuration for the deployment based on the spec and credentials
-func (r *ReconcileWebhookRelayForward) envForDeployment(cr *forwardv1.WebhookRelayForward) []corev1.EnvVar {
+func (r *ReconcileWebhookRelayForward) envForDeployment(creds *agentCredentials, cr *forwardv1.WebhookRelayForward) []corev1.EnvVar {
 	var buckets []string
 	for idx := range cr.Spec.Buckets {
 		buckets = append(buckets, cr.Spec.Buckets[idx].Name)
@@ -99,56 +240,57 @@ func (r *ReconcileWebhookRelayForward) envForDeployment(cr *forwardv1.WebhookRel
 		},
 	}
 
-	// configuring authentication for the container
-	if cr.Spec.SecretRefName != "" {
-
-		keyRefSelect := &corev1.SecretKeySelector{}
-		keyRefSelect.Name = cr.Spec.SecretRefName
-		keyRefSelect.Key = forwardv1.AccessTokenKeyName
+	// configuring authentication for the container, credentials are always
+	// referenced from a secret so they can't be read from the deployment
+	keyRefSelect := &corev1.SecretKeySelector{}
+	keyRefSelect.Name = creds.secretName
+	keyRefSelect.Key = forwardv1.AccessTokenKeyName
 
-		secretRefSelect := &corev1.SecretKeySelector{}
-		secretRefSelect.Name = cr.Spec.SecretRefName
-		secretRefSelect.Key = forwardv1.AccessTokenSecretName
+	secretRefSelect := &corev1.SecretKeySelector{}
+	secretRefSelect.Name = creds.secretName
+	secretRefSelect.Key = forwardv1.AccessTokenSecretName
 
-		env = append(env,
-			corev1.EnvVar{
-				Name: containerTokenKeyEnvName,
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: keyRefSelect,
-				},
+	env = append(env,
+		corev1.EnvVar{
+			Name: containerTokenKeyEnvName,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: keyRefSelect,
 			},
-			corev1.EnvVar{
-				Name: containerTokenSecretEnvName,
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: secretRefSelect,
-				},
-			},
-		)
-	} else {
-		// setting the ones from the client that have likely come
-		// from the environment variables set directly on the operator
-		env = append(env,
-			corev1.EnvVar{
-				Name:  containerTokenKeyEnvName,
-				Value: r.apiClient.accessTokenKey,
-			},
-			corev1.EnvVar{
-				Name:  containerTokenSecretEnvName,
-				Value: r.apiClient.accessTokenSecret,
+		},
+		corev1.EnvVar{
+			Name: containerTokenSecretEnvName,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: secretRefSelect,
 			},
-		)
+		},
+	)
+
+	// additional variables, the ones set above can't be overridden
+	if cr.Spec.Agent != nil {
+		for i := range cr.Spec.Agent.Env {
+			switch cr.Spec.Agent.Env[i].Name {
+			case containerBucketsEnvName, containerTokenKeyEnvName, containerTokenSecretEnvName:
+				continue
+			}
+			env = append(env, cr.Spec.Agent.Env[i])
+		}
 	}
 
 	return env
 }
 
+func deploymentName(cr *forwardv1.WebhookRelayForward) string {
+	return cr.Name + "-whr-deployment"
+}
+
 // newDeploymentForCR returns a new Webhook Relay forwarder deployment with the same name/namespace as the cr
-func (r *ReconcileWebhookRelayForward) newDeploymentForCR(cr *forwardv1.WebhookRelayForward) *appsv1.Deployment {
-	labels := map[string]string{
-		"app": cr.Name,
-	}
-	podLabels := map[string]string{
-		"name": "webhookrelay-forwarder",
+func (r *ReconcileWebhookRelayForward) newDeploymentForCR(creds *agentCredentials, cr *forwardv1.WebhookRelayForward) *appsv1.Deployment {
+	labels := labelsForCR(cr)
+	labels["app"] = cr.Name
+
+	agent := cr.Spec.Agent
+	if agent == nil {
+		agent = &forwardv1.AgentSpec{}
 	}
 
 	image := cr.Spec.Image
@@ -156,41 +298,146 @@ func (r *ReconcileWebhookRelayForward) newDeploymentForCR(cr *forwardv1.WebhookR
 		image = r.config.Image
 	}
 
-	env := r.envForDeployment(cr)
+	replicas := toInt32(agentReplicas(cr))
+
+	pullPolicy := corev1.PullAlways
+	if agent.ImagePullPolicy != "" {
+		pullPolicy = agent.ImagePullPolicy
+	}
+
+	resources := cr.Spec.Resources
+	if agent.Resources != nil {
+		resources = *agent.Resources
+	}
+
+	env := r.envForDeployment(creds, cr)
+
+	// user labels and annotations can't override the ones
+	// set by the operator
+	podLabels := make(map[string]string)
+	for k, v := range agent.PodLabels {
+		podLabels[k] = v
+	}
+	for k, v := range labelsForCR(cr) {
+		podLabels[k] = v
+	}
+
+	podAnnotations := make(map[string]string)
+	for k, v := range agent.PodAnnotations {
+		podAnnotations[k] = v
+	}
+	podAnnotations[credentialsHashAnnotation] = credentialsID(creds.key, creds.secret)[:16]
+
+	var ports []corev1.ContainerPort
+	var livenessProbe, readinessProbe *corev1.Probe
+	if health := agentHealth(cr); health != nil {
+		ports = []corev1.ContainerPort{
+			{
+				Name:          agentHealthPortName,
+				ContainerPort: health.Port,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		}
+		livenessProbe = agentProbe(health, health.LivenessPath)
+		readinessProbe = agentProbe(health, health.ReadinessPath)
+	}
 
 	podTemplateSpec := corev1.PodTemplateSpec{
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
 					Name:            "webhookrelayd",
-					ImagePullPolicy: corev1.PullAlways,
+					ImagePullPolicy: pullPolicy,
 					Image:           image,
 					Env:             env,
+					Resources:       resources,
+					SecurityContext: agent.SecurityContext,
+					VolumeMounts:    agent.VolumeMounts,
+					Ports:           ports,
+					LivenessProbe:   livenessProbe,
+					ReadinessProbe:  readinessProbe,
 				},
 			},
+			ImagePullSecrets:   agent.ImagePullSecrets,
+			ServiceAccountName: agent.ServiceAccountName,
+			NodeSelector:       agent.NodeSelector,
+			Tolerations:        agent.Tolerations,
+			Affinity:           agent.Affinity,
+			PriorityClassName:  agent.PriorityClassName,
+			SecurityContext:    agent.PodSecurityContext,
+			Volumes:            agent.Volumes,
+
+			TopologySpreadConstraints: r.agentTopologySpreadConstraints(cr),
 		},
 	}
 	podTemplateSpec.Labels = podLabels
+	podTemplateSpec.Annotations = podAnnotations
 	podTemplateSpec.Name = "webhookrelay"
 	// TODO: set namespace
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      cr.Name + "-whr-deployment",
+			Name:      deploymentName(cr),
 			Namespace: cr.Namespace,
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: toInt32(1),
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"name": "webhookrelay-forwarder",
-				},
+				MatchLabels: selectorLabelsForCR(cr),
 			},
 			Template: podTemplateSpec,
 		},
 	}
 }
 
+// agentHealth returns health endpoint configuration with defaults applied,
+// nil unless probes are enabled
+func agentHealth(cr *forwardv1.WebhookRelayForward) *forwardv1.AgentHealthSpec {
+	if cr.Spec.Agent == nil || cr.Spec.Agent.Health == nil || !cr.Spec.Agent.Health.Enabled {
+		return nil
+	}
+	health := cr.Spec.Agent.Health.DeepCopy()
+
+	if health.Port == 0 {
+		health.Port = defaultAgentHealthPort
+	}
+	if health.LivenessPath == "" {
+		health.LivenessPath = defaultAgentHealthPath
+	}
+	if health.ReadinessPath == "" {
+		health.ReadinessPath = defaultAgentHealthPath
+	}
+	if health.InitialDelaySeconds == 0 {
+		health.InitialDelaySeconds = 5
+	}
+	if health.PeriodSeconds == 0 {
+		health.PeriodSeconds = 10
+	}
+	if health.FailureThreshold == 0 {
+		health.FailureThreshold = 3
+	}
+	return health
+}
+
+// agentProbe returns HTTP probe against the health port, fields that the API server
+// would default are set explicitly so the probes can be compared
+func agentProbe(health *forwardv1.AgentHealthSpec, path string) *corev1.Probe {
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   path,
+				Port:   intstr.FromString(agentHealthPortName),
+				Scheme: corev1.URISchemeHTTP,
+			},
+		},
+		InitialDelaySeconds: health.InitialDelaySeconds,
+		PeriodSeconds:       health.PeriodSeconds,
+		FailureThreshold:    health.FailureThreshold,
+		TimeoutSeconds:      1,
+		SuccessThreshold:    1,
+	}
+}
+
 func toInt32(val int32) *int32 {
 	return &val
 }
@@ -0,0 +1,140 @@
+package webhookrelayforward
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+func TestNewDeploymentForCR_Agent(t *testing.T) {
+	r := &ReconcileWebhookRelayForward{config: &config.Config{Image: "webhookrelay/webhookrelayd"}}
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Buckets: []forwardv1.BucketSpec{{Name: "b-1"}},
+			Agent: &forwardv1.AgentSpec{
+				Replicas:        toInt32(2),
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+				},
+				NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+				Env: []corev1.EnvVar{
+					{Name: "EXTRA", Value: "1"},
+					{Name: containerBucketsEnvName, Value: "overridden"},
+				},
+				PodLabels:      map[string]string{"team": "a", instanceLabel: "overridden"},
+				PodAnnotations: map[string]string{"prometheus.io/scrape": "true"},
+			},
+		},
+	}
+
+	deployment := r.newDeploymentForCR(&agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}, instance)
+
+	assert.Equal(t, int32(2), *deployment.Spec.Replicas)
+	assert.Equal(t, "linux", deployment.Spec.Template.Spec.NodeSelector["kubernetes.io/os"])
+	assert.Equal(t, "fwd", deployment.Spec.Template.Labels[instanceLabel])
+	assert.Equal(t, "a", deployment.Spec.Template.Labels["team"])
+	assert.Equal(t, "true", deployment.Spec.Template.Annotations["prometheus.io/scrape"])
+
+	container := deployment.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, corev1.PullIfNotPresent, container.ImagePullPolicy)
+	assert.Equal(t, "128Mi", container.Resources.Limits.Memory().String())
+	assert.Equal(t, 4, len(container.Env))
+	assert.Equal(t, "b-1", container.Env[0].Value)
+	assert.Equal(t, "EXTRA", container.Env[3].Name)
+
+	// probes are disabled by default
+	assert.Equal(t, 0, len(container.Ports))
+	assert.Assert(t, container.LivenessProbe == nil)
+	assert.Assert(t, container.ReadinessProbe == nil)
+
+	instance.Spec.Agent.Health = &forwardv1.AgentHealthSpec{Enabled: true}
+	deployment = r.newDeploymentForCR(&agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}, instance)
+	container = deployment.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, int32(defaultAgentHealthPort), container.Ports[0].ContainerPort)
+	assert.Equal(t, defaultAgentHealthPath, container.LivenessProbe.HTTPGet.Path)
+	assert.Equal(t, agentHealthPortName, container.ReadinessProbe.HTTPGet.Port.String())
+}
+
+func TestCheckDeployment_AgentDrift(t *testing.T) {
+	r := &ReconcileWebhookRelayForward{config: &config.Config{Image: "webhookrelay/webhookrelayd"}}
+	instance := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "default"},
+		Spec: forwardv1.WebhookRelayForwardSpec{
+			Agent: &forwardv1.AgentSpec{
+				Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+				Health:      &forwardv1.AgentHealthSpec{Enabled: true},
+			},
+		},
+	}
+	creds := &agentCredentials{secretName: "fwd-whr-credentials", key: "key", secret: "secret"}
+
+	current := r.newDeploymentForCR(creds, instance)
+	// defaults set by the API server
+	current.Spec.Template.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	current.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	current.Spec.Template.Spec.Containers[0].LivenessProbe.TimeoutSeconds = 1
+	current.Spec.Template.Spec.Containers[0].LivenessProbe.HTTPGet.Scheme = corev1.URISchemeHTTP
+	// fields set by other managers
+	current.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = "2020-06-18T23:05:33Z"
+	current.Spec.Template.Spec.Containers = append(current.Spec.Template.Spec.Containers, corev1.Container{Name: "istio-proxy"})
+
+	_, equal := r.checkDeployment(creds, instance, current)
+	assert.Assert(t, equal)
+
+	t.Run("TestToleration", func(t *testing.T) {
+		changed := current.DeepCopy()
+		changed.Spec.Template.Spec.Tolerations = nil
+
+		patched, equal := r.checkDeployment(creds, instance, changed)
+		assert.Assert(t, !equal)
+		assert.Equal(t, "dedicated", patched.Spec.Template.Spec.Tolerations[0].Key)
+		// only operator managed fields are applied
+		_, ok := patched.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"]
+		assert.Assert(t, !ok)
+		assert.Equal(t, 1, len(patched.Spec.Template.Spec.Containers))
+	})
+
+	t.Run("TestReplicas", func(t *testing.T) {
+		changed := current.DeepCopy()
+		changed.Spec.Replicas = toInt32(3)
+
+		patched, equal := r.checkDeployment(creds, instance, changed)
+		assert.Assert(t, !equal)
+		assert.Equal(t, int32(1), *patched.Spec.Replicas)
+	})
+
+	t.Run("TestPodLabels", func(t *testing.T) {
+		changed := current.DeepCopy()
+		changed.Spec.Template.Labels[managedByLabel] = "helm"
+
+		_, equal := r.checkDeployment(creds, instance, changed)
+		assert.Assert(t, !equal)
+	})
+
+	t.Run("TestRemovedPodLabel", func(t *testing.T) {
+		changed := current.DeepCopy()
+		changed.Spec.Template.Labels["team"] = "a"
+		changed.ManagedFields = []metav1.ManagedFieldsEntry{{
+			Manager:   fieldManager,
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:template":{"f:metadata":{"f:labels":{"f:team":{}}}}}}`)},
+		}}
+
+		_, equal := r.checkDeployment(creds, instance, changed)
+		assert.Assert(t, !equal)
+
+		// label set by another manager
+		changed.ManagedFields[0].Manager = "kubectl"
+		_, equal = r.checkDeployment(creds, instance, changed)
+		assert.Assert(t, equal)
+	})
+}
@@ -6,33 +6,129 @@ import (
 	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
 )
 
+// routingResult is the outcome of the routing configuration
+type routingResult struct {
+	ownership *bucketsOwnership
+	// buckets holds the state of each bucket from the spec,
+	// indexed by bucket name
+	buckets map[string]*forwardv1.BucketStatus
+	// listErr is set when buckets couldn't be listed, nothing
+	// else could be configured then
+	listErr error
+	// errs are the failures of individual buckets, inputs
+	// and outputs
+	errs routingErrors
+	// publicEndpoints of the inputs defined in the spec
+	publicEndpoints []string
+	// drift are the objects that were changed outside of the
+	// operator and updated to match the spec again
+	drift []driftChange
+	// plan lists changes that would be made, only set in Plan mode
+	plan []plannedAction
+}
+
+// err combines all routing configuration errors
+func (res *routingResult) err() error {
+	if res.listErr != nil {
+		return res.listErr
+	}
+	if len(res.errs) > 0 {
+		return res.errs
+	}
+	return nil
+}
+
+func newRoutingResult() *routingResult {
+	return &routingResult{
+		ownership: newBucketsOwnership(),
+		buckets:   make(map[string]*forwardv1.BucketStatus),
+	}
+}
+
+// bucketStatus returns the state entry of the bucket, creating a pending one
+// if the bucket wasn't seen yet
+func (res *routingResult) bucketStatus(name string) *forwardv1.BucketStatus {
+	bs, ok := res.buckets[name]
+	if !ok {
+		bs = &forwardv1.BucketStatus{Name: name, State: forwardv1.SyncStatePending}
+		res.buckets[name] = bs
+	}
+	return bs
+}
+
+// addDrift records an updated object if it was changed outside of the operator
+func (res *routingResult) addDrift(instance *forwardv1.WebhookRelayForward, changes ...driftChange) {
+	for i := range changes {
+		if isDrift(instance, &changes[i]) {
+			res.drift = append(res.drift, changes[i])
+		}
+	}
+}
+
+// bucketStatuses returns bucket states in the same order as they are
+// defined in the spec
+func (res *routingResult) bucketStatuses(instance *forwardv1.WebhookRelayForward) []forwardv1.BucketStatus {
+	var statuses []forwardv1.BucketStatus
+	for idx := range instance.Spec.Buckets {
+		statuses = append(statuses, *res.bucketStatus(instance.Spec.Buckets[idx].Name))
+	}
+	return statuses
+}
+
 // ensureRoutingConfiguration check buckets, inputs and outputs on the Webhook Relay server side. If something needs to be
 // changed - it performs necessary configuration changes
-func (r *ReconcileWebhookRelayForward) ensureRoutingConfiguration(logger logr.Logger, instance *forwardv1.WebhookRelayForward) error {
+func (r *ReconcileWebhookRelayForward) ensureRoutingConfiguration(logger logr.Logger, apiClient *WebhookRelayClient, instance *forwardv1.WebhookRelayForward) *routingResult {
 
-	var err error
+	result := newRoutingResult()
 
-	err = r.ensureBucketConfiguration(logger, instance)
-	if err != nil {
-		return err
+	// errors from the bucket configuration are returned only after inputs and outputs
+	// are configured for buckets that we can manage
+	result.listErr = r.ensureBucketConfiguration(logger, apiClient, instance, result)
+	if !result.ownership.checked {
+		return result
 	}
 
+	crOwner := ownerForCR(instance)
+
 	// Configuring bucket inputs and outputs. Here, errors can happen mostly due to user error when
 	// invalid values are set, however we can still continue as most of the input/output updates should succeed
 	for idx := range instance.Spec.Buckets {
+		if !result.ownership.managed[instance.Spec.Buckets[idx].Name] {
+			// bucket is either managed by another CR or adoption policy
+			// doesn't allow us to modify it
+			continue
+		}
+
 		// first ensuring outputs, because we might need to specify output
 		// ID on the input if it has "ResponseFromOutput"
-		err = r.ensureBucketOutputs(logger, &instance.Spec.Buckets[idx])
-		if err != nil {
-			logger.Error(err, "failed to configure bucket '%s' outputs", instance.Spec.Buckets[idx].Name)
+		bucketStatus := result.bucketStatus(instance.Spec.Buckets[idx].Name)
+
+		var (
+			changes []driftChange
+			errs    routingErrors
+		)
+		bucketStatus.Outputs, changes, errs = r.ensureBucketOutputs(logger, apiClient, crOwner, &instance.Spec.Buckets[idx])
+		result.addDrift(instance, changes...)
+		if len(errs) > 0 {
+			logger.Error(errs, "failed to configure bucket outputs", "bucket_ref", instance.Spec.Buckets[idx].Name)
+			result.errs = append(result.errs, errs...)
 		}
 
-		err = r.ensureBucketInputs(logger, &instance.Spec.Buckets[idx])
-		if err != nil {
-			logger.Error(err, "failed to configure bucket '%s' inputs", instance.Spec.Buckets[idx].Name)
+		bucketStatus.Inputs, changes, errs = r.ensureBucketInputs(logger, apiClient, crOwner, &instance.Spec.Buckets[idx])
+		result.addDrift(instance, changes...)
+		if len(errs) > 0 {
+			logger.Error(errs, "failed to configure bucket inputs", "bucket_ref", instance.Spec.Buckets[idx].Name)
+			result.errs = append(result.errs, errs...)
 		}
+	}
 
+	if len(result.errs) > 0 {
+		// something might have been changed outside of the operator,
+		// listing buckets again during the next reconcile
+		apiClient.bucketsCache.Invalidate()
 	}
 
-	return nil
+	result.publicEndpoints = desiredPublicEndpoints(instance, apiClient.bucketsCache)
+
+	return result
 }
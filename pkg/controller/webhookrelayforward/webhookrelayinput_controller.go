@@ -0,0 +1,168 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// addInputController adds WebhookRelayInput controller to mgr
+func addInputController(mgr manager.Manager, r *ReconcileWebhookRelayInput) error {
+	c, err := controller.New("webhookrelayinput-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: r.config.MaxConcurrentReconciles,
+		RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(r.config.BackoffBase, r.config.BackoffMax),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayInput{}}, &handler.EnqueueRequestForObject{}, specChangedPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Inputs are configured once their bucket is synced so bucket
+	// CR status changes are not filtered out
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &forwardv1.WebhookRelayInput{}, bucketRefIndexKey, indexBucketRef)
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayBucket{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: requestsForBucketRefs(r.client, &forwardv1.WebhookRelayInputList{}),
+	})
+}
+
+// blank assignment to verify that ReconcileWebhookRelayInput implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileWebhookRelayInput{}
+
+// ReconcileWebhookRelayInput reconciles a WebhookRelayInput object
+type ReconcileWebhookRelayInput struct {
+	routingObjectReconciler
+}
+
+// Reconcile creates or updates the input so it matches the WebhookRelayInput spec
+func (r *ReconcileWebhookRelayInput) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	return r.reconcileBucketObject(r, request)
+}
+
+func (r *ReconcileWebhookRelayInput) newObject() routingObject {
+	return &forwardv1.WebhookRelayInput{}
+}
+
+func (r *ReconcileWebhookRelayInput) crKind() string {
+	return kindInputCR
+}
+
+func (r *ReconcileWebhookRelayInput) bucketRef(instance routingObject) string {
+	return instance.(*forwardv1.WebhookRelayInput).Spec.BucketRef.Name
+}
+
+// deletionPolicy returns the deletion policy, inputs are retained by default
+// so the public endpoint keeps working if the CR is re-created
+func (r *ReconcileWebhookRelayInput) deletionPolicy(instance routingObject) forwardv1.RoutingObjectDeletionPolicy {
+	if policy := instance.(*forwardv1.WebhookRelayInput).Spec.DeletionPolicy; policy != "" {
+		return policy
+	}
+	return forwardv1.RoutingObjectDeletionPolicyRetain
+}
+
+func (r *ReconcileWebhookRelayInput) objectStatus(instance routingObject) *forwardv1.RoutingObjectStatus {
+	return &instance.(*forwardv1.WebhookRelayInput).Status.RoutingObjectStatus
+}
+
+// sync creates or updates the input and records its state in the status
+func (r *ReconcileWebhookRelayInput) sync(logger logr.Logger, ref *referencedBucket, obj routingObject) error {
+	instance := obj.(*forwardv1.WebhookRelayInput)
+	status := &instance.Status
+	bucket := ref.bucket
+
+	crOwner := ownerForObject(kindInputCR, instance)
+	spec := instance.Spec.InputSpec.DeepCopy()
+	spec.Name = instance.InputName()
+
+	desired := inputSpecToInput(spec, bucket)
+	description := desired.Description
+	desired.Description = withOwnershipMarker(description, crOwner)
+
+	for _, input := range bucket.Inputs {
+		if input.Name != spec.Name {
+			continue
+		}
+		status.ID = input.ID
+		status.EndpointURL = input.EndpointURL()
+		if !r.adoptObject(instance, &status.RoutingObjectStatus, ref, crOwner, kindInput, input.Name, input.Description) {
+			return nil
+		}
+		desired.Description = withOwnershipMarker(description, managingOwner(crOwner, input.Description))
+	}
+
+	// inputs are never deleted when renamed, 3rd party services might
+	// still be sending webhooks to the old endpoint
+	diff := getInputsDiff(bucket.Inputs, []*webhookrelay.Input{desired})
+
+	for _, input := range diff.create {
+		logger.Info("creating input", "input_name", input.Name)
+		created, err := ref.apiClient.client.CreateInput(input)
+		if err != nil {
+			return err
+		}
+		status.ID = created.ID
+		status.EndpointURL = created.EndpointURL()
+		ref.apiClient.bucketsCache.AddInput(created)
+		r.recordObjectDrift(instance, &status.RoutingObjectStatus, driftChange{kind: kindInput, bucket: bucket.Name, name: input.Name, fields: []string{driftFieldDeleted}})
+	}
+
+	for _, input := range diff.update {
+		fields := diff.fields[input.Name]
+		logger.Info("updating input",
+			"input_id", input.ID,
+			"input_name", input.Name,
+			"fields", fields,
+		)
+		updated, err := ref.apiClient.client.UpdateInput(input)
+		if err != nil {
+			return err
+		}
+		status.EndpointURL = updated.EndpointURL()
+		ref.apiClient.bucketsCache.AddInput(updated)
+		r.recordObjectDrift(instance, &status.RoutingObjectStatus, driftChange{kind: kindInput, bucket: bucket.Name, name: input.Name, fields: fields})
+	}
+
+	setObjectState(&status.RoutingObjectStatus, instance.GetGeneration(), forwardv1.SyncStateSynced, "")
+	return nil
+}
+
+// cleanup deletes the input if it was created by this CR
+func (r *ReconcileWebhookRelayInput) cleanup(logger logr.Logger, ref *referencedBucket, obj routingObject) error {
+	instance := obj.(*forwardv1.WebhookRelayInput)
+	crOwner := ownerForObject(kindInputCR, instance)
+	for _, input := range ref.bucket.Inputs {
+		if input.Name != instance.InputName() || !ownedBy(input.Description, crOwner) || adopted(input.Description) {
+			continue
+		}
+		logger.Info("deleting input",
+			"input_id", input.ID,
+			"input_name", input.Name,
+		)
+		err := ref.apiClient.client.DeleteInput(&webhookrelay.InputDeleteOptions{
+			Bucket: ref.bucket.ID,
+			Input:  input.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete input '%s' from bucket '%s': %w", input.Name, ref.bucket.Name, err)
+		}
+		ref.apiClient.bucketsCache.Invalidate()
+	}
+	return nil
+}
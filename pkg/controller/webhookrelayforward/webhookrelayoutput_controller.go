@@ -0,0 +1,179 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+// addOutputController adds WebhookRelayOutput controller to mgr
+func addOutputController(mgr manager.Manager, r *ReconcileWebhookRelayOutput) error {
+	c, err := controller.New("webhookrelayoutput-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: r.config.MaxConcurrentReconciles,
+		RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(r.config.BackoffBase, r.config.BackoffMax),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayOutput{}}, &handler.EnqueueRequestForObject{}, specChangedPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Outputs are configured once their bucket is synced so bucket
+	// CR status changes are not filtered out
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &forwardv1.WebhookRelayOutput{}, bucketRefIndexKey, indexBucketRef)
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &forwardv1.WebhookRelayBucket{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: requestsForBucketRefs(r.client, &forwardv1.WebhookRelayOutputList{}),
+	})
+}
+
+// blank assignment to verify that ReconcileWebhookRelayOutput implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileWebhookRelayOutput{}
+
+// ReconcileWebhookRelayOutput reconciles a WebhookRelayOutput object
+type ReconcileWebhookRelayOutput struct {
+	routingObjectReconciler
+}
+
+// Reconcile creates or updates the output so it matches the WebhookRelayOutput spec
+func (r *ReconcileWebhookRelayOutput) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	return r.reconcileBucketObject(r, request)
+}
+
+func (r *ReconcileWebhookRelayOutput) newObject() routingObject {
+	return &forwardv1.WebhookRelayOutput{}
+}
+
+func (r *ReconcileWebhookRelayOutput) crKind() string {
+	return kindOutputCR
+}
+
+func (r *ReconcileWebhookRelayOutput) bucketRef(instance routingObject) string {
+	return instance.(*forwardv1.WebhookRelayOutput).Spec.BucketRef.Name
+}
+
+// deletionPolicy returns the deletion policy, outputs are deleted by default
+// so webhooks are no longer forwarded once the CR is gone
+func (r *ReconcileWebhookRelayOutput) deletionPolicy(instance routingObject) forwardv1.RoutingObjectDeletionPolicy {
+	if policy := instance.(*forwardv1.WebhookRelayOutput).Spec.DeletionPolicy; policy != "" {
+		return policy
+	}
+	return forwardv1.RoutingObjectDeletionPolicyDelete
+}
+
+func (r *ReconcileWebhookRelayOutput) objectStatus(instance routingObject) *forwardv1.RoutingObjectStatus {
+	return &instance.(*forwardv1.WebhookRelayOutput).Status.RoutingObjectStatus
+}
+
+// sync creates or updates the output and records its state in the status
+func (r *ReconcileWebhookRelayOutput) sync(logger logr.Logger, ref *referencedBucket, obj routingObject) error {
+	instance := obj.(*forwardv1.WebhookRelayOutput)
+	status := &instance.Status
+	bucket := ref.bucket
+
+	crOwner := ownerForObject(kindOutputCR, instance)
+	spec := instance.Spec.OutputSpec.DeepCopy()
+	spec.Name = instance.OutputName()
+
+	desired := inputSpecToOutput(spec, bucket)
+	description := desired.Description
+	desired.Description = withOwnershipMarker(description, crOwner)
+
+	for _, output := range bucket.Outputs {
+		if output.Name != spec.Name {
+			continue
+		}
+		status.ID = output.ID
+		if !r.adoptObject(instance, &status.RoutingObjectStatus, ref, crOwner, kindOutput, output.Name, output.Description) {
+			return nil
+		}
+		desired.Description = withOwnershipMarker(description, managingOwner(crOwner, output.Description))
+	}
+
+	// outputs left by this CR under another name are deleted
+	diff := getOutputsDiff(bucket.Outputs, []*webhookrelay.Output{desired}, crOwner)
+
+	for _, output := range diff.create {
+		logger.Info("creating output", "output_name", output.Name)
+		created, err := ref.apiClient.client.CreateOutput(output)
+		if err != nil {
+			return err
+		}
+		status.ID = created.ID
+		ref.apiClient.bucketsCache.AddOutput(created)
+		r.recordObjectDrift(instance, &status.RoutingObjectStatus, driftChange{kind: kindOutput, bucket: bucket.Name, name: output.Name, fields: []string{driftFieldDeleted}})
+	}
+
+	for _, output := range diff.update {
+		fields := diff.fields[output.Name]
+		logger.Info("updating output",
+			"output_id", output.ID,
+			"output_name", output.Name,
+			"fields", fields,
+		)
+		updated, err := ref.apiClient.client.UpdateOutput(output)
+		if err != nil {
+			return err
+		}
+		ref.apiClient.bucketsCache.AddOutput(updated)
+		r.recordObjectDrift(instance, &status.RoutingObjectStatus, driftChange{kind: kindOutput, bucket: bucket.Name, name: output.Name, fields: fields})
+	}
+
+	for _, output := range diff.delete {
+		logger.Info("deleting output",
+			"output_id", output.ID,
+			"output_name", output.Name,
+		)
+		err := ref.apiClient.client.DeleteOutput(&webhookrelay.OutputDeleteOptions{
+			Bucket: output.BucketID,
+			Output: output.ID,
+		})
+		if err != nil {
+			return err
+		}
+		ref.apiClient.bucketsCache.Invalidate()
+	}
+
+	setObjectState(&status.RoutingObjectStatus, instance.GetGeneration(), forwardv1.SyncStateSynced, "")
+	return nil
+}
+
+// cleanup deletes the output if it was created by this CR
+func (r *ReconcileWebhookRelayOutput) cleanup(logger logr.Logger, ref *referencedBucket, obj routingObject) error {
+	instance := obj.(*forwardv1.WebhookRelayOutput)
+	crOwner := ownerForObject(kindOutputCR, instance)
+	for _, output := range ref.bucket.Outputs {
+		if output.Name != instance.OutputName() || !ownedBy(output.Description, crOwner) || adopted(output.Description) {
+			continue
+		}
+		logger.Info("deleting output",
+			"output_id", output.ID,
+			"output_name", output.Name,
+		)
+		err := ref.apiClient.client.DeleteOutput(&webhookrelay.OutputDeleteOptions{
+			Bucket: ref.bucket.ID,
+			Output: output.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete output '%s' from bucket '%s': %w", output.Name, ref.bucket.Name, err)
+		}
+		ref.apiClient.bucketsCache.Invalidate()
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package webhookrelayforward
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+// testBucketID has to be a UUID, otherwise the client looks the bucket up by name
+const testBucketID = "7b5ba6b6-3c35-4e2e-9b6a-0d2f7e5c6a11"
+
+// newTestOutputReconciler returns output reconciler that uses the test server with
+// operator credentials, buckets are served from the cache
+func newTestOutputReconciler(t *testing.T, srv *httptest.Server, buckets []*webhookrelay.Bucket, objs ...runtime.Object) *ReconcileWebhookRelayOutput {
+	s := runtime.NewScheme()
+	assert.NilError(t, corev1.AddToScheme(s))
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+
+	cfg := &config.Config{}
+	cfg.Relay.Key = "key"
+	cfg.Relay.Secret = "secret"
+
+	apiClient := newTestAPIClient(t, srv)
+	apiClient.refreshInterval = time.Hour
+	apiClient.bucketsCache.Set(buckets)
+
+	clients := newClientPool(time.Hour)
+	clients.clients[credentialsID("key", "secret")] = &pooledClient{client: apiClient, lastUsed: time.Now()}
+
+	return &ReconcileWebhookRelayOutput{routingObjectReconciler{
+		client:   fake.NewFakeClientWithScheme(s, objs...),
+		recorder: record.NewFakeRecorder(10),
+		clients:  clients,
+		config:   cfg,
+	}}
+}
+
+func TestSyncOutput(t *testing.T) {
+	var created webhookrelay.Output
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/buckets/"+testBucketID+"/outputs" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.NilError(t, json.NewDecoder(req.Body).Decode(&created))
+		created.ID = "output-id"
+		assert.NilError(t, json.NewEncoder(w).Encode(&created))
+	}))
+	defer srv.Close()
+
+	bucketCR := &forwardv1.WebhookRelayBucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "platform"},
+		Status: forwardv1.WebhookRelayBucketStatus{
+			RoutingObjectStatus: forwardv1.RoutingObjectStatus{ID: testBucketID, State: forwardv1.SyncStateSynced},
+		},
+	}
+	instance := &forwardv1.WebhookRelayOutput{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "platform", UID: "1234", Generation: 2},
+		Spec: forwardv1.WebhookRelayOutputSpec{
+			BucketRef:  corev1.LocalObjectReference{Name: "shared"},
+			OutputSpec: forwardv1.OutputSpec{Destination: "http://team-a"},
+		},
+	}
+
+	r := newTestOutputReconciler(t, srv, []*webhookrelay.Bucket{{ID: testBucketID, Name: "shared"}}, bucketCR, instance)
+
+	assert.NilError(t, r.syncBucketObject(log, r, instance))
+	status := &instance.Status
+
+	assert.Equal(t, forwardv1.SyncStateSynced, status.State)
+	assert.Equal(t, "output-id", status.ID)
+	assert.Equal(t, int64(2), status.ObservedGeneration)
+
+	// output is named after the CR and marked with its kind
+	assert.Equal(t, "team-a", created.Name)
+	assert.Assert(t, ownedBy(created.Description, ownerForObject(kindOutputCR, instance)))
+	assert.Assert(t, !ownedBy(created.Description, owner{namespace: "platform", name: "team-a"}))
+}
+
+func TestSyncOutput_BucketNotReady(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+	}))
+	defer srv.Close()
+
+	instance := &forwardv1.WebhookRelayOutput{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "platform"},
+		Spec: forwardv1.WebhookRelayOutputSpec{
+			BucketRef:  corev1.LocalObjectReference{Name: "missing"},
+			OutputSpec: forwardv1.OutputSpec{Destination: "http://team-a"},
+		},
+	}
+
+	r := newTestOutputReconciler(t, srv, nil, instance)
+
+	assert.NilError(t, r.syncBucketObject(log, r, instance))
+	status := &instance.Status
+	assert.Equal(t, forwardv1.SyncStatePending, status.State)
+	assert.Equal(t, "WebhookRelayBucket 'missing' not found", status.Message)
+}
+
+func TestSyncOutput_OwnedByAnotherCR(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+	}))
+	defer srv.Close()
+
+	fwd := &forwardv1.WebhookRelayForward{
+		ObjectMeta: metav1.ObjectMeta{Name: "fwd", Namespace: "platform", UID: "5678"},
+	}
+	bucketCR := &forwardv1.WebhookRelayBucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "platform"},
+		Status: forwardv1.WebhookRelayBucketStatus{
+			RoutingObjectStatus: forwardv1.RoutingObjectStatus{ID: testBucketID, State: forwardv1.SyncStateSynced},
+		},
+	}
+	instance := &forwardv1.WebhookRelayOutput{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "platform", UID: "1234"},
+		Spec: forwardv1.WebhookRelayOutputSpec{
+			BucketRef:  corev1.LocalObjectReference{Name: "shared"},
+			OutputSpec: forwardv1.OutputSpec{Destination: "http://team-a"},
+		},
+	}
+	buckets := []*webhookrelay.Bucket{{
+		ID:   testBucketID,
+		Name: "shared",
+		Outputs: []*webhookrelay.Output{
+			{ID: "output-id", BucketID: testBucketID, Name: "team-a", Description: withOwnershipMarker("", ownerForCR(fwd))},
+		},
+	}}
+
+	r := newTestOutputReconciler(t, srv, buckets, fwd, bucketCR, instance)
+
+	assert.NilError(t, r.syncBucketObject(log, r, instance))
+	status := &instance.Status
+	assert.Equal(t, forwardv1.SyncStateFailed, status.State)
+	assert.Equal(t, "output-id", status.ID)
+	assert.Equal(t, "Output 'team-a' is managed by platform/fwd", status.Message)
+}
+
+func TestSyncOutput_Adoption(t *testing.T) {
+	var updated webhookrelay.Output
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut {
+			t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+			return
+		}
+		assert.NilError(t, json.NewDecoder(req.Body).Decode(&updated))
+		assert.NilError(t, json.NewEncoder(w).Encode(&updated))
+	}))
+	defer srv.Close()
+
+	instance := &forwardv1.WebhookRelayOutput{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "platform", UID: "1234"},
+		Spec: forwardv1.WebhookRelayOutputSpec{
+			BucketRef:  corev1.LocalObjectReference{Name: "shared"},
+			OutputSpec: forwardv1.OutputSpec{Destination: "http://team-a"},
+		},
+	}
+
+	for _, tc := range []struct {
+		policy  forwardv1.AdoptionPolicy
+		state   forwardv1.SyncState
+		event   string
+		adopted bool
+	}{
+		{policy: forwardv1.AdoptionPolicyAdopt, state: forwardv1.SyncStateSynced, event: "Normal Adopted Output 'team-a' was not created by the operator, taking it over", adopted: true},
+		{policy: forwardv1.AdoptionPolicyManagedOnly, state: forwardv1.SyncStateUnmanaged},
+		{policy: forwardv1.AdoptionPolicyFail, state: forwardv1.SyncStateFailed, event: "Warning FailedAdoption Output 'team-a' already exists and adoption policy forbids using it"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			updated = webhookrelay.Output{}
+
+			bucketCR := &forwardv1.WebhookRelayBucket{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "platform"},
+				Spec:       forwardv1.WebhookRelayBucketSpec{AdoptionPolicy: tc.policy},
+				Status: forwardv1.WebhookRelayBucketStatus{
+					RoutingObjectStatus: forwardv1.RoutingObjectStatus{ID: testBucketID, State: forwardv1.SyncStateSynced},
+				},
+			}
+			// output created in the web UI
+			buckets := []*webhookrelay.Bucket{{
+				ID:      testBucketID,
+				Name:    "shared",
+				Outputs: []*webhookrelay.Output{{ID: testOutputID, BucketID: testBucketID, Name: "team-a", Destination: "http://old"}},
+			}}
+
+			obj := instance.DeepCopy()
+			r := newTestOutputReconciler(t, srv, buckets, bucketCR, obj)
+			recorder := r.recorder.(*record.FakeRecorder)
+
+			assert.NilError(t, r.syncBucketObject(log, r, obj))
+			assert.Equal(t, tc.state, obj.Status.State)
+			assert.Equal(t, testOutputID, obj.Status.ID)
+
+			if tc.event != "" {
+				assert.Equal(t, tc.event, <-recorder.Events)
+			}
+			assert.Equal(t, 0, len(recorder.Events))
+
+			// adopted outputs are never deleted with the CR
+			assert.Equal(t, tc.adopted, adopted(updated.Description))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+	"github.com/webhookrelay/webhookrelay-operator/pkg/config"
+)
+
+// defaultingWebhookPath is where the defaulting webhook is served
+const defaultingWebhookPath = "/mutate-forward-webhookrelay-com-v1-webhookrelayforward"
+
+// AddWebhooks registers WebhookRelayForward admission and conversion webhooks with the manager
+func AddWebhooks(mgr manager.Manager) error {
+	cfg := config.MustLoad()
+
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mgr.GetWebhookServer().Register(defaultingWebhookPath, &webhook.Admission{
+		Handler: &defaulter{image: cfg.Image, decoder: decoder},
+	})
+
+	return (&forwardv1.WebhookRelayForward{}).SetupWebhookWithManager(mgr)
+}
+
+// defaulter fills the defaults that depend on the operator configuration (i.e. agent
+// image) into the CR, which is why it's not a part of the API types
+type defaulter struct {
+	image   string
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:webhook:path=/mutate-forward-webhookrelay-com-v1-webhookrelayforward,mutating=true,failurePolicy=fail,groups=forward.webhookrelay.com,resources=webhookrelayforwards,verbs=create;update,versions=v1,name=mwebhookrelayforward.forward.webhookrelay.com
+
+func (d *defaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	instance := &forwardv1.WebhookRelayForward{}
+	if err := d.decoder.Decode(req, instance); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// namespace might not be set in the manifest
+	namespace := instance.GetNamespace()
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+	instance.SetDefaults(namespace, d.image)
+
+	marshaled, err := json.Marshal(instance)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,59 @@
+package webhookrelayforward
+
+import (
+	"context"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/webhookrelay/webhookrelay-go"
+	"gotest.tools/assert"
+
+	forwardv1 "github.com/webhookrelay/webhookrelay-operator/pkg/apis/forward/v1"
+)
+
+func TestDefaulter(t *testing.T) {
+	s := runtime.NewScheme()
+	assert.NilError(t, forwardv1.SchemeBuilder.AddToScheme(s))
+	decoder, err := admission.NewDecoder(s)
+	assert.NilError(t, err)
+
+	d := &defaulter{image: "webhookrelay/webhookrelayd", decoder: decoder}
+
+	raw := []byte(`{
+		"apiVersion": "forward.webhookrelay.com/v1",
+		"kind": "WebhookRelayForward",
+		"metadata": {"name": "fwd"},
+		"spec": {"buckets": [{"name": "b-1", "outputs": [{"name": "out", "destination": "http://svc"}]}]}
+	}`)
+	resp := d.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Namespace: "default",
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+	assert.Assert(t, resp.Allowed)
+
+	patches := make(map[string]interface{})
+	for _, p := range resp.Patches {
+		patches[p.Path] = p.Value
+	}
+	assert.Equal(t, "webhookrelay/webhookrelayd", patches["/spec/image"])
+	assert.Equal(t, "Apply", patches["/spec/mode"])
+	assert.Equal(t, "Auto-created bucket by the operator for default/fwd", patches["/spec/buckets/0/description"])
+	assert.Equal(t, true, patches["/spec/buckets/0/outputs/0/internal"])
+	_, ok := patches["/metadata/namespace"]
+	assert.Assert(t, !ok)
+}
+
+func TestInputSpecToInput_DoesNotMutateSpec(t *testing.T) {
+	spec := &forwardv1.InputSpec{Name: "in", ResponseFromOutput: "out"}
+	bucket := &webhookrelay.Bucket{
+		ID:      "bucket-id",
+		Outputs: []*webhookrelay.Output{{ID: "output-id", Name: "out"}},
+	}
+
+	input := inputSpecToInput(spec, bucket)
+	assert.Equal(t, "output-id", input.ResponseFromOutput)
+	assert.Equal(t, "out", spec.ResponseFromOutput)
+}